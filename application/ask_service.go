@@ -0,0 +1,166 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"code-ai-editor/domain"
+)
+
+// AskStatus describes how a non-interactive agent run ended.
+type AskStatus string
+
+const (
+	AskStatusCompleted      AskStatus = "completed"       // The model finished with a final answer
+	AskStatusIncomplete     AskStatus = "incomplete"      // The turn stopped early, e.g. on a failed request or a loop limit
+	AskStatusBudgetExceeded AskStatus = "budget_exceeded" // The session cost or token budget was exceeded
+	AskStatusError          AskStatus = "error"           // The run was aborted, e.g. by cancellation
+)
+
+// AskToolCall is a tool call made during a non-interactive run, together with its result.
+type AskToolCall struct {
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input"`
+	Output  string          `json:"output"`
+	IsError bool            `json:"is_error"`
+}
+
+// AskUsage is the token usage and cost of a non-interactive run.
+type AskUsage struct {
+	domain.Usage
+	CostUSD  float64 `json:"cost_usd"`
+	Requests int     `json:"requests"`
+}
+
+// AskResult is the machine-readable outcome of a non-interactive run.
+type AskResult struct {
+	Status       AskStatus     `json:"status"`
+	Answer       string        `json:"answer"`
+	ToolCalls    []AskToolCall `json:"tool_calls"`
+	FilesChanged []string      `json:"files_changed"`
+	Usage        AskUsage      `json:"usage"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// AskService runs the agent on a single prompt until the model stops, without a human at the console.
+type AskService struct {
+	agent *domain.Agent
+}
+
+// NewAskService creates a new AskService with the given agent.
+func NewAskService(agent *domain.Agent) *AskService {
+	return &AskService{agent: agent}
+}
+
+// Ask runs the full agent loop, including tool calls, on the prompt and summarizes the run.
+//
+// The tool calls are captured as the agent records them, so the result is complete even if
+// the conversation is compacted during the run. A session recorder already attached to the
+// agent keeps receiving every entry.
+//
+// Returns:
+//
+//	The result of the run, and the error that aborted it, if any.
+func (s *AskService) Ask(ctx context.Context, prompt string) (AskResult, error) {
+	recorder := &askRecorder{next: s.agent.Session}
+	s.agent.Session = recorder
+	s.agent.UserMessageProvider = NewPromptMessageProvider(prompt)
+	defer func() { s.agent.Session = recorder.next }()
+
+	err := s.agent.Run(ctx)
+
+	result := recorder.result()
+	result.Usage = AskUsage{
+		Usage:    s.agent.Usage.Session.Usage,
+		CostUSD:  s.agent.Usage.Session.Cost,
+		Requests: s.agent.Usage.Session.Requests,
+	}
+	switch {
+	case errors.Is(err, domain.ErrBudgetExceeded):
+		result.Status = AskStatusBudgetExceeded
+	case err != nil:
+		result.Status = AskStatusError
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, err
+}
+
+// askRecorder collects the messages of a run as the agent records them.
+type askRecorder struct {
+	next     domain.SessionRecorder
+	messages []domain.Message
+}
+
+// Record keeps assistant and tool result messages and passes every entry on to the next recorder.
+func (r *askRecorder) Record(entry domain.SessionEntry) error {
+	if entry.Message != nil && (entry.Type == domain.SessionEntryAssistant || entry.Type == domain.SessionEntryToolResult) {
+		r.messages = append(r.messages, *entry.Message)
+	}
+	if r.next == nil {
+		return nil
+	}
+	return r.next.Record(entry)
+}
+
+// result summarizes the recorded messages. The run is complete if its last message is
+// an assistant reply without tool calls.
+func (r *askRecorder) result() AskResult {
+	result := AskResult{
+		Status:       AskStatusIncomplete,
+		ToolCalls:    []AskToolCall{},
+		FilesChanged: []string{},
+	}
+
+	calls := make(map[string]int) // Tool use ID -> index in result.ToolCalls
+	changed := make(map[string]bool)
+	for _, message := range r.messages {
+		for _, block := range message.Content {
+			switch block.Type {
+			case domain.ContentBlockText:
+				if message.Role == domain.RoleAssistant && block.Text != "" {
+					result.Answer = message.Text()
+				}
+			case domain.ContentBlockToolUse:
+				calls[block.ID] = len(result.ToolCalls)
+				result.ToolCalls = append(result.ToolCalls, AskToolCall{Name: block.Name, Input: block.Input})
+			case domain.ContentBlockToolResult:
+				i, ok := calls[block.ToolUseID]
+				if !ok {
+					continue
+				}
+				call := &result.ToolCalls[i]
+				call.Output = block.Content
+				call.IsError = block.IsError
+				if path := changedFile(*call); path != "" && !changed[path] {
+					changed[path] = true
+					result.FilesChanged = append(result.FilesChanged, path)
+				}
+			}
+		}
+	}
+
+	if n := len(r.messages); n > 0 {
+		last := r.messages[n-1]
+		if last.Role == domain.RoleAssistant && len(last.ToolUses()) == 0 {
+			result.Status = AskStatusCompleted
+		}
+	}
+	return result
+}
+
+// changedFile returns the workspace path a successful file-writing tool call changed, if any.
+func changedFile(call AskToolCall) string {
+	if call.IsError || (call.Name != "edit_file" && call.Name != "create_file") {
+		return ""
+	}
+	var input struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(call.Input, &input); err != nil {
+		return ""
+	}
+	return input.Path
+}
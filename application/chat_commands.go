@@ -0,0 +1,106 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"code-ai-editor/domain"
+)
+
+// NewSaveCommand creates the /save command, which writes the conversation to a Markdown file.
+// Without an argument the file is named after the current time, in the current directory.
+func NewSaveCommand() domain.SlashCommand {
+	return domain.CommandFunc{
+		CommandName: "save",
+		ArgsUsage:   "[file]",
+		Summary:     "Save the conversation as Markdown",
+		Run: func(ctx context.Context, agent *domain.Agent, args []string) error {
+			if len(agent.Conversation) == 0 {
+				return errors.New("the conversation is empty")
+			}
+			path := fmt.Sprintf("chat-%s.md", time.Now().Format("20060102-150405"))
+			if len(args) > 0 {
+				path = strings.Join(args, " ")
+			}
+			if err := os.WriteFile(path, []byte(renderConversationMarkdown(agent.Conversation)), 0644); err != nil {
+				return fmt.Errorf("failed to write '%s': %w", path, err)
+			}
+			agent.Notice(domain.NoticeSuccess, fmt.Sprintf("Saved %d messages to %s.", len(agent.Conversation), path))
+			return nil
+		},
+	}
+}
+
+// IndexRoot is a workspace root together with the indexer of its collection.
+type IndexRoot struct {
+	Root    domain.WorkspaceRoot
+	Indexer *IndexingService
+}
+
+// NewReindexCommand creates the /reindex command, which indexes the workspace roots again so
+// that context retrieval sees the files changed during the chat. With a root name as argument,
+// or "." for the default root, only that root is indexed.
+func NewReindexCommand(roots []IndexRoot) domain.SlashCommand {
+	dirs := make([]string, len(roots))
+	for i, root := range roots {
+		dirs[i] = root.Root.Dir
+	}
+	return domain.CommandFunc{
+		CommandName: "reindex",
+		ArgsUsage:   "[root]",
+		Summary:     fmt.Sprintf("Index %s again for context retrieval", strings.Join(dirs, ", ")),
+		Run: func(ctx context.Context, agent *domain.Agent, args []string) error {
+			only := ""
+			if len(args) > 0 && args[0] != "." {
+				only = args[0]
+			}
+			indexed := 0
+			for _, root := range roots {
+				if len(args) > 0 && only != root.Root.Name {
+					continue
+				}
+				if err := root.Indexer.IndexDirectory(ctx, root.Root.Dir); err != nil {
+					return err
+				}
+				indexed++
+			}
+			if indexed == 0 {
+				return fmt.Errorf("unknown workspace root '%s'", args[0])
+			}
+			agent.Notice(domain.NoticeSuccess, "Indexing complete.")
+			return nil
+		},
+	}
+}
+
+// renderConversationMarkdown renders a conversation as a Markdown document, with tool
+// calls and their results in code blocks.
+func renderConversationMarkdown(conversation []domain.Message) string {
+	var md strings.Builder
+	md.WriteString("# Chat transcript\n")
+	for _, message := range conversation {
+		for _, block := range message.Content {
+			switch block.Type {
+			case domain.ContentBlockText:
+				heading := "You"
+				if message.Role == domain.RoleAssistant {
+					heading = "Assistant"
+				}
+				fmt.Fprintf(&md, "\n## %s\n\n%s\n", heading, block.Text)
+			case domain.ContentBlockToolUse:
+				fmt.Fprintf(&md, "\n**Tool call:** `%s`\n\n```json\n%s\n```\n", block.Name, block.Input)
+			case domain.ContentBlockToolResult:
+				label := "Tool result"
+				if block.IsError {
+					label = "Tool error"
+				}
+				fmt.Fprintf(&md, "\n**%s:**\n\n```\n%s\n```\n", label, block.Content)
+			}
+		}
+	}
+	return md.String()
+}
@@ -1,10 +1,9 @@
 package application
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
+	"strings"
 
 	"code-ai-editor/domain"
 )
@@ -31,40 +30,59 @@ func NewChatbotService(agent *domain.Agent) *ChatbotService {
 	}
 }
 
+// LineReader reads user input from the console, such as a terminal line editor.
+type LineReader interface {
+	// ReadLine shows the prompt and reads one input, which may span several lines.
+	ReadLine(prompt string) (string, error)
+	// AddHistory remembers an input so it can be recalled later.
+	AddHistory(line string)
+}
+
 // CreateConsoleUserMessageProvider creates a new UserMessageProvider that reads messages from the console.
 //
-// It initializes a bufio.Scanner to read from standard input (os.Stdin) and returns a
-// ConsoleUserMessageProvider instance configured with this scanner. This provider is
-// responsible for retrieving user messages from the console.
-func CreateConsoleUserMessageProvider() domain.UserMessageProvider {
-	scanner := bufio.NewScanner(os.Stdin)
-
+// It returns a ConsoleUserMessageProvider instance that reads input with the given LineReader.
+// This provider is responsible for retrieving user messages from the console.
+func CreateConsoleUserMessageProvider(reader LineReader) domain.UserMessageProvider {
 	return &ConsoleUserMessageProvider{
-		scanner: scanner,
+		reader: reader,
 	}
 }
 
 // ConsoleUserMessageProvider provides user messages from the console.
-// It uses a bufio.Scanner to read input from the standard input.
+// It uses a LineReader to read input from the standard input.
 type ConsoleUserMessageProvider struct {
-	scanner *bufio.Scanner
+	reader LineReader
 }
 
 // GetUserMessage reads a message from the user via the console.
 // It prints a prompt to the console, then waits for the user to enter a message.
 // It returns the message entered by the user and a boolean indicating whether the read was successful.
-// If the read was not successful (e.g., EOF is reached), it returns an empty string and false.
+// If the read was not successful (e.g., EOF is reached or the user pressed Ctrl+C), it returns an empty string and false.
 func (p *ConsoleUserMessageProvider) GetUserMessage() (string, bool) {
-	fmt.Print("\x1b[95mYou\x1b[0m: ")
-	if !p.scanner.Scan() {
+	message, err := p.reader.ReadLine("\x1b[95mYou\x1b[0m: ")
+	if err != nil {
 		return "", false
 	}
-	return p.scanner.Text(), true
+	if strings.TrimSpace(message) != "" {
+		p.reader.AddHistory(message)
+	}
+	return message, true
+}
+
+// Confirm asks the user a yes/no question via the console.
+// It returns true only if the user answers "y" or "yes"; anything else, including EOF, counts as no.
+func (p *ConsoleUserMessageProvider) Confirm(question string) bool {
+	answer, err := p.reader.ReadLine(fmt.Sprintf("\x1b[95m%s\x1b[0m [y/N]: ", question))
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 // StartChatbot starts the chatbot and runs the agent.
-// It prints a message to the console indicating that the user can chat with Claude
-// and use 'ctrl-c' to quit. It then calls the Run method of the agent to start the chatbot.
+// It shows a message indicating that the user can chat with Claude,
+// type /help for the chat commands and use 'ctrl-c' to quit. It then calls the Run method of the agent to start the chatbot.
 //
 // Args:
 //
@@ -74,6 +92,6 @@ func (p *ConsoleUserMessageProvider) GetUserMessage() (string, bool) {
 //
 //	An error if the chatbot fails to start.
 func (s *ChatbotService) StartChatbot(ctx context.Context) error {
-	fmt.Println("Chat with Claude (use 'Ctrl+C' to quit)")
+	s.agent.Output("Chat with Claude (type /help for commands, use 'Ctrl+C' to quit)")
 	return s.agent.Run(ctx)
 }
@@ -19,22 +19,30 @@ type IndexingService struct {
 	parser      domain.CodeParser
 	embedder    domain.EmbeddingClient
 	vectorStore domain.VectorStore
+	batchSize   int      // Snippets embedded per request
+	excluded    []string // Absolute paths that are never indexed, e.g. the session transcripts
 }
 
-// NewIndexingService creates a new IndexingService.
-func NewIndexingService(parser domain.CodeParser, embedder domain.EmbeddingClient, vectorStore domain.VectorStore) *IndexingService {
+// NewIndexingService creates a new IndexingService that embeds batchSize snippets per request
+// and leaves the files and directories at the excluded paths out of the index.
+func NewIndexingService(parser domain.CodeParser, embedder domain.EmbeddingClient, vectorStore domain.VectorStore, batchSize int, excluded []string) *IndexingService {
 	return &IndexingService{
 		parser:      parser,
 		embedder:    embedder,
 		vectorStore: vectorStore,
+		batchSize:   batchSize,
+		excluded:    excluded,
 	}
 }
 
 // IndexDirectory walks through the specified directory, finds all files, parses them,
-// generates embeddings, and upserts the snippets into the vector store.
+// generates embeddings, and upserts the snippets into the vector store. The snippets record
+// their file paths relative to rootDir, so that they can be passed to the file tools.
+// Files that must not be sent to the embedding API are skipped, see skipPath.
 func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) error {
 	log.Printf("Starting indexing for directory: %s\n", rootDir)
 	var allSnippets []domain.Snippet
+	ignored := gitIgnored(rootDir)
 
 	// Track file count statistics
 	fileStats := make(map[string]int)
@@ -50,6 +58,13 @@ func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) er
 			return ctx.Err() // Stop walking if context is cancelled
 		}
 
+		if path != rootDir && s.skipPath(rootDir, path, d, ignored) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Skip directories
 		if d.IsDir() {
 			return nil
@@ -85,6 +100,12 @@ func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) er
 			return nil // Continue walking
 		}
 
+		if relPath, err := filepath.Rel(rootDir, path); err == nil {
+			for i := range snippets {
+				snippets[i].FilePath = filepath.ToSlash(relPath)
+				snippets[i].ID = snippetID(snippets[i].FilePath, snippets[i].StartLine, snippets[i].EndLine)
+			}
+		}
 		allSnippets = append(allSnippets, snippets...)
 		return nil
 	})
@@ -107,7 +128,7 @@ func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) er
 
 	if len(allSnippets) == 0 {
 		log.Println("No files parsed into snippets.")
-		return nil
+		return s.deleteStale(ctx, nil)
 	}
 
 	log.Printf("Created %d snippets. Generating embeddings...\n", len(allSnippets))
@@ -125,7 +146,7 @@ func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) er
 	}
 
 	// Process embeddings in batches to prevent memory issues
-	batchSize := 100
+	batchSize := s.batchSize
 	for i := 0; i < len(allSnippets); i += batchSize {
 		end := i + batchSize
 		if end > len(allSnippets) {
@@ -159,10 +180,76 @@ func (s *IndexingService) IndexDirectory(ctx context.Context, rootDir string) er
 		}
 	}
 
+	ids := make([]string, len(allSnippets))
+	for i, snippet := range allSnippets {
+		ids[i] = snippet.ID
+	}
+	if err := s.deleteStale(ctx, ids); err != nil {
+		return err
+	}
+
 	log.Printf("Successfully indexed %d snippets from %s\n", len(allSnippets), rootDir)
 	return nil
 }
 
+// deleteStale removes the snippets left in the vector store from earlier runs, those of files
+// that were changed or deleted since, keeping the snippets with the given IDs.
+func (s *IndexingService) deleteStale(ctx context.Context, keepIDs []string) error {
+	log.Println("Removing snippets of changed and deleted files...")
+	if err := s.vectorStore.DeleteSnippetsExcept(ctx, keepIDs); err != nil {
+		return fmt.Errorf("error removing stale snippets: %w", err)
+	}
+	return nil
+}
+
+// snippetID derives the ID of a snippet from its root-relative file path and lines, so that
+// indexing a file again overwrites its snippets instead of adding copies. Each workspace root
+// has a collection of its own, so the path identifies the file.
+func snippetID(filePath string, startLine, endLine int) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("%s:%d-%d", filePath, startLine, endLine))).String()
+}
+
+// skipPath reports whether a file or directory below rootDir is left out of the index: hidden
+// files and directories, which include .git and .env files with credentials, the excluded paths,
+// and the paths ignored by git.
+func (s *IndexingService) skipPath(rootDir, path string, d fs.DirEntry, ignored map[string]bool) bool {
+	if strings.HasPrefix(d.Name(), ".") {
+		return true
+	}
+	if absPath, err := filepath.Abs(path); err == nil {
+		for _, excluded := range s.excluded {
+			if absPath == excluded {
+				return true
+			}
+		}
+	}
+	relPath, err := filepath.Rel(rootDir, path)
+	if err != nil {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+	if d.IsDir() {
+		relPath += "/"
+	}
+	return ignored[relPath]
+}
+
+// gitIgnored returns the slash-separated paths below dir that git ignores, directories with a
+// trailing slash. It returns nil if dir is not in a git repository or git is unavailable.
+func gitIgnored(dir string) map[string]bool {
+	output := commandOutput(dir, "git", "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z")
+	if output == "" {
+		return nil
+	}
+	ignored := make(map[string]bool)
+	for _, path := range strings.Split(output, "\x00") {
+		if path != "" {
+			ignored[path] = true
+		}
+	}
+	return ignored
+}
+
 // createFileSnippet creates a snippet from a non-Go file by reading its entire content.
 func (s *IndexingService) createFileSnippet(filePath string) (domain.Snippet, error) {
 	content, err := s.readFileContent(filePath)
@@ -170,9 +257,6 @@ func (s *IndexingService) createFileSnippet(filePath string) (domain.Snippet, er
 		return domain.Snippet{}, err
 	}
 
-	// Generate a proper UUID instead of a filename-based ID
-	id := uuid.New().String()
-
 	// For text files, limit content size to prevent issues with large files
 	maxContentSize := 10000 // Maximum number of characters
 	if len(content) > maxContentSize {
@@ -180,7 +264,6 @@ func (s *IndexingService) createFileSnippet(filePath string) (domain.Snippet, er
 	}
 
 	return domain.Snippet{
-		ID:        id,
 		Content:   content,
 		FilePath:  filePath,
 		StartLine: 1,
@@ -0,0 +1,23 @@
+package application
+
+// PromptMessageProvider provides a single, fixed user message, for running the agent
+// non-interactively. After the prompt has been delivered it reports that no more input follows.
+// It does not implement domain.Confirmer, so the agent never waits for a yes/no answer.
+type PromptMessageProvider struct {
+	prompt string
+	sent   bool
+}
+
+// NewPromptMessageProvider creates a PromptMessageProvider for the given prompt.
+func NewPromptMessageProvider(prompt string) *PromptMessageProvider {
+	return &PromptMessageProvider{prompt: prompt}
+}
+
+// GetUserMessage returns the prompt on the first call and false on every later call.
+func (p *PromptMessageProvider) GetUserMessage() (string, bool) {
+	if p.sent {
+		return "", false
+	}
+	p.sent = true
+	return p.prompt, true
+}
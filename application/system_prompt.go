@@ -0,0 +1,123 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"code-ai-editor/domain"
+)
+
+// basePrompt tells the model what it is and how it should work.
+const basePrompt = `You are an AI code editor working in a terminal chat with a software developer.
+You help the developer understand and change the code in their workspace by using the tools available to you.
+
+Guidelines:
+- You can only access files inside the workspace directory. Always use paths relative to the workspace root.
+- Read a file before editing it, and make edits with exact, unique 'old_str' matches.
+- Prefer small, focused changes that follow the existing conventions of the project.
+- When you are unsure what the developer wants, ask instead of guessing.
+- Keep answers concise; show code only when it helps.`
+
+// ProjectInstructionFiles lists the files, relative to the workspace root, whose contents are
+// added to the system prompt as project-specific instructions.
+var ProjectInstructionFiles = []string{
+	"AGENTS.md",
+	"CLAUDE.md",
+	filepath.Join(".editor", "instructions.md"),
+}
+
+// maxInstructionFileSize limits how much of each instruction file is included in the prompt.
+const maxInstructionFileSize = 20 * 1024
+
+// BuildSystemPrompt assembles the system prompt from three parts: the built-in base prompt,
+// facts about the environment (workspace roots, OS, Go version, git branch and date),
+// and the project instruction files found in the default workspace root, which comes first in roots.
+func BuildSystemPrompt(roots []domain.WorkspaceRoot) string {
+	workspaceDir := roots[0].Dir
+
+	var prompt strings.Builder
+	prompt.WriteString(basePrompt)
+
+	prompt.WriteString("\n\n# Environment\n")
+	for _, fact := range environmentFacts(workspaceDir, roots[1:]) {
+		fmt.Fprintf(&prompt, "- %s\n", fact)
+	}
+
+	for _, name := range ProjectInstructionFiles {
+		content, err := readInstructionFile(filepath.Join(workspaceDir, name))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Warning: Failed to read project instructions %s: %v\n", name, err)
+			}
+			continue
+		}
+		log.Printf("Loaded project instructions from %s\n", name)
+		fmt.Fprintf(&prompt, "\n# Project instructions (%s)\n\n%s\n", filepath.ToSlash(name), content)
+	}
+
+	return prompt.String()
+}
+
+// environmentFacts returns the environment facts included in the system prompt.
+// Facts that cannot be determined are left out.
+func environmentFacts(workspaceDir string, namedRoots []domain.WorkspaceRoot) []string {
+	facts := []string{}
+
+	if absWorkspace, err := filepath.Abs(workspaceDir); err == nil {
+		facts = append(facts, "Workspace root: "+absWorkspace)
+	}
+	for _, root := range namedRoots {
+		if absDir, err := filepath.Abs(root.Dir); err == nil {
+			facts = append(facts, fmt.Sprintf("Workspace root '%s' (address its files as '%s:path'): %s", root.Name, root.Name, absDir))
+		}
+	}
+	facts = append(facts, fmt.Sprintf("Operating system: %s/%s", runtime.GOOS, runtime.GOARCH))
+
+	if goVersion := commandOutput(workspaceDir, "go", "env", "GOVERSION"); goVersion != "" {
+		facts = append(facts, "Go version: "+goVersion)
+	} else {
+		facts = append(facts, "Go version: "+runtime.Version()+" (editor build)")
+	}
+
+	if branch := commandOutput(workspaceDir, "git", "rev-parse", "--abbrev-ref", "HEAD"); branch != "" {
+		facts = append(facts, "Git branch: "+branch)
+	}
+
+	facts = append(facts, "Date: "+time.Now().Format("2006-01-02"))
+	return facts
+}
+
+// commandOutput runs a short command in dir and returns its trimmed output,
+// or "" if the command is unavailable or fails.
+func commandOutput(dir, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// readInstructionFile reads an instruction file, truncating overly large files.
+func readInstructionFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(data))
+	if len(content) > maxInstructionFileSize {
+		content = content[:maxInstructionFileSize] + "\n... [truncated]"
+	}
+	return content, nil
+}
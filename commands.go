@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"code-ai-editor/application"
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure"
+	"code-ai-editor/infrastructure/config"
+	"code-ai-editor/infrastructure/render"
+	infra_session "code-ai-editor/infrastructure/session"
+	"code-ai-editor/infrastructure/terminal"
+)
+
+// runChat starts an interactive chat session, optionally resuming a previous one.
+func runChat(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	var opts agentOptions
+	opts.register(fs)
+	resumeID := fs.String("resume", "", "Resume the chat session with the given ID")
+	continueLatest := fs.Bool("continue", false, "Resume the most recent chat session")
+	fullScreen := fs.Bool("tui", false, "Full-screen interface with panes for the conversation, tool calls and diffs")
+	review := fs.Bool("review", true, "Show the diff of each file change and ask before applying it (use -review=false to apply changes without asking)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := opts.load(fs)
+	if err != nil {
+		return err
+	}
+	deps.config = cfg
+
+	var (
+		provider domain.UserMessageProvider
+		events   domain.EventSink
+		approver domain.ToolApprover
+		tui      *terminal.TUI
+	)
+	if *fullScreen {
+		tui = terminal.NewTUI()
+		provider, events, approver = tui, tui, tui
+	} else {
+		workspace, err := deps.Workspace()
+		if err != nil {
+			return err
+		}
+		editor := terminal.NewLineEditor(terminal.Options{
+			HistoryFile: terminal.DefaultHistoryFile(),
+			Complete:    terminal.PathCompleter(workspace),
+		})
+		provider = application.CreateConsoleUserMessageProvider(editor)
+		if events, err = newEventSink(cfg, os.Stdout); err != nil {
+			return err
+		}
+		approver = terminal.NewConsoleApprover(editor, colored(cfg, os.Stdout))
+	}
+	agent, err := deps.NewAgent(provider, events)
+	if err != nil {
+		return err
+	}
+	if *review {
+		agent.Approver = approver
+	}
+
+	// Start a new session or resume a previous one
+	sessionStore, err := deps.SessionStore()
+	if err != nil {
+		return err
+	}
+	session, history, err := openSession(sessionStore, *resumeID, *continueLatest)
+	if err != nil {
+		return fmt.Errorf("error opening session: %w", err)
+	}
+	defer session.Close()
+	agent.Conversation = history
+	agent.Session = session
+
+	chatbotService := application.NewChatbotService(agent)
+
+	// Ctrl+C cancels the turn in progress through its context, like Esc in the full-screen mode.
+	// Without a turn in progress, and on SIGTERM, it ends the chat
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	var interrupted atomic.Bool
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				if sig == os.Interrupt && agent.TurnInProgress() {
+					agent.CancelTurn()
+					continue
+				}
+				fmt.Println("\nReceived interrupt signal, shutting down...")
+				interrupted.Store(true)
+				stop()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The full-screen interface cancels turns itself
+	if tui != nil {
+		if err := tui.Start(agent.CancelTurn); err != nil {
+			return err
+		}
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- chatbotService.StartChatbot(ctx)
+	}()
+
+	select {
+	case err := <-errChan:
+		if tui != nil {
+			tui.Close()
+		}
+		if errors.Is(err, domain.ErrBudgetExceeded) {
+			fmt.Println()
+			fmt.Print(agent.Usage.Report())
+			fmt.Printf("Session saved. Resume it with: chat -resume %s\n", session.ID())
+			return withExitCode(exitBudgetExceeded, err)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	case <-ctx.Done():
+		// A turn in progress is cancelled with ctx; give the agent a moment to record how it ended.
+		// It may be blocked reading input, so it is not waited for any longer
+		select {
+		case <-errChan:
+		case <-time.After(time.Second):
+		}
+	}
+	if tui != nil {
+		tui.Close()
+	}
+
+	fmt.Println()
+	fmt.Print(agent.Usage.Report())
+	fmt.Printf("Session saved. Resume it with: chat -resume %s\n", session.ID())
+	fmt.Println("Goodbye!")
+	if interrupted.Load() {
+		return withExitCode(exitInterrupted, errors.New("interrupted"))
+	}
+	return nil
+}
+
+// runAsk runs the agent on a single prompt until the model stops, for use from scripts.
+// The prompt is taken from the arguments, or read from stdin if there are none or the only one is "-".
+//
+// The exit status is 0 if the model gave a final answer, exitIncomplete if the turn stopped early
+// (e.g. a request failed or a loop limit was hit), and exitBudgetExceeded if the budget ran out.
+func runAsk(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	var opts agentOptions
+	opts.register(fs)
+	output := fs.String("output", "text", "Output format: 'text' streams the agent's output, 'json' prints a single JSON document with the answer, tool calls, files changed and usage")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != "text" && *output != "json" {
+		return withExitCode(exitUsage, fmt.Errorf("invalid -output %q (expected 'text' or 'json')", *output))
+	}
+	cfg, err := opts.load(fs)
+	if err != nil {
+		return err
+	}
+	deps.config = cfg
+
+	prompt := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 || prompt == "-" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(input)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		fs.Usage()
+		return withExitCode(exitUsage, errors.New("no prompt given"))
+	}
+
+	// In JSON mode, stdout carries only the result document; progress output goes to stderr
+	progress := os.Stdout
+	if *output == "json" {
+		progress = os.Stderr
+	}
+
+	events, err := newEventSink(cfg, progress)
+	if err != nil {
+		return err
+	}
+
+	// The ask service supplies the prompt as the only user message
+	agent, err := deps.NewAgent(nil, events)
+	if err != nil {
+		return err
+	}
+	result, runErr := application.NewAskService(agent).Ask(ctx, prompt)
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	switch result.Status {
+	case application.AskStatusBudgetExceeded:
+		return withExitCode(exitBudgetExceeded, runErr)
+	case application.AskStatusError:
+		return runErr
+	case application.AskStatusIncomplete:
+		return withExitCode(exitIncomplete, errors.New("the agent stopped before giving a final answer"))
+	}
+	return nil
+}
+
+// runIndex indexes every workspace root into its own collection of the vector store,
+// or only the root or directory given with -only or -dir.
+func runIndex(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	var opts configOptions
+	opts.register(fs)
+	dir := fs.String("dir", "", "Index this directory into the collection of the default root instead of the workspace roots")
+	only := fs.String("only", "", "Index only the named workspace root ('.' for the default root)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := opts.load(fs)
+	if err != nil {
+		return err
+	}
+	if *dir != "" {
+		cfg.Workspace, cfg.Roots = *dir, nil
+	}
+	deps.config = cfg
+
+	embeddingClient, err := deps.EmbeddingClient()
+	if err != nil {
+		return fmt.Errorf("cannot perform indexing without a valid embedding client: %w", err)
+	}
+	roots, err := deps.IndexRoots(embeddingClient)
+	if err != nil {
+		return err
+	}
+
+	indexed := 0
+	for _, root := range roots {
+		if *only != "" && *only != root.Root.Name && (*only != "." || root.Root.Name != "") {
+			continue
+		}
+
+		// Ensure the default root exists; a missing named root is more likely a typo
+		if _, err := os.Stat(root.Root.Dir); os.IsNotExist(err) && root.Root.Name == "" {
+			log.Printf("Workspace directory does not exist, creating: %s\n", root.Root.Dir)
+			if err := os.MkdirAll(root.Root.Dir, 0755); err != nil {
+				return fmt.Errorf("failed to create workspace directory: %w", err)
+			}
+		}
+
+		log.Printf("Starting indexing for directory: %s (collection %s)\n", root.Root.Dir, cfg.Collection(root.Root.Name))
+		if err := root.Indexer.IndexDirectory(ctx, root.Root.Dir); err != nil {
+			return fmt.Errorf("error during indexing of %s: %w", root.Root.Dir, err)
+		}
+		indexed++
+	}
+	if indexed == 0 {
+		return withExitCode(exitUsage, fmt.Errorf("unknown workspace root '%s'", *only))
+	}
+	log.Println("Indexing complete.")
+	return nil
+}
+
+// runSearch prints the indexed snippets most similar to the query.
+func runSearch(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	var opts configOptions
+	opts.register(fs)
+	topK := fs.Int("k", 5, "Number of snippets to show")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := opts.load(fs)
+	if err != nil {
+		return err
+	}
+	deps.config = cfg
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		fs.Usage()
+		return withExitCode(exitUsage, errors.New("no query given"))
+	}
+
+	embeddingClient, err := deps.EmbeddingClient()
+	if err != nil {
+		return err
+	}
+	vectorStore, err := deps.VectorStore()
+	if err != nil {
+		return err
+	}
+
+	embeddings, err := embeddingClient.GenerateEmbeddings(ctx, []string{query})
+	if err != nil {
+		return fmt.Errorf("failed to generate embedding for query: %w", err)
+	}
+	if len(embeddings) == 0 {
+		return errors.New("no embedding returned for query")
+	}
+	snippets, err := vectorStore.Query(ctx, embeddings[0], *topK)
+	if err != nil {
+		return fmt.Errorf("failed to query vector store: %w", err)
+	}
+	if len(snippets) == 0 {
+		fmt.Println("No matching snippets found. Run 'index' first?")
+		return nil
+	}
+	color := render.ColorEnabled(os.Stdout)
+	for _, s := range snippets {
+		location := fmt.Sprintf("%s:%d-%d", s.FilePath, s.StartLine, s.EndLine)
+		if color {
+			location = "\x1b[1m" + location + "\x1b[0m"
+		}
+		fmt.Printf("%s\n%s\n\n", location, s.Content)
+	}
+	return nil
+}
+
+// runTools handles "tools list", which prints the tools available to the agent.
+func runTools(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	configPath := fs.String("config", config.DefaultProjectPath, configPathUsage)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "list" {
+		fs.Usage()
+		return withExitCode(exitUsage, errors.New("expected 'tools list'"))
+	}
+	cfg, err := loadConfig(*configPath, nil)
+	if err != nil {
+		return err
+	}
+	deps.config = cfg
+	workspace, err := deps.Workspace()
+	if err != nil {
+		return err
+	}
+
+	// Listing must not require Qdrant, so the vector store tools are described separately
+	toolRepository := infrastructure.NewFileToolRepository(workspace, nil, nil, cfg.Brave)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tACCESS\tTIMEOUT\tDESCRIPTION")
+	for _, tool := range toolRepository.GetAllTools() {
+		access := "writes"
+		if tool.ReadOnly {
+			access = "read-only"
+		}
+		timeout := "default"
+		if tool.Timeout > 0 {
+			timeout = tool.Timeout.String()
+		}
+		description, _, _ := strings.Cut(tool.Description, "\n")
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", tool.Name, access, timeout, description)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("\nqdrant_search and qdrant_upsert are also available when Qdrant and OPENAI_API_KEY are configured.")
+	return nil
+}
+
+// runSessions lists the stored chat sessions.
+func runSessions(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	configPath := fs.String("config", config.DefaultProjectPath, configPathUsage)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath, nil)
+	if err != nil {
+		return err
+	}
+	deps.config = cfg
+	sessionStore, err := deps.SessionStore()
+	if err != nil {
+		return err
+	}
+	if err := printSessions(sessionStore); err != nil {
+		return fmt.Errorf("error listing sessions: %w", err)
+	}
+	return nil
+}
+
+// runConfig handles "config show", which prints the effective configuration with the API keys
+// masked, after the config files, environment and flags given have been applied.
+func runConfig(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	var opts agentOptions
+	opts.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "show" {
+		fs.Usage()
+		return withExitCode(exitUsage, errors.New("expected 'config show'"))
+	}
+
+	cfg, err := opts.load(fs)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# User config file:    %s\n", config.UserPath())
+	fmt.Printf("# Project config file: %s\n", opts.model.config)
+	fmt.Printf("# Effective settings from: %s\n%s", strings.Join(cfg.Sources, ", "), out)
+	return nil
+}
+
+// runVersion prints the version, the VCS revision the binary was built from and the Go version.
+func runVersion(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	revision := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				revision = " " + setting.Value[:12]
+			}
+		}
+	}
+	fmt.Printf("code-ai-editor %s%s (%s %s/%s)\n", version, revision, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// openSession starts a new chat session, or resumes the session with the given ID,
+// or the most recent session if continueLatest is set.
+// It returns the session together with the conversation history to resume from.
+func openSession(store *infra_session.JSONLSessionStore, resumeID string, continueLatest bool) (*infra_session.JSONLSession, []domain.Message, error) {
+	if continueLatest && resumeID == "" {
+		latestID, err := store.LatestID()
+		if err != nil {
+			return nil, nil, err
+		}
+		resumeID = latestID
+	}
+
+	if resumeID == "" {
+		session, err := store.Create()
+		if err != nil {
+			return nil, nil, err
+		}
+		return session, nil, nil
+	}
+
+	session, history, err := store.Resume(resumeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("Resuming session %s (%d messages)\n", session.ID(), len(history))
+	return session, history, nil
+}
+
+// printSessions prints the stored chat sessions, most recent first.
+func printSessions(store *infra_session.JSONLSessionStore) error {
+	sessions, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions found.")
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tDATE\tTURNS\tTITLE")
+	for _, s := range sessions {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\n", s.ID, s.UpdatedAt.Local().Format("2006-01-02 15:04"), s.Turns, s.Title)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code-ai-editor/application"
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure"
+	"code-ai-editor/infrastructure/config"
+	infra_embedding "code-ai-editor/infrastructure/embedding"
+	infra_session "code-ai-editor/infrastructure/session"
+	infra_vectorstore "code-ai-editor/infrastructure/vectorstore"
+)
+
+// dependencies creates the services shared by the subcommands on first use, so that
+// a command only connects to what it needs, e.g. listing sessions never dials Qdrant.
+// Commands set config before asking for any service.
+type dependencies struct {
+	config          config.Config
+	vectorStore     domain.VectorStore
+	rootStores      map[string]domain.VectorStore // Vector store of each workspace root, by name
+	embeddingClient domain.EmbeddingClient
+	sessionStore    *infra_session.JSONLSessionStore
+}
+
+// VectorStore returns the vector store searching the collections of all workspace roots,
+// connecting to Qdrant on first use.
+func (d *dependencies) VectorStore() (domain.VectorStore, error) {
+	if d.vectorStore == nil {
+		roots := d.config.WorkspaceRoots()
+		if len(roots) == 1 {
+			vectorStore, err := d.RootVectorStore(roots[0])
+			if err != nil {
+				return nil, err
+			}
+			d.vectorStore = vectorStore
+			return d.vectorStore, nil
+		}
+
+		stores := make(map[string]domain.VectorStore, len(roots))
+		for _, root := range roots {
+			vectorStore, err := d.RootVectorStore(root)
+			if err != nil {
+				return nil, err
+			}
+			stores[root.Name] = vectorStore
+		}
+		vectorStore, err := infra_vectorstore.NewMultiRootStore(stores)
+		if err != nil {
+			return nil, err
+		}
+		d.vectorStore = vectorStore
+	}
+	return d.vectorStore, nil
+}
+
+// RootVectorStore returns the vector store of the collection indexing a single workspace root,
+// connecting to Qdrant on first use.
+func (d *dependencies) RootVectorStore(root domain.WorkspaceRoot) (domain.VectorStore, error) {
+	if vectorStore, ok := d.rootStores[root.Name]; ok {
+		return vectorStore, nil
+	}
+	settings := d.config.Qdrant
+	settings.Collection = d.config.Collection(root.Name)
+	vectorStore, err := infra_vectorstore.NewQdrantClient(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Qdrant client: %w", err)
+	}
+	if d.rootStores == nil {
+		d.rootStores = make(map[string]domain.VectorStore)
+	}
+	d.rootStores[root.Name] = vectorStore
+	return vectorStore, nil
+}
+
+// IndexRoots returns the workspace roots together with indexers that embed their files with
+// embeddingClient into the collections of the roots.
+func (d *dependencies) IndexRoots(embeddingClient domain.EmbeddingClient) ([]application.IndexRoot, error) {
+	var roots []application.IndexRoot
+	var excluded []string
+	if sessionsDir, err := filepath.Abs(d.config.Sessions.Dir); err == nil {
+		excluded = append(excluded, sessionsDir)
+	}
+	for _, root := range d.config.WorkspaceRoots() {
+		vectorStore, err := d.RootVectorStore(root)
+		if err != nil {
+			return nil, err
+		}
+		indexer := application.NewIndexingService(domain.NewGoCodeParser(), embeddingClient, vectorStore, d.config.Indexing.BatchSize, excluded)
+		roots = append(roots, application.IndexRoot{Root: root, Indexer: indexer})
+	}
+	return roots, nil
+}
+
+// Workspace returns the workspace the file tools work in.
+func (d *dependencies) Workspace() (*infrastructure.Workspace, error) {
+	workspace, err := infrastructure.NewWorkspace(d.config.WorkspaceRoots())
+	if err != nil {
+		return nil, fmt.Errorf("error initializing workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// EmbeddingClient returns the OpenAI embedding client, creating it on first use.
+func (d *dependencies) EmbeddingClient() (domain.EmbeddingClient, error) {
+	if d.embeddingClient == nil {
+		embeddingClient, err := infra_embedding.NewOpenAIEmbeddingClient(d.config.OpenAI)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing OpenAI embedding client (OpenAI API key missing?): %w", err)
+		}
+		d.embeddingClient = embeddingClient
+	}
+	return d.embeddingClient, nil
+}
+
+// OptionalEmbeddingClient returns the embedding client, or nil with a warning if neither an OpenAI API
+// key nor an OpenAI-compatible base URL is configured, in which case context retrieval via embeddings
+// is disabled. With a base URL, queries are embedded by that server and never sent to the OpenAI API.
+func (d *dependencies) OptionalEmbeddingClient() (domain.EmbeddingClient, error) {
+	if d.config.OpenAI.APIKey == "" && d.config.OpenAI.BaseURL == "" {
+		log.Println("Warning: neither OPENAI_API_KEY nor OPENAI_BASE_URL set. Context retrieval via embeddings will be disabled.")
+		return nil, nil
+	}
+	return d.EmbeddingClient()
+}
+
+// SessionStore returns the chat session store, creating it on first use.
+func (d *dependencies) SessionStore() (*infra_session.JSONLSessionStore, error) {
+	if d.sessionStore == nil {
+		sessionStore, err := infra_session.NewJSONLSessionStore(d.config.Sessions)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing session store: %w", err)
+		}
+		d.sessionStore = sessionStore
+	}
+	return d.sessionStore, nil
+}
+
+// NewAgent creates an agent configured from the configuration, reading user messages from
+// provider and reporting its output and status to events.
+func (d *dependencies) NewAgent(provider domain.UserMessageProvider, events domain.EventSink) (*domain.Agent, error) {
+	embeddingClient, err := d.OptionalEmbeddingClient()
+	if err != nil {
+		return nil, err
+	}
+	// Qdrant is only connected to when retrieval is enabled, i.e. with an embedding client.
+	// Retrieval is optional, so an unreachable Qdrant disables it rather than failing: with the
+	// openai provider, the OpenAI API key needed for chat and ask also enables retrieval
+	var vectorStore domain.VectorStore
+	if embeddingClient != nil {
+		if vectorStore, err = d.VectorStore(); err != nil {
+			log.Printf("Warning: %v. Context retrieval will be disabled.\n", err)
+			embeddingClient = nil
+		}
+	}
+
+	baseClient, err := newAIClient(d.config)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing AI client: %w", err)
+	}
+	retryPolicy := infrastructure.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = d.config.Agent.MaxAttempts
+	aiClient := infrastructure.NewRetryingAIClient(baseClient, retryPolicy)
+	aiClient.SetEventSink(events)
+
+	workspace, err := d.Workspace()
+	if err != nil {
+		return nil, err
+	}
+	toolRepository := infrastructure.NewFileToolRepository(workspace, vectorStore, embeddingClient, d.config.Brave)
+	toolRepository.SetTimeouts(d.config.Tools.Timeout, d.config.Tools.Timeouts)
+
+	agent := domain.NewAgent(aiClient, provider, toolRepository, vectorStore, embeddingClient)
+	agent.Events = events
+	agent.Streaming = d.config.Output.Stream
+	agent.ShowThinking = d.config.Output.ShowThinking
+	agent.ModelSettings = d.config.Model
+	agent.Retrieval = d.config.Retrieval
+	agent.SystemPrompt = application.BuildSystemPrompt(d.config.WorkspaceRoots())
+	agent.CompactThreshold = d.config.Agent.CompactThreshold
+	agent.MaxStepsPerTurn = d.config.Agent.MaxSteps
+	agent.MaxRepeatedErrors = d.config.Agent.MaxRepeatedErrors
+	agent.MaxParallelTools = d.config.Agent.ParallelTools
+	agent.MaxContinuations = d.config.Agent.MaxContinuations
+
+	// Chat commands that need more than the domain provides
+	agent.Commands.Register(application.NewSaveCommand())
+	if embeddingClient != nil {
+		indexRoots, err := d.IndexRoots(embeddingClient)
+		if err != nil {
+			return nil, err
+		}
+		agent.Commands.Register(application.NewReindexCommand(indexRoots))
+	}
+
+	prices, err := loadPriceTable(d.config.Budget.PriceTable)
+	if err != nil {
+		return nil, fmt.Errorf("error loading price table: %w", err)
+	}
+	agent.Usage = domain.NewUsageTracker(prices)
+	agent.Usage.MaxCost = d.config.Budget.MaxCost
+	agent.Usage.MaxTokens = d.config.Budget.MaxTokens
+	return agent, nil
+}
+
+// newAIClient creates the AI client for the configured provider.
+func newAIClient(cfg config.Config) (domain.AIClient, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "anthropic":
+		return infrastructure.NewAnthropicClient(cfg.Anthropic)
+	case "openai":
+		return infrastructure.NewOpenAIChatClient(cfg.OpenAI)
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q (expected 'anthropic' or 'openai')", cfg.Provider)
+	}
+}
+
+// loadPriceTable returns the built-in price table, extended or overridden by the
+// entries of the given JSON file, if any.
+func loadPriceTable(path string) (domain.PriceTable, error) {
+	prices := domain.DefaultPriceTable()
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table '%s': %w", path, err)
+	}
+	var overrides domain.PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse price table '%s': %w", path, err)
+	}
+	for model, price := range overrides {
+		prices[model] = price
+	}
+	return prices, nil
+}
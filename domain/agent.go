@@ -2,11 +2,11 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
-
-	"github.com/anthropics/anthropic-sdk-go"
+	"sync"
+	"time"
 )
 
 // UserMessageProvider is an interface that provides user messages.
@@ -17,10 +17,18 @@ type UserMessageProvider interface {
 	GetUserMessage() (string, bool)
 }
 
+// Confirmer is an optional interface of a UserMessageProvider that can ask the user
+// a yes/no question, e.g. whether the agent should keep going after hitting a loop limit.
+type Confirmer interface {
+	Confirm(question string) bool
+}
+
 // AIClient defines the interface for interacting with an AI model.
-// It provides a method to run inference on a given conversation and set of tools.
+// It provides methods to run inference on a request (system prompt, conversation, tools and
+// model settings), either returning the complete response at once or streaming it incrementally.
 type AIClient interface {
-	RunInference(ctx context.Context, conversation []anthropic.MessageParam, tools []ToolDefinition) (*anthropic.Message, error)
+	RunInference(ctx context.Context, request InferenceRequest) (*Message, error)
+	StreamInference(ctx context.Context, request InferenceRequest) (InferenceStream, error)
 }
 
 // Agent orchestrates the interaction between the user, the AI client,
@@ -29,8 +37,29 @@ type Agent struct {
 	AIClient            AIClient
 	UserMessageProvider UserMessageProvider
 	ToolRepository      ToolRepository
-	VectorStore         VectorStore     // Added for context retrieval
-	EmbeddingClient     EmbeddingClient // Added for context retrieval
+	SystemPrompt        string            // Instructions sent as the system prompt with every request
+	ModelSettings       ModelSettings     // Model and generation parameters, switchable with /model
+	VectorStore         VectorStore       // Added for context retrieval
+	EmbeddingClient     EmbeddingClient   // Added for context retrieval
+	Retrieval           RetrievalSettings // How many snippets are retrieved as context, and how much of them is injected
+	Streaming           bool              // Stream model output token-by-token as it arrives
+	ShowThinking        bool              // Show extended thinking instead of collapsing it, toggled with /thinking
+	Conversation        []Message         // Conversation history, pre-populated when resuming a session
+	Session             SessionRecorder   // Optional transcript recorder for the session
+	CompactThreshold    int               // Estimated prompt tokens that trigger automatic compaction; 0 disables it
+	Usage               *UsageTracker     // Token usage and cost accounting, including session budgets
+	MaxStepsPerTurn     int               // Inference steps per turn before asking the user to continue; 0 means unlimited
+	MaxRepeatedErrors   int               // Identical failing tool calls per turn before asking the user to continue; 0 means unlimited
+	MaxParallelTools    int               // Read-only tool calls executed concurrently; 1 runs all tools serially
+	MaxContinuations    int               // Continuations of a response cut off at max_tokens before giving up
+	Commands            *CommandRegistry  // Slash commands handled in the chat instead of being sent to the model
+	Events              EventSink         // Receives the agent's output and status for rendering; nil discards it
+	Approver            ToolApprover      // Reviews file changes before they are made; nil makes them without review
+
+	turnMu           sync.Mutex
+	cancelTurn       context.CancelFunc // Cancels the turn in progress, if any
+	approvals        approvalMemory     // Files, or the whole session, whose changes need no review
+	compactionFailed bool               // Automatic compaction failed in the current turn and is not retried
 }
 
 // NewAgent creates a new Agent with the provided dependencies.
@@ -41,13 +70,33 @@ func NewAgent(aiClient AIClient, userMessageProvider UserMessageProvider, toolRe
 		ToolRepository:      toolRepository,
 		VectorStore:         vectorStore,
 		EmbeddingClient:     embeddingClient,
+		Retrieval:           DefaultRetrievalSettings(),
+		Streaming:           true,
+		ShowThinking:        true,
+		CompactThreshold:    DefaultCompactThreshold,
+		Usage:               NewUsageTracker(DefaultPriceTable()),
+		MaxStepsPerTurn:     DefaultMaxStepsPerTurn,
+		MaxRepeatedErrors:   DefaultMaxRepeatedToolErrors,
+		MaxParallelTools:    DefaultMaxParallelTools,
+		MaxContinuations:    DefaultMaxContinuations,
+		Commands:            NewCommandRegistry(),
 	}
 }
 
-const maxContextLength = 1000 // Example: Limit context tokens/chars
+// RetrievalSettings control the code snippets injected into user messages as context.
+type RetrievalSettings struct {
+	TopK             int `yaml:"top_k"`              // Number of snippets to retrieve
+	MaxContextLength int `yaml:"max_context_length"` // Characters of snippets injected at most
+}
+
+// DefaultRetrievalSettings returns the retrieval settings used unless configured otherwise.
+func DefaultRetrievalSettings() RetrievalSettings {
+	return RetrievalSettings{TopK: 3, MaxContextLength: 1000}
+}
 
-// formatSnippets formats retrieved snippets into a string for the prompt context.
-func formatSnippets(snippets []Snippet) string {
+// formatSnippets formats retrieved snippets into a string for the prompt context,
+// omitting the snippets that would exceed maxContextLength characters.
+func formatSnippets(snippets []Snippet, maxContextLength int) string {
 	if len(snippets) == 0 {
 		return ""
 	}
@@ -70,6 +119,35 @@ func formatSnippets(snippets []Snippet) string {
 	return contextBuilder.String()
 }
 
+// retrieveContext returns the code snippets relevant to the query, formatted for injection
+// into the user message, or an empty string if retrieval is disabled or fails.
+func (a *Agent) retrieveContext(ctx context.Context, query string) string {
+	if a.VectorStore == nil || a.EmbeddingClient == nil {
+		return ""
+	}
+	// Generate embedding for user input
+	a.Notice(NoticeMuted, "Generating embedding for user query...")
+	embeddings, err := a.EmbeddingClient.GenerateEmbeddings(ctx, []string{query})
+	if err != nil {
+		a.Notice(NoticeWarning, fmt.Sprintf("Failed to generate embedding for query: %v", err))
+		// Continue without context if embedding fails
+		return ""
+	}
+	if len(embeddings) == 0 {
+		return ""
+	}
+	// Query vector store
+	a.Notice(NoticeMuted, "Querying vector store for relevant snippets...")
+	snippets, err := a.VectorStore.Query(ctx, embeddings[0], a.Retrieval.TopK)
+	if err != nil {
+		a.Notice(NoticeWarning, fmt.Sprintf("Failed to query vector store: %v", err))
+		// Continue without context if query fails
+		return ""
+	}
+	a.Notice(NoticeMuted, fmt.Sprintf("Retrieved %d snippets from vector store.", len(snippets)))
+	return formatSnippets(snippets, a.Retrieval.MaxContextLength)
+}
+
 // Run executes the agent's main loop, interacting with the user and the AI client.
 //
 // It implements the ReAct (Reasoning and Acting) pattern with these steps:
@@ -89,8 +167,6 @@ func formatSnippets(snippets []Snippet) string {
 //	An error if any step in the process fails, or nil if the agent completes
 //	successfully.
 func (a *Agent) Run(ctx context.Context) error {
-	conversation := []anthropic.MessageParam{}
-
 	for {
 		// Step 1a: Observe - Get user input
 		userInput, ok := a.UserMessageProvider.GetUserMessage()
@@ -98,71 +174,86 @@ func (a *Agent) Run(ctx context.Context) error {
 			break
 		}
 
-		// Step 1b: Context Retrieval
-		var contextCode string
-		if a.VectorStore != nil && a.EmbeddingClient != nil {
-			// Generate embedding for user input
-			log.Println("Generating embedding for user query...")
-			embeddings, err := a.EmbeddingClient.GenerateEmbeddings(ctx, []string{userInput})
-			if err != nil {
-				log.Printf("Warning: Failed to generate embedding for query: %v\n", err)
-				// Continue without context if embedding fails
-			} else if len(embeddings) > 0 {
-				// Query vector store
-				log.Println("Querying vector store for relevant snippets...")
-				const topK = 3 // Number of snippets to retrieve
-				snippets, err := a.VectorStore.Query(ctx, embeddings[0], topK)
-				if err != nil {
-					log.Printf("Warning: Failed to query vector store: %v\n", err)
-					// Continue without context if query fails
-				} else {
-					log.Printf("Retrieved %d snippets from vector store.\n", len(snippets))
-					contextCode = formatSnippets(snippets)
-				}
+		// Slash commands such as /help are handled here and never reach the model
+		if handled, err := a.runSlashCommand(ctx, userInput); handled {
+			if errors.Is(err, ErrExitChat) {
+				break
 			}
+			continue
 		}
 
+		// Refuse to start a new turn once the budget is spent
+		if err := a.Usage.CheckBudget(); err != nil {
+			return err
+		}
+		a.Usage.StartTurn()
+		a.Emit(Event{Type: EventTurnStarted, Text: userInput})
+		turnCtx := a.startTurn(ctx)
+		a.compactionFailed = false
+
+		// Step 1b: Context Retrieval
+		contextCode := a.retrieveContext(turnCtx, userInput)
+
 		// Add user message (and context if available) to conversation history
 		messageContent := userInput
 		if contextCode != "" {
 			// Prepend context to the user's message or structure it differently
 			messageContent = fmt.Sprintf("%s\n\nUser Query:\n%s", contextCode, userInput)
-			fmt.Printf("\x1b[32mInjecting Context:\n%s\x1b[0m", contextCode) // Display injected context
+			a.Emit(Event{Type: EventContextInjected, Text: contextCode}) // Display injected context
+		}
+		userMessage := NewUserMessage(NewTextBlock(messageContent))
+		a.Conversation = appendMessage(a.Conversation, userMessage)
+		if contextCode != "" {
+			a.record(SessionEntry{Type: SessionEntryContext, Text: contextCode})
 		}
-		userMessage := anthropic.NewUserMessage(anthropic.NewTextBlock(messageContent))
-		conversation = append(conversation, userMessage)
+		a.record(SessionEntry{Type: SessionEntryUser, Message: &userMessage, Text: userInput})
 
 		// Inner ReAct loop (Reason -> Act -> Observe Tool Results)
+		guard := newLoopGuard(a.MaxStepsPerTurn, a.MaxRepeatedErrors)
 		for {
+			// Keep the prompt within the model's context window
+			a.compactIfNeeded(turnCtx)
+
 			// Step 2: Reason - Let the AI infer
-			fmt.Print("\x1b[34mThinking...\x1b[0m\n")
-			message, err := a.AIClient.RunInference(ctx, conversation, a.ToolRepository.GetAllTools())
+			a.Emit(Event{Type: EventInferenceStarted})
+			message, err := a.infer(turnCtx, a.Conversation)
+			if err == nil && message.StopReason == StopReasonMaxTokens {
+				// Cut off mid-answer or mid-tool-call: continue and stitch the pieces together
+				message, err = a.continueTruncated(turnCtx, a.Conversation, message)
+			}
 			if err != nil {
-				return err
+				if ctx.Err() != nil {
+					a.endTurn()
+					return err
+				}
+				if turnCtx.Err() != nil {
+					// Cancelled by the user: the partial answer is dropped, the conversation is kept
+					a.Notice(NoticeWarning, "Turn cancelled. Send a new message to continue.")
+					break
+				}
+				// Keep the session alive: report the failure and let the user try again
+				a.Emit(Event{Type: EventError, Text: err.Error()})
+				a.Notice(NoticeWarning, "The request failed. Your conversation is kept; send a message to try again.")
+				break
 			}
-			conversation = append(conversation, message.ToParam())
+			a.Conversation = append(a.Conversation, *message)
+			a.record(SessionEntry{Type: SessionEntryAssistant, Message: message})
 
-			// Display AI's thought process (text response)
-			for _, content := range message.Content {
-				if content.Type == "text" {
-					fmt.Printf("\x1b[36mClaude: %s\x1b[0m\n", content.Text)
-				}
+			// Account for the tokens spent and stop cleanly once the budget is exceeded. Tool calls
+			// are answered without running them, so that the transcript can be resumed
+			a.trackUsage(message)
+			if err := a.Usage.CheckBudget(); err != nil {
+				a.answerUnexecuted(message.ToolUses(), "Not executed: the session budget was exceeded.")
+				a.endTurn()
+				return err
 			}
 
 			// Check if there are tool calls
-			hasToolCalls := false
-			toolResults := []anthropic.ContentBlockParamUnion{}
-
-			for _, content := range message.Content {
-				switch content.Type {
-				case "tool_use":
-					hasToolCalls = true
-					// Step 3: Act - Execute the tool
-					fmt.Printf("\x1b[33mExecuting: %s\x1b[0m\n", content.Name)
-					result := a.ToolRepository.ExecuteTool(content.ID, content.Name, content.Input)
-					toolResults = append(toolResults, result)
-				}
-			}
+			toolUses := message.ToolUses()
+			hasToolCalls := len(toolUses) > 0
+
+			// Step 3: Act - Execute the tools, read-only ones concurrently
+			toolResults := a.executeTools(turnCtx, toolUses)
 
 			// If there are no tool calls, exit internal ReAct loop (AI's thought is complete)
 			if !hasToolCalls {
@@ -170,10 +261,237 @@ func (a *Agent) Run(ctx context.Context) error {
 			}
 
 			// Step 4: Observe - Observe the tool execution result
-			fmt.Print("\x1b[32mObserving results...\x1b[0m\n")
-			conversation = append(conversation, anthropic.NewUserMessage(toolResults...))
+			a.Notice(NoticeInfo, "Observing results...")
+			toolResultMessage := NewUserMessage(toolResults...)
+			a.Conversation = append(a.Conversation, toolResultMessage)
+			a.record(SessionEntry{Type: SessionEntryToolResult, Message: &toolResultMessage})
+
+			// The results are kept so the conversation stays valid, but the model is not asked again
+			if turnCtx.Err() != nil {
+				a.Notice(NoticeWarning, "Turn cancelled. Send a new message to continue.")
+				break
+			}
+
+			// Guard against runaway loops before reasoning again
+			guard.Observe(toolUses, toolResults)
+			if reason := guard.Check(); reason != "" {
+				if !a.confirmContinue(reason) {
+					a.Notice(NoticeWarning, "Stopped this turn. Send a new message to give the agent further directions.")
+					break
+				}
+				guard.Reset()
+			}
+		}
+		a.endTurn()
+		a.Emit(Event{Type: EventTurnFinished})
+
+		// Stop once the chat is over, rather than waiting for the next message
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 	}
 
 	return nil
 }
+
+// CancelTurn cancels the turn in progress, if any: a pending inference or tool call is
+// interrupted and the agent waits for the next user message. It is safe to call from
+// another goroutine, e.g. the one reading keyboard input.
+func (a *Agent) CancelTurn() {
+	a.turnMu.Lock()
+	defer a.turnMu.Unlock()
+	if a.cancelTurn != nil {
+		a.cancelTurn()
+	}
+}
+
+// TurnInProgress reports whether a turn is running, i.e. whether CancelTurn has anything to cancel.
+func (a *Agent) TurnInProgress() bool {
+	a.turnMu.Lock()
+	defer a.turnMu.Unlock()
+	return a.cancelTurn != nil
+}
+
+// startTurn returns the context of a new turn, cancelled by CancelTurn or when ctx is done.
+func (a *Agent) startTurn(ctx context.Context) context.Context {
+	turnCtx, cancel := context.WithCancel(ctx)
+	a.turnMu.Lock()
+	a.cancelTurn = cancel
+	a.turnMu.Unlock()
+	return turnCtx
+}
+
+// endTurn releases the context of the finished turn.
+func (a *Agent) endTurn() {
+	a.turnMu.Lock()
+	defer a.turnMu.Unlock()
+	if a.cancelTurn != nil {
+		a.cancelTurn()
+		a.cancelTurn = nil
+	}
+}
+
+// answerUnexecuted appends error results for tool calls that will not be executed, with the given reason.
+func (a *Agent) answerUnexecuted(toolUses []ContentBlock, reason string) {
+	if len(toolUses) == 0 {
+		return
+	}
+	results := make([]ContentBlock, len(toolUses))
+	for i, toolUse := range toolUses {
+		results[i] = NewToolResultBlock(toolUse.ID, reason, true)
+	}
+	message := NewUserMessage(results...)
+	a.Conversation = append(a.Conversation, message)
+	a.record(SessionEntry{Type: SessionEntryToolResult, Message: &message})
+}
+
+// confirmContinue explains why the agent paused and asks the user whether to keep going.
+// If the user message provider cannot ask questions, the agent does not continue.
+func (a *Agent) confirmContinue(reason string) bool {
+	a.Notice(NoticeWarning, reason)
+	confirmer, ok := a.UserMessageProvider.(Confirmer)
+	if !ok {
+		return false
+	}
+	return confirmer.Confirm("Continue anyway?")
+}
+
+// appendMessage appends a message to the conversation, merging it into the last message
+// if both have the same role, e.g. a new user turn following tool results of a stopped turn.
+func appendMessage(conversation []Message, message Message) []Message {
+	if n := len(conversation); n > 0 && conversation[n-1].Role == message.Role {
+		last := conversation[n-1]
+		last.Content = append(append([]ContentBlock{}, last.Content...), message.Content...)
+		return append(conversation[:n-1:n-1], last)
+	}
+	return append(conversation, message)
+}
+
+// trackUsage adds the token usage reported on an assistant message to the usage tracker.
+func (a *Agent) trackUsage(message *Message) {
+	if message.Usage != nil {
+		a.Usage.Add(message.Model, *message.Usage)
+	}
+}
+
+// record appends an entry to the session transcript, if one is attached.
+// Failing to persist the transcript is reported but does not interrupt the chat.
+func (a *Agent) record(entry SessionEntry) {
+	if a.Session == nil {
+		return
+	}
+	entry.Time = time.Now()
+	if err := a.Session.Record(entry); err != nil {
+		a.Notice(NoticeWarning, fmt.Sprintf("Failed to record session entry: %v", err))
+	}
+}
+
+// inferenceRequest builds the request for the next assistant message of the conversation.
+func (a *Agent) inferenceRequest(conversation []Message) InferenceRequest {
+	return InferenceRequest{
+		System:       a.SystemPrompt,
+		Conversation: conversation,
+		Tools:        a.ToolRepository.GetAllTools(),
+		Settings:     a.ModelSettings,
+	}
+}
+
+// modelName returns the configured model name, or a note that the provider default is used.
+func (a *Agent) modelName() string {
+	if a.ModelSettings.Model == "" {
+		return "(provider default)"
+	}
+	return a.ModelSettings.Model
+}
+
+// infer generates the next assistant message, streaming it if enabled.
+func (a *Agent) infer(ctx context.Context, conversation []Message) (*Message, error) {
+	if a.Streaming {
+		return a.streamInference(ctx, conversation)
+	}
+	return a.runInference(ctx, conversation)
+}
+
+// runInference requests a complete response from the AI client and emits its text once it has arrived.
+func (a *Agent) runInference(ctx context.Context, conversation []Message) (*Message, error) {
+	message, err := a.AIClient.RunInference(ctx, a.inferenceRequest(conversation))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, content := range message.Content {
+		switch content.Type {
+		case ContentBlockThinking:
+			if a.ShowThinking {
+				a.Emit(Event{Type: EventThinkingDelta, Text: content.Thinking})
+				a.Emit(Event{Type: EventBlockFinished})
+			} else {
+				a.noticeCollapsedThinking(len(content.Thinking))
+			}
+		case ContentBlockRedactedThinking:
+			a.Notice(NoticeMuted, "[redacted thinking]")
+		case ContentBlockText:
+			// Display AI's thought process (text response)
+			a.Emit(Event{Type: EventTextDelta, Text: content.Text})
+			a.Emit(Event{Type: EventBlockFinished})
+		}
+	}
+	return message, nil
+}
+
+// noticeCollapsedThinking reports a one-line placeholder for a thinking block that is not shown.
+func (a *Agent) noticeCollapsedThinking(chars int) {
+	a.Notice(NoticeMuted, fmt.Sprintf("[thinking: %d characters hidden, type /thinking to show]", chars))
+}
+
+// streamInference streams a response from the AI client, emitting text deltas as they arrive
+// and assembling tool_use input JSON from its partial deltas into a complete assistant message.
+func (a *Agent) streamInference(ctx context.Context, conversation []Message) (*Message, error) {
+	stream, err := a.AIClient.StreamInference(ctx, a.inferenceRequest(conversation))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var accumulator streamAccumulator
+	inBlock := false
+	thinkingChars := 0
+	for stream.Next() {
+		event := stream.Current()
+		accumulator.Add(event)
+
+		switch event.Type {
+		case StreamEventContentBlockStart:
+			if event.BlockType == string(ContentBlockRedactedThinking) {
+				a.Notice(NoticeMuted, "[redacted thinking]")
+			}
+		case StreamEventThinkingDelta:
+			thinkingChars += len(event.Thinking)
+			if a.ShowThinking {
+				a.Emit(Event{Type: EventThinkingDelta, Text: event.Thinking})
+				inBlock = true
+			}
+		case StreamEventTextDelta:
+			a.Emit(Event{Type: EventTextDelta, Text: event.Text})
+			inBlock = true
+		case StreamEventContentBlockStop:
+			if inBlock {
+				a.Emit(Event{Type: EventBlockFinished})
+				inBlock = false
+			}
+			if thinkingChars > 0 && !a.ShowThinking {
+				a.noticeCollapsedThinking(thinkingChars)
+			}
+			thinkingChars = 0
+		}
+	}
+	if inBlock {
+		a.Emit(Event{Type: EventBlockFinished})
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	message := accumulator.Message()
+	return &message, nil
+}
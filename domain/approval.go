@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// FileChange is the effect a file-editing tool call would have, computed before the call runs
+// so that it can be shown to the user for review.
+type FileChange struct {
+	Path   string // Path as given by the model
+	Before string // Current content; empty for a new file
+	After  string // Content once the call has run
+	Create bool   // The file does not exist yet
+}
+
+// Diff returns the change as a unified diff.
+func (c FileChange) Diff() string {
+	return UnifiedDiff(c.Path, c.Before, c.After, c.Create)
+}
+
+// ApprovalRequest asks the user to review a file change before the tool call making it runs.
+type ApprovalRequest struct {
+	ToolUse ContentBlock
+	Change  FileChange
+	Diff    string
+}
+
+// ApprovalScope says which changes an approval covers besides the one it was given for.
+type ApprovalScope int
+
+const (
+	ApproveOnce    ApprovalScope = iota // Only this change
+	ApproveFile                         // All later changes to the same file, for the rest of the session
+	ApproveSession                      // All later changes, for the rest of the session
+)
+
+// ApprovalDecision is the user's answer to an ApprovalRequest.
+type ApprovalDecision struct {
+	Approved bool
+	Reason   string        // Optional explanation of a rejection, passed on to the model
+	Scope    ApprovalScope // Later changes that are approved without review
+	Edited   bool          // The user edited the change; Content replaces the proposed file content
+	Content  string
+}
+
+// ToolApprover reviews the file changes of tool calls before they run. Approve blocks until
+// the user has decided, and rejects the change if ctx is cancelled first.
+type ToolApprover interface {
+	Approve(ctx context.Context, request ApprovalRequest) ApprovalDecision
+}
+
+// previewTool returns the file change a tool call would make, if the tool supports previews.
+// A preview that fails, e.g. because the text to replace does not exist, is not an error here:
+// the tool call itself will fail with the same problem and report it to the model.
+func (a *Agent) previewTool(toolUse ContentBlock) (FileChange, bool) {
+	tool, found := a.ToolRepository.FindToolByName(toolUse.Name)
+	if !found || tool.Preview == nil {
+		return FileChange{}, false
+	}
+	change, err := tool.Preview(toolUse.Input)
+	if err != nil {
+		return FileChange{}, false
+	}
+	return change, true
+}
+
+// approvalMemory remembers the files, or the whole session, whose changes the user always allows.
+type approvalMemory struct {
+	mu    sync.Mutex
+	all   bool
+	files map[string]bool
+}
+
+// allows reports whether changes to the file need no review.
+func (m *approvalMemory) allows(file string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.all || m.files[path.Clean(file)]
+}
+
+// remember records the scope of an approval given for a change to the file.
+func (m *approvalMemory) remember(file string, scope ApprovalScope) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch scope {
+	case ApproveFile:
+		if m.files == nil {
+			m.files = make(map[string]bool)
+		}
+		m.files[path.Clean(file)] = true
+	case ApproveSession:
+		m.all = true
+	}
+}
+
+// approve asks the Approver to review a file change, unless the user already allowed all changes
+// to the file or the session, and remembers how far an approval extends.
+func (a *Agent) approve(ctx context.Context, request ApprovalRequest) ApprovalDecision {
+	if a.approvals.allows(request.Change.Path) {
+		a.Notice(NoticeMuted, fmt.Sprintf("Changing %s without review, as you allowed.", request.Change.Path))
+		return ApprovalDecision{Approved: true}
+	}
+	decision := a.Approver.Approve(ctx, request)
+	if decision.Approved {
+		a.approvals.remember(request.Change.Path, decision.Scope)
+	}
+	return decision
+}
+
+// reviseTool returns the input of a tool call rewritten to make the change the user edited.
+func (a *Agent) reviseTool(toolUse ContentBlock, content string) (ContentBlock, error) {
+	tool, found := a.ToolRepository.FindToolByName(toolUse.Name)
+	if !found || tool.Revise == nil {
+		return ContentBlock{}, fmt.Errorf("tool '%s' cannot make edited changes", toolUse.Name)
+	}
+	input, err := tool.Revise(toolUse.Input, content)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+	toolUse.Input = input
+	return toolUse, nil
+}
+
+// editedResult adds the user's edits to the result of a tool call that made an edited change,
+// so that the model does not assume the file holds what it proposed.
+func editedResult(result ContentBlock, change FileChange, content string) ContentBlock {
+	if result.IsError {
+		return result
+	}
+	edits := UnifiedDiff(change.Path, change.After, content, false)
+	result.Content = fmt.Sprintf("%s\n\nThe user edited your change before it was applied. Their edits to your version:\n%s", result.Content, edits)
+	return result
+}
+
+// rejectionResult returns the tool result telling the model that the user rejected its change.
+func rejectionResult(toolUse ContentBlock, decision ApprovalDecision) ContentBlock {
+	content := "The user rejected this change; the file was not modified."
+	if decision.Reason != "" {
+		content = fmt.Sprintf("%s Reason: %s", content, decision.Reason)
+	}
+	return NewToolResultBlock(toolUse.ID, content, true)
+}
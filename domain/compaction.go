@@ -0,0 +1,265 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultCompactThreshold is the estimated prompt size, in tokens, above which the
+	// conversation is compacted automatically. It leaves headroom below a 200k context window.
+	DefaultCompactThreshold = 150000
+
+	// compactKeepTurns is the number of most recent user turns kept verbatim when compacting.
+	compactKeepTurns = 2
+
+	// compactKeepSteps is the number of most recent steps of the current turn kept verbatim
+	// when the turn itself is long enough to be compacted.
+	compactKeepSteps = 2
+
+	// charsPerToken is the rough ratio used to estimate token counts from text length.
+	charsPerToken = 4
+
+	// imageTokens is the rough token cost assumed for a single image block.
+	imageTokens = 1600
+
+	// maxSummarizedToolResult limits how much of each tool result is shown to the summarizer.
+	maxSummarizedToolResult = 2000
+)
+
+// compactionPrompt instructs the model how to summarize the older part of a conversation.
+const compactionPrompt = `You are compacting the history of a coding session between a user and an AI code editor so it fits into the context window.
+Summarize the transcript below. Keep everything needed to continue the work: the user's goals and requirements, decisions made,
+files created or modified and how, important findings from tool results, errors encountered, and open tasks.
+Be concise and factual. Do not include file contents verbatim; they are preserved separately.
+
+Transcript:
+`
+
+// EstimateTokens returns a rough estimate of the number of tokens the messages occupy in a prompt.
+func EstimateTokens(messages []Message) int {
+	chars := 0
+	images := 0
+	for _, message := range messages {
+		for _, block := range message.Content {
+			switch block.Type {
+			case ContentBlockImage:
+				images++
+			default:
+				chars += len(block.Text) + len(block.Input) + len(block.Content) + len(block.Thinking) + len(block.Data)
+			}
+		}
+	}
+	return chars/charsPerToken + images*imageTokens
+}
+
+// compactIfNeeded compacts the conversation when its estimated size exceeds the threshold.
+// Compaction failures are reported but not fatal: the request is still attempted with the full
+// history. A failed compaction is not retried before the next turn, as it would most likely fail again.
+func (a *Agent) compactIfNeeded(ctx context.Context) {
+	if a.compactionFailed || a.CompactThreshold <= 0 || EstimateTokens(a.Conversation) <= a.CompactThreshold {
+		return
+	}
+	a.Notice(NoticeInfo, "Conversation is nearing the context limit, compacting...")
+	if err := a.Compact(ctx); err != nil {
+		a.compactionFailed = true
+		a.Emit(Event{Type: EventError, Text: fmt.Sprintf("Compaction failed: %v", err)})
+	}
+}
+
+// Compact replaces the older part of the conversation with a summary generated by the AI client.
+//
+// The most recent turns are kept as they are. If the current turn has taken more steps than
+// are kept, the user message starting it and its most recent steps are kept instead, and its
+// older steps are summarized with the earlier turns. The latest contents of files read in the
+// summarized part, unless they were modified afterwards, are preserved verbatim alongside the
+// summary so the model does not need to read them again.
+func (a *Agent) Compact(ctx context.Context) error {
+	turn, split := compactionSplit(a.Conversation)
+	if split <= 0 {
+		return fmt.Errorf("nothing to compact: the conversation has %d turns or fewer and the current turn %d steps or fewer", compactKeepTurns, compactKeepSteps)
+	}
+	before := EstimateTokens(a.Conversation)
+
+	// The first kept message starts a turn, but after a stopped turn it also carries the results of
+	// the tool calls made at the end of the previous one. Those calls are summarized away, and the
+	// API rejects tool_result blocks without their tool_use, so the results are summarized with them
+	kept, orphaned := splitToolResults(a.Conversation[turn].Content)
+	summarized := append([]Message{}, a.Conversation[:turn]...)
+	if len(orphaned) > 0 {
+		summarized = append(summarized, NewUserMessage(orphaned...))
+	}
+	recent := a.Conversation[turn+1:]
+	if split > turn {
+		summarized = append(summarized, a.Conversation[turn+1:split]...)
+		recent = a.Conversation[split:]
+	}
+
+	request := NewUserMessage(NewTextBlock(compactionPrompt + renderTranscript(summarized)))
+	response, err := a.AIClient.RunInference(ctx, InferenceRequest{
+		Conversation: []Message{request},
+		Settings:     a.ModelSettings,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	a.trackUsage(response)
+
+	var summary strings.Builder
+	summary.WriteString("Summary of the earlier part of this conversation:\n\n")
+	summary.WriteString(response.Text())
+	summary.WriteString("\n")
+
+	budget := a.CompactThreshold / 5 * charsPerToken
+	if files := retainedFileContents(summarized, budget); len(files) > 0 {
+		summary.WriteString("\nContents of files read earlier that have not been modified since:\n\n")
+		summary.WriteString(files)
+	}
+
+	// Prepend the summary to the first kept turn, so the history still starts with a user message
+	first := a.Conversation[turn]
+	first.Content = append([]ContentBlock{NewTextBlock(summary.String())}, kept...)
+
+	compacted := make([]Message, 0, len(recent)+1)
+	compacted = append(compacted, first)
+	compacted = append(compacted, recent...)
+	a.Conversation = compacted
+
+	a.record(SessionEntry{Type: SessionEntryCompaction, Conversation: compacted})
+	a.Notice(NoticeSuccess, fmt.Sprintf("Compacted %d messages into a summary (~%d -> ~%d tokens).", len(summarized), before, EstimateTokens(compacted)))
+	return nil
+}
+
+// compactionSplit returns where the conversation is split for compaction: turn is the index of
+// the user message starting the first kept turn, which is kept along with the messages from
+// split on; everything else before split is summarized. Turns start at user messages carrying
+// text, as opposed to user messages that only carry tool results.
+//
+// If the current turn has taken more than compactKeepSteps steps, split is the assistant message
+// starting the most recent of them, so that a single long turn can be compacted too. Otherwise
+// split equals turn and the last compactKeepTurns turns are kept whole. Both are 0 if the
+// conversation is too short to compact.
+func compactionSplit(conversation []Message) (turn, split int) {
+	var turnStarts []int
+	for i, message := range conversation {
+		if message.Role == RoleUser && message.Text() != "" {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+	if len(turnStarts) == 0 {
+		return 0, 0
+	}
+
+	current := turnStarts[len(turnStarts)-1]
+	var steps []int // Assistant messages of the current turn
+	for i := current + 1; i < len(conversation); i++ {
+		if conversation[i].Role == RoleAssistant {
+			steps = append(steps, i)
+		}
+	}
+	if len(steps) > compactKeepSteps {
+		return current, steps[len(steps)-compactKeepSteps]
+	}
+
+	if len(turnStarts) <= compactKeepTurns {
+		return 0, 0
+	}
+	turn = turnStarts[len(turnStarts)-compactKeepTurns]
+	return turn, turn
+}
+
+// splitToolResults separates the tool_result blocks from the other content blocks.
+func splitToolResults(content []ContentBlock) (other, results []ContentBlock) {
+	for _, block := range content {
+		if block.Type == ContentBlockToolResult {
+			results = append(results, block)
+		} else {
+			other = append(other, block)
+		}
+	}
+	return other, results
+}
+
+// renderTranscript renders messages as plain text for the summarizer.
+func renderTranscript(messages []Message) string {
+	var transcript strings.Builder
+	for _, message := range messages {
+		for _, block := range message.Content {
+			switch block.Type {
+			case ContentBlockText:
+				fmt.Fprintf(&transcript, "[%s]: %s\n\n", message.Role, block.Text)
+			case ContentBlockToolUse:
+				fmt.Fprintf(&transcript, "[tool call]: %s(%s)\n\n", block.Name, block.Input)
+			case ContentBlockToolResult:
+				content := block.Content
+				if len(content) > maxSummarizedToolResult {
+					content = content[:maxSummarizedToolResult] + "... [truncated]"
+				}
+				status := "tool result"
+				if block.IsError {
+					status = "tool error"
+				}
+				fmt.Fprintf(&transcript, "[%s]: %s\n\n", status, content)
+			}
+		}
+	}
+	return transcript.String()
+}
+
+// retainedFileContents collects the latest read_file results from messages for files that
+// were not edited or recreated afterwards, formatted for the summary message.
+// Files are added newest first until the character budget is exhausted.
+func retainedFileContents(messages []Message, budget int) string {
+	type fileContent struct {
+		path    string
+		content string
+	}
+
+	toolPaths := make(map[string]string) // tool_use ID -> path read by it
+	var files []fileContent              // in order of reading
+	latest := make(map[string]int)       // path -> index into files
+
+	for _, message := range messages {
+		for _, block := range message.Content {
+			switch block.Type {
+			case ContentBlockToolUse:
+				var input struct {
+					Path string `json:"path"`
+				}
+				if err := json.Unmarshal(block.Input, &input); err != nil || input.Path == "" {
+					continue
+				}
+				switch block.Name {
+				case "read_file":
+					toolPaths[block.ID] = input.Path
+				case "edit_file", "create_file":
+					// Earlier reads of this file are stale now
+					delete(latest, input.Path)
+				}
+			case ContentBlockToolResult:
+				path, ok := toolPaths[block.ToolUseID]
+				if !ok || block.IsError {
+					continue
+				}
+				latest[path] = len(files)
+				files = append(files, fileContent{path: path, content: block.Content})
+			}
+		}
+	}
+
+	var retained strings.Builder
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if index, ok := latest[file.path]; !ok || index != i {
+			continue
+		}
+		entry := fmt.Sprintf("--- File: %s ---\n%s\n\n", file.path, file.content)
+		if retained.Len()+len(entry) > budget {
+			continue
+		}
+		retained.WriteString(entry)
+	}
+	return retained.String()
+}
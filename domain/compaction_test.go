@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// summarizingAIClient answers every inference request with a fixed summary.
+type summarizingAIClient struct {
+	requests []InferenceRequest
+}
+
+func (c *summarizingAIClient) RunInference(ctx context.Context, request InferenceRequest) (*Message, error) {
+	c.requests = append(c.requests, request)
+	message := NewAssistantMessage(NewTextBlock("The user asked for several changes."))
+	return &message, nil
+}
+
+func (c *summarizingAIClient) StreamInference(ctx context.Context, request InferenceRequest) (InferenceStream, error) {
+	panic("not used by compaction")
+}
+
+func TestCompactSummarizesOrphanedToolResults(t *testing.T) {
+	toolUse := NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":"a.go"}`))
+	client := &summarizingAIClient{}
+	agent := NewAgent(client, nil, nil, nil, nil)
+	agent.Conversation = []Message{
+		NewUserMessage(NewTextBlock("First")),
+		NewAssistantMessage(NewTextBlock("One")),
+		NewUserMessage(NewTextBlock("Second")),
+		// The turn was stopped after this tool call, so its result opens the next turn
+		NewAssistantMessage(toolUse),
+		NewUserMessage(NewToolResultBlock("toolu_1", "package a", false), NewTextBlock("Third")),
+		NewAssistantMessage(NewTextBlock("Three")),
+		NewUserMessage(NewTextBlock("Fourth")),
+		NewAssistantMessage(NewTextBlock("Four")),
+	}
+
+	if err := agent.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	if len(agent.Conversation) != 4 {
+		t.Fatalf("compacted conversation has %d messages, want the last 2 turns", len(agent.Conversation))
+	}
+	first := agent.Conversation[0]
+	for _, block := range first.Content {
+		if block.Type == ContentBlockToolResult {
+			t.Errorf("compacted conversation starts with a tool result without its tool call: %+v", first.Content)
+		}
+	}
+	if !strings.Contains(first.Text(), "The user asked for several changes.") || !strings.HasSuffix(first.Text(), "Third") {
+		t.Errorf("first message = %q, want the summary followed by the kept turn", first.Text())
+	}
+
+	if len(client.requests) != 1 {
+		t.Fatalf("got %d inference requests, want 1", len(client.requests))
+	}
+	if transcript := client.requests[0].Conversation[0].Text(); !strings.Contains(transcript, "[tool result]: package a") {
+		t.Errorf("orphaned tool result was not summarized:\n%s", transcript)
+	}
+}
+
+func TestCompactSingleLongTurn(t *testing.T) {
+	client := &summarizingAIClient{}
+	agent := NewAgent(client, nil, nil, nil, nil)
+	agent.Conversation = []Message{NewUserMessage(NewTextBlock("Review every file"))}
+	for i, path := range []string{"a.go", "b.go", "c.go", "d.go"} {
+		id := string(rune('1' + i))
+		agent.Conversation = append(agent.Conversation,
+			NewAssistantMessage(NewToolUseBlock(id, "read_file", json.RawMessage(`{"path":"`+path+`"}`))),
+			NewUserMessage(NewToolResultBlock(id, "package "+path, false)),
+		)
+	}
+
+	if err := agent.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	// The request and the last two steps are kept, the first two steps are summarized
+	if len(agent.Conversation) != 5 {
+		t.Fatalf("compacted conversation has %d messages, want the request and 2 steps: %+v", len(agent.Conversation), agent.Conversation)
+	}
+	first := agent.Conversation[0]
+	if first.Role != RoleUser || !strings.HasSuffix(first.Text(), "Review every file") || !strings.Contains(first.Text(), "--- File: a.go ---") {
+		t.Errorf("first message = %q, want the summary with the files read, followed by the request", first.Text())
+	}
+	if toolUses := agent.Conversation[1].ToolUses(); len(toolUses) != 1 || toolUses[0].ID != "3" {
+		t.Errorf("second message = %+v, want the call of the third step", agent.Conversation[1])
+	}
+	if transcript := client.requests[0].Conversation[0].Text(); !strings.Contains(transcript, "package b.go") || strings.Contains(transcript, "package c.go") {
+		t.Errorf("transcript does not cover exactly the first two steps:\n%s", transcript)
+	}
+}
+
+// failingAIClient fails every inference request.
+type failingAIClient struct {
+	requests int
+}
+
+func (c *failingAIClient) RunInference(ctx context.Context, request InferenceRequest) (*Message, error) {
+	c.requests++
+	return nil, errors.New("overloaded")
+}
+
+func (c *failingAIClient) StreamInference(ctx context.Context, request InferenceRequest) (InferenceStream, error) {
+	c.requests++
+	return nil, errors.New("overloaded")
+}
+
+func TestCompactIfNeededDoesNotRetryInTheSameTurn(t *testing.T) {
+	client := &failingAIClient{}
+	agent := NewAgent(client, nil, nil, nil, nil)
+	agent.CompactThreshold = 1
+	for _, text := range []string{"First", "Second", "Third"} {
+		agent.Conversation = append(agent.Conversation, NewUserMessage(NewTextBlock(text)), NewAssistantMessage(NewTextBlock("Done")))
+	}
+
+	agent.compactIfNeeded(context.Background())
+	agent.compactIfNeeded(context.Background())
+
+	if client.requests != 1 {
+		t.Errorf("got %d summarization requests, want 1", client.requests)
+	}
+}
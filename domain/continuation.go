@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxContinuations is the default number of times a response cut off at the
+// max_tokens limit is continued before the agent gives up.
+const DefaultMaxContinuations = 3
+
+// continueTruncated keeps generating while the response stops at the max_tokens limit,
+// stitching each continuation onto the partial message: continued text is appended to the
+// last text block, and a cut-off tool call has its partial input JSON completed.
+//
+// The conversation is the history the truncated message was generated from; the partial
+// message itself is not part of it. If the response is still truncated after MaxContinuations
+// continuations, or a continuation fails, the usage spent so far is tracked and an error returned.
+func (a *Agent) continueTruncated(ctx context.Context, conversation []Message, message *Message) (*Message, error) {
+	for continuation := 1; message.StopReason == StopReasonMaxTokens; continuation++ {
+		if continuation > a.MaxContinuations {
+			a.trackUsage(message)
+			return nil, fmt.Errorf("response was still cut off at the output token limit after %d continuation(s); raise the max tokens setting or ask for smaller steps", a.MaxContinuations)
+		}
+		a.Notice(NoticeWarning, fmt.Sprintf("Response hit the output token limit, continuing (%d/%d)...", continuation, a.MaxContinuations))
+
+		request := append([]Message{}, conversation...)
+		for _, m := range continuationMessages(message) {
+			request = appendMessage(request, m)
+		}
+		next, err := a.infer(ctx, request)
+		if err != nil {
+			a.trackUsage(message)
+			return nil, err
+		}
+		stitched, err := stitchContinuation(message, next)
+		if err != nil {
+			a.trackUsage(message)
+			a.trackUsage(next)
+			return nil, err
+		}
+		message = stitched
+	}
+	return message, nil
+}
+
+// truncatedToolUse returns the index of the tool call that was cut off in a truncated message,
+// or -1 if the message was cut off in text. Only the last content block can be cut off.
+func truncatedToolUse(message *Message) int {
+	last := len(message.Content) - 1
+	if last >= 0 && message.Content[last].Type == ContentBlockToolUse {
+		return last
+	}
+	return -1
+}
+
+// partialInput returns the tool input received so far for a cut-off tool call.
+// Input that already parses is a placeholder for input that never arrived, e.g. "{}".
+func partialInput(block ContentBlock) string {
+	if json.Valid(block.Input) {
+		return ""
+	}
+	return string(block.Input)
+}
+
+// continuationMessages builds the messages that ask the model to continue a truncated response.
+// The partial response is replayed as plain text, since a cut-off tool call cannot be sent back
+// as a tool_use block, followed by a user message explaining what to continue.
+func continuationMessages(message *Message) []Message {
+	var replay strings.Builder
+	for _, block := range message.Content {
+		switch block.Type {
+		case ContentBlockText:
+			replay.WriteString(block.Text)
+		case ContentBlockToolUse:
+			fmt.Fprintf(&replay, "\n[Call to tool %s with input JSON: %s", block.Name, partialInput(block))
+		}
+	}
+
+	instruction := "Your previous response was cut off at the output token limit. Continue exactly where it stopped, without repeating anything that was already written."
+	if i := truncatedToolUse(message); i >= 0 {
+		instruction = fmt.Sprintf("Your previous response was cut off at the output token limit while writing the input JSON for the %s tool. Reply with only the remaining characters of that JSON, starting exactly where it stopped, without code fences or any other text.", message.Content[i].Name)
+	}
+
+	followUp := NewUserMessage(NewTextBlock(instruction))
+	if replay.Len() == 0 {
+		return []Message{followUp}
+	}
+	return []Message{NewAssistantMessage(NewTextBlock(replay.String())), followUp}
+}
+
+// stitchContinuation merges a continuation response into the truncated message it continues.
+// The result carries the continuation's stop reason, so it may still be truncated.
+func stitchContinuation(message, continuation *Message) (*Message, error) {
+	merged := *message
+	merged.Content = append([]ContentBlock{}, message.Content...)
+	merged.StopReason = continuation.StopReason
+	if continuation.Usage != nil {
+		usage := Usage{}
+		if message.Usage != nil {
+			usage = *message.Usage
+		}
+		usage.Add(*continuation.Usage)
+		merged.Usage = &usage
+	}
+
+	i := truncatedToolUse(message)
+	if i < 0 {
+		// Cut off in text: the first continued text joins the last text block. If the message ends
+		// with another block, e.g. thinking, the continued text stays a block of its own
+		blocks := continuation.Content
+		if n := len(merged.Content); len(blocks) > 0 && blocks[0].Type == ContentBlockText && n > 0 && merged.Content[n-1].Type == ContentBlockText {
+			last := &merged.Content[len(merged.Content)-1]
+			last.Text += blocks[0].Text
+			blocks = blocks[1:]
+		}
+		merged.Content = append(merged.Content, blocks...)
+		return &merged, nil
+	}
+
+	// Cut off in a tool call: a complete call to the same tool replaces the partial one
+	toolUse := merged.Content[i]
+	for _, block := range continuation.Content {
+		if block.Type == ContentBlockToolUse && block.Name == toolUse.Name && json.Valid(block.Input) {
+			toolUse.Input = block.Input
+			merged.Content[i] = toolUse
+			return &merged, nil
+		}
+	}
+
+	// Otherwise the continued text is the rest of the input JSON
+	rest := trimCodeFence(continuation.Text())
+	partial := partialInput(toolUse)
+	input := partial + rest
+	for _, candidate := range []string{partial + rest, partial + strings.TrimSpace(rest), strings.TrimSpace(partial + rest)} {
+		if json.Valid([]byte(candidate)) {
+			input = candidate
+			break
+		}
+	}
+	toolUse.Input = json.RawMessage(input)
+	merged.Content[i] = toolUse
+
+	if !json.Valid(toolUse.Input) && merged.StopReason != StopReasonMaxTokens {
+		return nil, fmt.Errorf("could not complete the input of the %s tool call that was cut off at the output token limit", toolUse.Name)
+	}
+	return &merged, nil
+}
+
+// trimCodeFence removes a Markdown code fence the model may have wrapped around its output.
+func trimCodeFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") {
+		return text
+	}
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	if newline := strings.IndexByte(trimmed, '\n'); newline >= 0 {
+		trimmed = trimmed[newline+1:] // Drop the language tag line
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(trimmed), "```"))
+}
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStitchContinuationJoinsTrailingText(t *testing.T) {
+	message := &Message{
+		Role:       RoleAssistant,
+		Content:    []ContentBlock{NewTextBlock("The quick brown")},
+		StopReason: StopReasonMaxTokens,
+		Usage:      &Usage{InputTokens: 10, OutputTokens: 20},
+	}
+	continuation := &Message{
+		Role:       RoleAssistant,
+		Content:    []ContentBlock{NewTextBlock(" fox jumps.")},
+		StopReason: StopReasonEndTurn,
+		Usage:      &Usage{InputTokens: 30, OutputTokens: 5},
+	}
+
+	merged, err := stitchContinuation(message, continuation)
+	if err != nil {
+		t.Fatalf("stitchContinuation: %v", err)
+	}
+	if want := []ContentBlock{NewTextBlock("The quick brown fox jumps.")}; !reflect.DeepEqual(merged.Content, want) {
+		t.Errorf("content = %+v, want %+v", merged.Content, want)
+	}
+	if merged.StopReason != StopReasonEndTurn {
+		t.Errorf("stop reason = %q, want %q", merged.StopReason, StopReasonEndTurn)
+	}
+	if *merged.Usage != (Usage{InputTokens: 40, OutputTokens: 25}) {
+		t.Errorf("usage = %+v, want the sum of both calls", *merged.Usage)
+	}
+	if message.Content[0].Text != "The quick brown" {
+		t.Errorf("truncated message was modified: %+v", message.Content)
+	}
+}
+
+func TestStitchContinuationAfterThinking(t *testing.T) {
+	message := &Message{
+		Role:       RoleAssistant,
+		Content:    []ContentBlock{NewThinkingBlock("Planning the answer", "sig")},
+		StopReason: StopReasonMaxTokens,
+	}
+	continuation := &Message{
+		Role:       RoleAssistant,
+		Content:    []ContentBlock{NewTextBlock("Here is the answer.")},
+		StopReason: StopReasonEndTurn,
+	}
+
+	merged, err := stitchContinuation(message, continuation)
+	if err != nil {
+		t.Fatalf("stitchContinuation: %v", err)
+	}
+	want := []ContentBlock{NewThinkingBlock("Planning the answer", "sig"), NewTextBlock("Here is the answer.")}
+	if !reflect.DeepEqual(merged.Content, want) {
+		t.Errorf("content = %+v, want %+v", merged.Content, want)
+	}
+}
+
+func TestStitchContinuationCompletesToolInput(t *testing.T) {
+	tests := []struct {
+		name         string
+		continuation []ContentBlock
+		want         string
+	}{
+		{
+			name:         "remaining characters",
+			continuation: []ContentBlock{NewTextBlock(`main.go"}`)},
+			want:         `{"path":"main.go"}`,
+		},
+		{
+			name:         "code fence",
+			continuation: []ContentBlock{NewTextBlock("```json\nmain.go\"}\n```")},
+			want:         `{"path":"main.go"}`,
+		},
+		{
+			name:         "complete call",
+			continuation: []ContentBlock{NewToolUseBlock("toolu_2", "read_file", json.RawMessage(`{"path":"other.go"}`))},
+			want:         `{"path":"other.go"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &Message{
+				Role: RoleAssistant,
+				Content: []ContentBlock{
+					NewTextBlock("Reading it."),
+					NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":"`)),
+				},
+				StopReason: StopReasonMaxTokens,
+			}
+			continuation := &Message{Role: RoleAssistant, Content: tt.continuation, StopReason: StopReasonToolUse}
+
+			merged, err := stitchContinuation(message, continuation)
+			if err != nil {
+				t.Fatalf("stitchContinuation: %v", err)
+			}
+			if len(merged.Content) != 2 {
+				t.Fatalf("content = %+v, want the text and the tool call", merged.Content)
+			}
+			toolUse := merged.Content[1]
+			if toolUse.ID != "toolu_1" || string(toolUse.Input) != tt.want {
+				t.Errorf("tool use = %s %s, want toolu_1 %s", toolUse.ID, toolUse.Input, tt.want)
+			}
+		})
+	}
+}
+
+func TestStitchContinuationInvalidToolInput(t *testing.T) {
+	message := &Message{
+		Role:       RoleAssistant,
+		Content:    []ContentBlock{NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":`))},
+		StopReason: StopReasonMaxTokens,
+	}
+
+	// Still truncated: the input may be completed by the next continuation
+	truncated := &Message{Role: RoleAssistant, Content: []ContentBlock{NewTextBlock(`"ma`)}, StopReason: StopReasonMaxTokens}
+	if _, err := stitchContinuation(message, truncated); err != nil {
+		t.Errorf("stitchContinuation with a truncated continuation: %v", err)
+	}
+
+	finished := &Message{Role: RoleAssistant, Content: []ContentBlock{NewTextBlock("I cannot continue that.")}, StopReason: StopReasonEndTurn}
+	if _, err := stitchContinuation(message, finished); err == nil {
+		t.Error("stitchContinuation returned no error for input that is not valid JSON")
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType identifies what happened in an agent event.
+type EventType string
+
+const (
+	EventTurnStarted      EventType = "turn_started"       // A user turn starts; Text is the user input
+	EventTurnFinished     EventType = "turn_finished"      // The model finished answering the turn, or it was stopped
+	EventInferenceStarted EventType = "inference_started"  // The model is asked for the next message of the turn
+	EventTextDelta        EventType = "text_delta"         // Text of the answer, as streamed or complete
+	EventThinkingDelta    EventType = "thinking_delta"     // Extended thinking, sent only while thinking is shown
+	EventBlockFinished    EventType = "block_finished"     // The current text or thinking block is complete
+	EventToolCallStarted  EventType = "tool_call_started"  // A tool call starts; ToolName, Input and, for file edits, Diff are set
+	EventToolCallFinished EventType = "tool_call_finished" // A tool call finished; Output and IsError are set
+	EventContextInjected  EventType = "context_injected"   // Code snippets were injected into the user turn; Text holds them
+	EventNotice           EventType = "notice"             // A status message for the user; Level says how to present it
+	EventOutput           EventType = "output"             // Output of a chat command, such as a table or a report
+	EventError            EventType = "error"              // An error that did not end the session; Text is the message
+)
+
+// NoticeLevel says how a notice should be presented.
+type NoticeLevel string
+
+const (
+	NoticeInfo    NoticeLevel = "info"    // Progress, e.g. "Observing results..."
+	NoticeSuccess NoticeLevel = "success" // A completed action, e.g. a compaction
+	NoticeWarning NoticeLevel = "warning" // Something the user should act on, e.g. a stopped turn
+	NoticeMuted   NoticeLevel = "muted"   // Secondary information, e.g. collapsed thinking
+)
+
+// Event is something the agent reports while it runs: streamed model output, tool calls,
+// status messages and errors. Events are rendered by an EventSink, which decides how
+// (and whether) to present them, so the domain never writes to the terminal itself.
+type Event struct {
+	Type      EventType       `json:"type"`
+	Time      time.Time       `json:"time"`
+	Text      string          `json:"text,omitempty"`
+	Level     NoticeLevel     `json:"level,omitempty"`       // Set for notices
+	ToolUseID string          `json:"tool_use_id,omitempty"` // Set for tool call events
+	ToolName  string          `json:"tool_name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	Output    string          `json:"output,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	Duration  time.Duration   `json:"duration_ns,omitempty"` // Set when a tool call finishes
+	Diff      string          `json:"diff,omitempty"`        // Unified diff of the file change a starting tool call makes, if previewable
+}
+
+// EventSink receives the events of an agent. Tool calls may run concurrently, so
+// implementations must be safe for use by multiple goroutines.
+type EventSink interface {
+	Emit(event Event)
+}
+
+// DiscardEvents is an EventSink that ignores all events.
+type DiscardEvents struct{}
+
+// Emit ignores the event.
+func (DiscardEvents) Emit(Event) {}
+
+// Emit reports an event to the agent's event sink, stamping it with the current time.
+func (a *Agent) Emit(event Event) {
+	if a.Events == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	a.Events.Emit(event)
+}
+
+// Notice reports a status message to the user.
+func (a *Agent) Notice(level NoticeLevel, text string) {
+	a.Emit(Event{Type: EventNotice, Level: level, Text: text})
+}
+
+// Output reports the output of a chat command to the user.
+func (a *Agent) Output(text string) {
+	a.Emit(Event{Type: EventOutput, Text: text})
+}
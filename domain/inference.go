@@ -0,0 +1,24 @@
+package domain
+
+// ModelSettings are the generation parameters sent with every inference request.
+// Zero values leave the choice to the provider client's defaults.
+type ModelSettings struct {
+	Model         string   `yaml:"name" json:"name,omitempty"`
+	MaxTokens     int      `yaml:"max_tokens" json:"max_tokens,omitempty"`
+	Temperature   *float64 `yaml:"temperature" json:"temperature,omitempty"`
+	TopP          *float64 `yaml:"top_p" json:"top_p,omitempty"`
+	StopSequences []string `yaml:"stop_sequences" json:"stop_sequences,omitempty"`
+	// ThinkingBudget enables extended thinking with this many tokens to think with; 0 disables it.
+	ThinkingBudget int `yaml:"thinking_budget" json:"thinking_budget,omitempty"`
+}
+
+// DefaultMaxTokens is the maximum number of output tokens requested when none is configured.
+const DefaultMaxTokens = 4096
+
+// InferenceRequest is everything an AIClient needs to generate the next assistant message.
+type InferenceRequest struct {
+	System       string           // System prompt; empty for none
+	Conversation []Message        // Conversation history, ending with a user message
+	Tools        []ToolDefinition // Tools the model may call
+	Settings     ModelSettings    // Model and generation parameters
+}
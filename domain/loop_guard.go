@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// DefaultMaxStepsPerTurn is the default number of inference steps a single turn may take
+	// before the agent pauses and asks the user whether to continue.
+	DefaultMaxStepsPerTurn = 25
+
+	// DefaultMaxRepeatedToolErrors is the default number of times the same tool call may fail
+	// with the same error before the agent pauses and asks the user whether to continue.
+	DefaultMaxRepeatedToolErrors = 3
+)
+
+// loopGuard detects runaway inner ReAct loops within a single turn: too many steps,
+// or the model retrying an identical tool call that keeps failing with an identical error.
+type loopGuard struct {
+	maxSteps          int
+	maxRepeatedErrors int
+
+	steps  int
+	errors map[string]int // Failing tool call signature -> number of occurrences
+}
+
+// newLoopGuard creates a loopGuard for a new turn. A limit of 0 disables the corresponding check.
+func newLoopGuard(maxSteps, maxRepeatedErrors int) *loopGuard {
+	return &loopGuard{
+		maxSteps:          maxSteps,
+		maxRepeatedErrors: maxRepeatedErrors,
+		errors:            make(map[string]int),
+	}
+}
+
+// Observe records one completed step with its tool calls and their results.
+// toolResults must be in the same order as toolUses.
+func (g *loopGuard) Observe(toolUses []ContentBlock, toolResults []ContentBlock) {
+	g.steps++
+	for i, toolUse := range toolUses {
+		if i >= len(toolResults) || !toolResults[i].IsError {
+			continue
+		}
+		g.errors[failureSignature(toolUse, toolResults[i])]++
+	}
+}
+
+// Check returns a description of the limit that was hit, or "" if the loop may proceed.
+func (g *loopGuard) Check() string {
+	if g.maxSteps > 0 && g.steps >= g.maxSteps {
+		return fmt.Sprintf("The agent has taken %d steps in this turn without finishing.", g.steps)
+	}
+	if g.maxRepeatedErrors > 0 {
+		for _, count := range g.errors {
+			if count >= g.maxRepeatedErrors {
+				return fmt.Sprintf("The agent has repeated an identical failing tool call %d times.", count)
+			}
+		}
+	}
+	return ""
+}
+
+// Reset clears the step count and failure history, after the user chose to continue.
+func (g *loopGuard) Reset() {
+	g.steps = 0
+	g.errors = make(map[string]int)
+}
+
+// failureSignature identifies a failing tool call by tool name, input and error message.
+// The input is compacted so that whitespace differences do not hide a repetition.
+func failureSignature(toolUse ContentBlock, result ContentBlock) string {
+	input := []byte(toolUse.Input)
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, input); err == nil {
+		input = compacted.Bytes()
+	}
+	return toolUse.Name + "\x00" + string(input) + "\x00" + result.Content
+}
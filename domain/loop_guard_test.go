@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoopGuardStepLimit(t *testing.T) {
+	guard := newLoopGuard(3, 0)
+	for step := 1; step <= 3; step++ {
+		if reason := guard.Check(); reason != "" {
+			t.Fatalf("step %d: Check = %q before the limit", step, reason)
+		}
+		guard.Observe(nil, nil)
+	}
+	if guard.Check() == "" {
+		t.Fatal("Check did not report the step limit")
+	}
+
+	guard.Reset()
+	if reason := guard.Check(); reason != "" {
+		t.Errorf("Check after Reset = %q", reason)
+	}
+}
+
+func TestLoopGuardRepeatedErrors(t *testing.T) {
+	failed := NewToolResultBlock("toolu_1", "file not found", true)
+	inputs := []string{`{"path": "a.go"}`, `{"path":"a.go"}`, "{\n  \"path\": \"a.go\"\n}"}
+
+	guard := newLoopGuard(0, 3)
+	for i, input := range inputs {
+		if reason := guard.Check(); reason != "" {
+			t.Fatalf("call %d: Check = %q before the limit", i+1, reason)
+		}
+		toolUse := NewToolUseBlock("toolu_1", "read_file", json.RawMessage(input))
+		guard.Observe([]ContentBlock{toolUse}, []ContentBlock{failed})
+	}
+	if guard.Check() == "" {
+		t.Error("Check did not report a call repeated with whitespace-only differences")
+	}
+}
+
+func TestLoopGuardIgnoresDistinctAndSuccessfulCalls(t *testing.T) {
+	guard := newLoopGuard(0, 2)
+	readA := NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":"a.go"}`))
+	readB := NewToolUseBlock("toolu_2", "read_file", json.RawMessage(`{"path":"b.go"}`))
+
+	guard.Observe([]ContentBlock{readA}, []ContentBlock{NewToolResultBlock("toolu_1", "file not found", true)})
+	guard.Observe([]ContentBlock{readB}, []ContentBlock{NewToolResultBlock("toolu_2", "file not found", true)})
+	guard.Observe([]ContentBlock{readA}, []ContentBlock{NewToolResultBlock("toolu_1", "package a", false)})
+	if reason := guard.Check(); reason != "" {
+		t.Errorf("Check = %q for distinct failures", reason)
+	}
+}
+
+func TestLoopGuardDisabled(t *testing.T) {
+	guard := newLoopGuard(0, 0)
+	toolUse := NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{}`))
+	failed := NewToolResultBlock("toolu_1", "boom", true)
+	for i := 0; i < 100; i++ {
+		guard.Observe([]ContentBlock{toolUse}, []ContentBlock{failed})
+	}
+	if reason := guard.Check(); reason != "" {
+		t.Errorf("Check = %q with both limits disabled", reason)
+	}
+}
@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Role identifies the author of a message in a conversation.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Stop reasons reported on assistant responses.
+// Providers with a different vocabulary map their values onto these.
+const (
+	StopReasonEndTurn      = "end_turn"
+	StopReasonMaxTokens    = "max_tokens"
+	StopReasonStopSequence = "stop_sequence"
+	StopReasonToolUse      = "tool_use"
+)
+
+// ContentBlockType identifies the kind of content carried by a ContentBlock.
+type ContentBlockType string
+
+const (
+	ContentBlockText             ContentBlockType = "text"
+	ContentBlockToolUse          ContentBlockType = "tool_use"
+	ContentBlockToolResult       ContentBlockType = "tool_result"
+	ContentBlockImage            ContentBlockType = "image"
+	ContentBlockThinking         ContentBlockType = "thinking"
+	ContentBlockRedactedThinking ContentBlockType = "redacted_thinking"
+)
+
+// ContentBlock is a single piece of message content.
+// Only the fields relevant to the block Type are populated.
+type ContentBlock struct {
+	Type ContentBlockType `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+
+	// image (base64 encoded) and redacted_thinking (opaque data)
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewTextBlock creates a text content block.
+func NewTextBlock(text string) ContentBlock {
+	return ContentBlock{Type: ContentBlockText, Text: text}
+}
+
+// NewToolUseBlock creates a tool_use content block requesting the named tool with the given input.
+func NewToolUseBlock(id, name string, input json.RawMessage) ContentBlock {
+	return ContentBlock{Type: ContentBlockToolUse, ID: id, Name: name, Input: input}
+}
+
+// NewToolResultBlock creates a tool_result content block answering the tool_use with toolUseID.
+func NewToolResultBlock(toolUseID, content string, isError bool) ContentBlock {
+	return ContentBlock{Type: ContentBlockToolResult, ToolUseID: toolUseID, Content: content, IsError: isError}
+}
+
+// NewImageBlock creates an image content block from base64 encoded data.
+func NewImageBlock(mediaType, base64Data string) ContentBlock {
+	return ContentBlock{Type: ContentBlockImage, MediaType: mediaType, Data: base64Data}
+}
+
+// NewThinkingBlock creates a thinking content block with its verification signature.
+func NewThinkingBlock(thinking, signature string) ContentBlock {
+	return ContentBlock{Type: ContentBlockThinking, Thinking: thinking, Signature: signature}
+}
+
+// NewRedactedThinkingBlock creates a redacted_thinking content block with its opaque data.
+func NewRedactedThinkingBlock(data string) ContentBlock {
+	return ContentBlock{Type: ContentBlockRedactedThinking, Data: data}
+}
+
+// Message is a single conversation turn authored by the user or the assistant.
+type Message struct {
+	Role       Role           `json:"role"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason,omitempty"` // Set on assistant responses only
+	Model      string         `json:"model,omitempty"`       // Model that generated an assistant response
+	Usage      *Usage         `json:"usage,omitempty"`       // Token usage of the inference call that produced an assistant response
+}
+
+// NewUserMessage creates a user message from the given content blocks.
+func NewUserMessage(blocks ...ContentBlock) Message {
+	return Message{Role: RoleUser, Content: blocks}
+}
+
+// NewAssistantMessage creates an assistant message from the given content blocks.
+func NewAssistantMessage(blocks ...ContentBlock) Message {
+	return Message{Role: RoleAssistant, Content: blocks}
+}
+
+// ToolUses returns the tool_use blocks of the message in order.
+func (m Message) ToolUses() []ContentBlock {
+	var toolUses []ContentBlock
+	for _, block := range m.Content {
+		if block.Type == ContentBlockToolUse {
+			toolUses = append(toolUses, block)
+		}
+	}
+	return toolUses
+}
+
+// Text returns the concatenated text blocks of the message.
+func (m Message) Text() string {
+	var text strings.Builder
+	for _, block := range m.Content {
+		if block.Type == ContentBlockText {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,117 @@
+package domain
+
+import "time"
+
+// SessionEntryType identifies the kind of record stored in a session transcript.
+type SessionEntryType string
+
+const (
+	SessionEntryUser       SessionEntryType = "user"        // A user turn, as sent to the model
+	SessionEntryAssistant  SessionEntryType = "assistant"   // An assistant message, including its tool calls
+	SessionEntryToolResult SessionEntryType = "tool_result" // The results of the tool calls of the preceding assistant message
+	SessionEntryContext    SessionEntryType = "context"     // Code snippets injected into the following user turn
+	SessionEntryCompaction SessionEntryType = "compaction"  // The conversation history after it was compacted
+	SessionEntryClear      SessionEntryType = "clear"       // The conversation was cleared with /clear
+)
+
+// SessionEntry is a single record of a session transcript.
+type SessionEntry struct {
+	Type    SessionEntryType `json:"type"`
+	Time    time.Time        `json:"time"`
+	Message *Message         `json:"message,omitempty"` // Set for user, assistant and tool_result entries
+	Text    string           `json:"text,omitempty"`    // Raw user input for user entries, injected snippets for context entries
+
+	Conversation []Message `json:"conversation,omitempty"` // Set for compaction entries
+}
+
+// SessionRecorder persists the entries of a chat session as they happen.
+type SessionRecorder interface {
+	Record(entry SessionEntry) error
+}
+
+// SessionInfo summarizes a stored chat session for listings.
+type SessionInfo struct {
+	ID        string
+	Title     string // Derived from the first user input
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Turns     int // Number of user turns
+}
+
+// ConversationFromEntries rebuilds the conversation history from session entries.
+// A compaction entry replaces everything recorded before it with the compacted history,
+// and a clear entry discards it.
+//
+// A session that ended abruptly (e.g. a crash in the middle of a turn) may end with a user
+// message that was never answered, or contain tool calls whose results were never recorded.
+// Only those are dropped, so the returned history is valid to continue; the rest of a stopped,
+// cancelled or failed turn, such as the results of edits that were made, is kept.
+func ConversationFromEntries(entries []SessionEntry) []Message {
+	var conversation []Message
+	for _, entry := range entries {
+		switch entry.Type {
+		case SessionEntryUser, SessionEntryAssistant, SessionEntryToolResult:
+			if entry.Message != nil {
+				conversation = appendMessage(conversation, *entry.Message)
+			}
+		case SessionEntryCompaction:
+			conversation = append([]Message{}, entry.Conversation...)
+		case SessionEntryClear:
+			conversation = nil
+		}
+	}
+
+	return repairConversation(conversation)
+}
+
+// repairConversation removes the tool calls that are not answered by results in the following
+// message, dropping assistant messages left without text or tool calls, and the text of a
+// trailing user message, which was never answered.
+func repairConversation(conversation []Message) []Message {
+	var repaired []Message
+	for i, message := range conversation {
+		if message.Role == RoleAssistant {
+			var next []ContentBlock
+			if i+1 < len(conversation) {
+				next = conversation[i+1].Content
+			}
+			message.Content = withoutUnansweredToolUses(message.Content, next)
+			if message.Text() == "" && len(message.ToolUses()) == 0 {
+				continue
+			}
+		}
+		repaired = appendMessage(repaired, message)
+	}
+
+	if n := len(repaired); n > 0 && repaired[n-1].Role == RoleUser {
+		var results []ContentBlock
+		for _, block := range repaired[n-1].Content {
+			if block.Type == ContentBlockToolResult {
+				results = append(results, block)
+			}
+		}
+		if len(results) > 0 {
+			repaired[n-1].Content = results
+		} else if repaired = repaired[:n-1]; len(repaired) == 0 {
+			return nil
+		}
+	}
+	return repaired
+}
+
+// withoutUnansweredToolUses returns content without the tool_use blocks that have no tool_result in next.
+func withoutUnansweredToolUses(content, next []ContentBlock) []ContentBlock {
+	answered := make(map[string]bool)
+	for _, block := range next {
+		if block.Type == ContentBlockToolResult {
+			answered[block.ToolUseID] = true
+		}
+	}
+	var kept []ContentBlock
+	for _, block := range content {
+		if block.Type != ContentBlockToolUse || answered[block.ID] {
+			kept = append(kept, block)
+		}
+	}
+	return kept
+}
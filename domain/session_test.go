@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func userEntry(text string) SessionEntry {
+	message := NewUserMessage(NewTextBlock(text))
+	return SessionEntry{Type: SessionEntryUser, Message: &message, Text: text}
+}
+
+func assistantEntry(blocks ...ContentBlock) SessionEntry {
+	message := NewAssistantMessage(blocks...)
+	return SessionEntry{Type: SessionEntryAssistant, Message: &message}
+}
+
+func toolResultEntry(blocks ...ContentBlock) SessionEntry {
+	message := NewUserMessage(blocks...)
+	return SessionEntry{Type: SessionEntryToolResult, Message: &message}
+}
+
+func TestConversationFromEntries(t *testing.T) {
+	toolUse := NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":"a.go"}`))
+	toolResult := NewToolResultBlock("toolu_1", "package a", false)
+	compacted := []Message{
+		NewUserMessage(NewTextBlock("Summary")),
+		NewAssistantMessage(NewTextBlock("Understood.")),
+	}
+
+	tests := []struct {
+		name    string
+		entries []SessionEntry
+		want    []Message
+	}{
+		{
+			name: "tool results merge with the following user turn",
+			entries: []SessionEntry{
+				userEntry("Read a.go"),
+				assistantEntry(toolUse),
+				toolResultEntry(toolResult),
+				{Type: SessionEntryContext, Text: "snippets"},
+				userEntry("Thanks"),
+				assistantEntry(NewTextBlock("You're welcome.")),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("Read a.go")),
+				NewAssistantMessage(toolUse),
+				NewUserMessage(toolResult, NewTextBlock("Thanks")),
+				NewAssistantMessage(NewTextBlock("You're welcome.")),
+			},
+		},
+		{
+			name: "compaction replaces the earlier history",
+			entries: []SessionEntry{
+				userEntry("First"),
+				assistantEntry(NewTextBlock("One")),
+				{Type: SessionEntryCompaction, Conversation: compacted},
+				userEntry("Second"),
+				assistantEntry(NewTextBlock("Two")),
+			},
+			want: append(append([]Message{}, compacted...),
+				NewUserMessage(NewTextBlock("Second")),
+				NewAssistantMessage(NewTextBlock("Two")),
+			),
+		},
+		{
+			name: "clear discards the earlier history",
+			entries: []SessionEntry{
+				userEntry("First"),
+				assistantEntry(NewTextBlock("One")),
+				{Type: SessionEntryClear},
+				userEntry("Second"),
+				assistantEntry(NewTextBlock("Two")),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("Second")),
+				NewAssistantMessage(NewTextBlock("Two")),
+			},
+		},
+		{
+			name: "incomplete trailing turn is dropped",
+			entries: []SessionEntry{
+				userEntry("First"),
+				assistantEntry(NewTextBlock("One")),
+				userEntry("Second"),
+				assistantEntry(toolUse),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("First")),
+				NewAssistantMessage(NewTextBlock("One")),
+			},
+		},
+		{
+			name: "results of a stopped turn are kept",
+			entries: []SessionEntry{
+				userEntry("Edit a.go"),
+				assistantEntry(NewTextBlock("Editing."), toolUse),
+				toolResultEntry(toolResult),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("Edit a.go")),
+				NewAssistantMessage(NewTextBlock("Editing."), toolUse),
+				NewUserMessage(toolResult),
+			},
+		},
+		{
+			name: "unanswered tool call is removed from a reply with text",
+			entries: []SessionEntry{
+				userEntry("Read a.go"),
+				assistantEntry(NewTextBlock("Reading it."), toolUse),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("Read a.go")),
+				NewAssistantMessage(NewTextBlock("Reading it.")),
+			},
+		},
+		{
+			name: "unanswered tool call before a resumed turn is removed",
+			entries: []SessionEntry{
+				userEntry("First"),
+				assistantEntry(toolUse),
+				userEntry("Second"),
+				assistantEntry(NewTextBlock("Two")),
+			},
+			want: []Message{
+				NewUserMessage(NewTextBlock("First"), NewTextBlock("Second")),
+				NewAssistantMessage(NewTextBlock("Two")),
+			},
+		},
+		{
+			name:    "no complete turn",
+			entries: []SessionEntry{userEntry("First")},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConversationFromEntries(tt.entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConversationFromEntries =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
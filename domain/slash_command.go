@@ -0,0 +1,221 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrExitChat is returned by a slash command to end the chat session, e.g. by /exit.
+var ErrExitChat = errors.New("chat ended by the user")
+
+// SlashCommand is a command typed in the chat with a leading slash, such as "/usage".
+// It is handled by the agent itself instead of being sent to the model.
+// Packages outside the domain add their own commands with CommandRegistry.Register.
+type SlashCommand interface {
+	Name() string        // Name without the slash, e.g. "model"
+	Usage() string       // Synopsis of the arguments, e.g. "[name]"; empty if it takes none
+	Description() string // One-line summary shown by /help
+	Execute(ctx context.Context, agent *Agent, args []string) error
+}
+
+// CommandFunc adapts a function to the SlashCommand interface.
+type CommandFunc struct {
+	CommandName string
+	ArgsUsage   string
+	Summary     string
+	Run         func(ctx context.Context, agent *Agent, args []string) error
+}
+
+func (c CommandFunc) Name() string        { return c.CommandName }
+func (c CommandFunc) Usage() string       { return c.ArgsUsage }
+func (c CommandFunc) Description() string { return c.Summary }
+
+// Execute runs the command function.
+func (c CommandFunc) Execute(ctx context.Context, agent *Agent, args []string) error {
+	return c.Run(ctx, agent, args)
+}
+
+// CommandRegistry holds the slash commands available in the chat, keyed by name.
+type CommandRegistry struct {
+	commands map[string]SlashCommand
+}
+
+// NewCommandRegistry creates a registry holding the built-in commands.
+func NewCommandRegistry() *CommandRegistry {
+	r := &CommandRegistry{commands: make(map[string]SlashCommand)}
+	for _, cmd := range builtinCommands() {
+		r.Register(cmd)
+	}
+	return r
+}
+
+// Register adds a command, replacing any command with the same name.
+func (r *CommandRegistry) Register(cmd SlashCommand) {
+	r.commands[cmd.Name()] = cmd
+}
+
+// Find returns the command with the given name, without the leading slash.
+func (r *CommandRegistry) Find(name string) (SlashCommand, bool) {
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// Commands returns the registered commands sorted by name.
+func (r *CommandRegistry) Commands() []SlashCommand {
+	commands := make([]SlashCommand, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name() < commands[j].Name() })
+	return commands
+}
+
+// ParseSlashCommand splits user input such as "/model claude-3-5-haiku-latest" into the command
+// name and its arguments. Input whose first word contains another slash, such as a path like
+// "/etc/hosts", is not a command and is sent to the model as it is.
+func ParseSlashCommand(input string) (name string, args []string, ok bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil, false
+	}
+	name = strings.TrimPrefix(fields[0], "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+// runSlashCommand executes the slash command in the user input, if it is one.
+// Failures are reported to the user; only ErrExitChat is returned, to end the session.
+func (a *Agent) runSlashCommand(ctx context.Context, input string) (handled bool, err error) {
+	name, args, ok := ParseSlashCommand(input)
+	if !ok {
+		return false, nil
+	}
+	if a.Commands == nil {
+		a.Commands = NewCommandRegistry()
+	}
+
+	cmd, found := a.Commands.Find(name)
+	if !found {
+		a.Notice(NoticeWarning, fmt.Sprintf("Unknown command /%s. Type /help to list the commands.", name))
+		return true, nil
+	}
+	if err := cmd.Execute(ctx, a, args); err != nil {
+		if errors.Is(err, ErrExitChat) {
+			return true, err
+		}
+		a.Emit(Event{Type: EventError, Text: fmt.Sprintf("/%s failed: %v", name, err)})
+	}
+	return true, nil
+}
+
+// builtinCommands returns the slash commands every chat supports.
+func builtinCommands() []SlashCommand {
+	return []SlashCommand{
+		CommandFunc{CommandName: "help", Summary: "List the available commands", Run: runHelpCommand},
+		CommandFunc{CommandName: "clear", Summary: "Start over with an empty conversation", Run: runClearCommand},
+		CommandFunc{CommandName: "tools", Summary: "List the tools the model can call", Run: runToolsCommand},
+		CommandFunc{CommandName: "usage", Summary: "Show token usage and cost", Run: runUsageCommand},
+		CommandFunc{CommandName: "model", ArgsUsage: "[name]", Summary: "Show the model, or switch to another one keeping the conversation", Run: runModelCommand},
+		CommandFunc{CommandName: "context", ArgsUsage: "[query]", Summary: "Show the system prompt and the code snippets a query would inject", Run: runContextCommand},
+		CommandFunc{CommandName: "compact", Summary: "Summarize the older turns of the conversation", Run: runCompactCommand},
+		CommandFunc{CommandName: "thinking", Summary: "Toggle between showing and collapsing extended thinking", Run: runThinkingCommand},
+		CommandFunc{CommandName: "exit", Summary: "End the chat", Run: runExitCommand},
+	}
+}
+
+func runHelpCommand(ctx context.Context, a *Agent, args []string) error {
+	var help strings.Builder
+	help.WriteString("Commands:\n")
+	for _, cmd := range a.Commands.Commands() {
+		synopsis := "/" + cmd.Name()
+		if cmd.Usage() != "" {
+			synopsis += " " + cmd.Usage()
+		}
+		fmt.Fprintf(&help, "  %-18s %s\n", synopsis, cmd.Description())
+	}
+	help.WriteString("Anything else is sent to the model.\n")
+	a.Output(help.String())
+	return nil
+}
+
+func runClearCommand(ctx context.Context, a *Agent, args []string) error {
+	a.Conversation = nil
+	a.record(SessionEntry{Type: SessionEntryClear})
+	a.Notice(NoticeSuccess, "Conversation cleared. Usage totals are kept.")
+	return nil
+}
+
+func runToolsCommand(ctx context.Context, a *Agent, args []string) error {
+	tools := a.ToolRepository.GetAllTools()
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	var list strings.Builder
+	for _, tool := range tools {
+		description, _, _ := strings.Cut(tool.Description, "\n")
+		access := ""
+		if tool.ReadOnly {
+			access = " (read-only)"
+		}
+		fmt.Fprintf(&list, "  %s%s: %s\n", tool.Name, access, description)
+	}
+	a.Output(list.String())
+	return nil
+}
+
+func runUsageCommand(ctx context.Context, a *Agent, args []string) error {
+	a.Output(a.Usage.Report())
+	return nil
+}
+
+func runModelCommand(ctx context.Context, a *Agent, args []string) error {
+	if len(args) == 0 {
+		a.Output("Current model: " + a.modelName())
+		return nil
+	}
+	a.ModelSettings.Model = args[0]
+	a.Notice(NoticeSuccess, fmt.Sprintf("Switched model to %s. The conversation is kept.", a.ModelSettings.Model))
+	return nil
+}
+
+func runContextCommand(ctx context.Context, a *Agent, args []string) error {
+	a.Output(fmt.Sprintf("System prompt (~%d tokens):", len(a.SystemPrompt)/charsPerToken))
+	a.Notice(NoticeMuted, a.SystemPrompt)
+	a.Output(fmt.Sprintf("Conversation: %d messages (~%d tokens)", len(a.Conversation), EstimateTokens(a.Conversation)))
+
+	if len(args) == 0 {
+		a.Output("Add a query, e.g. /context how are tools executed, to see the code snippets it would inject.")
+		return nil
+	}
+	if a.VectorStore == nil || a.EmbeddingClient == nil {
+		return errors.New("context retrieval is disabled (no embedding client or vector store)")
+	}
+	contextCode := a.retrieveContext(ctx, strings.Join(args, " "))
+	if contextCode == "" {
+		a.Output("No code snippets would be injected for this query.")
+		return nil
+	}
+	a.Output(contextCode)
+	return nil
+}
+
+func runCompactCommand(ctx context.Context, a *Agent, args []string) error {
+	return a.Compact(ctx)
+}
+
+func runThinkingCommand(ctx context.Context, a *Agent, args []string) error {
+	a.ShowThinking = !a.ShowThinking
+	if a.ShowThinking {
+		a.Notice(NoticeSuccess, "Thinking is now shown.")
+	} else {
+		a.Notice(NoticeSuccess, "Thinking is now collapsed.")
+	}
+	return nil
+}
+
+func runExitCommand(ctx context.Context, a *Agent, args []string) error {
+	return ErrExitChat
+}
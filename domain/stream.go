@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// StreamEventType identifies the kind of incremental update received while
+// a model response is being streamed.
+type StreamEventType string
+
+const (
+	// StreamEventMessageStart marks the beginning of the response and carries its model and initial usage.
+	StreamEventMessageStart StreamEventType = "message_start"
+	// StreamEventContentBlockStart marks the beginning of a new content block.
+	StreamEventContentBlockStart StreamEventType = "content_block_start"
+	// StreamEventTextDelta carries a fragment of assistant text.
+	StreamEventTextDelta StreamEventType = "text_delta"
+	// StreamEventInputJSONDelta carries a fragment of a tool_use input JSON document.
+	StreamEventInputJSONDelta StreamEventType = "input_json_delta"
+	// StreamEventThinkingDelta carries a fragment of the model's extended thinking.
+	StreamEventThinkingDelta StreamEventType = "thinking_delta"
+	// StreamEventSignatureDelta carries the signature that verifies a thinking block.
+	StreamEventSignatureDelta StreamEventType = "signature_delta"
+	// StreamEventContentBlockStop marks the end of the current content block.
+	StreamEventContentBlockStop StreamEventType = "content_block_stop"
+	// StreamEventMessageDelta carries top-level message changes such as the stop reason and final usage.
+	StreamEventMessageDelta StreamEventType = "message_delta"
+)
+
+// StreamEvent is a single incremental update of a streamed model response.
+// Only the fields relevant to the event Type are populated.
+type StreamEvent struct {
+	Type        StreamEventType
+	Index       int    // Index of the content block the event belongs to
+	BlockType   string // Content block type for StreamEventContentBlockStart ("text", "tool_use", ...)
+	Text        string // Text fragment for StreamEventTextDelta
+	PartialJSON string // JSON fragment for StreamEventInputJSONDelta
+	ToolUseID   string // Tool use ID for a "tool_use" StreamEventContentBlockStart
+	ToolName    string // Tool name for a "tool_use" StreamEventContentBlockStart
+	Data        string // Encrypted thinking for a "redacted_thinking" StreamEventContentBlockStart
+	Thinking    string // Thinking fragment for StreamEventThinkingDelta
+	Signature   string // Signature for StreamEventSignatureDelta
+	StopReason  string // Stop reason for StreamEventMessageDelta
+	Model       string // Model for StreamEventMessageStart
+	Usage       *Usage // Token usage for StreamEventMessageStart and StreamEventMessageDelta
+}
+
+// InferenceStream is an iterator over the events of a streamed model response.
+// Callers must call Close when they are done with the stream.
+type InferenceStream interface {
+	Next() bool
+	Current() StreamEvent
+	Err() error
+	Close() error
+}
+
+// streamedBlock holds the partial state of one content block while it is streamed.
+type streamedBlock struct {
+	blockType string
+	text      strings.Builder
+	toolUseID string
+	toolName  string
+	inputJSON strings.Builder
+	thinking  strings.Builder
+	signature string
+	data      string
+}
+
+// streamAccumulator assembles streamed events into a complete assistant message.
+type streamAccumulator struct {
+	blocks     []*streamedBlock
+	stopReason string
+	model      string
+	usage      *Usage
+}
+
+// block returns the block at index, growing the block list if needed.
+func (s *streamAccumulator) block(index int) *streamedBlock {
+	for len(s.blocks) <= index {
+		s.blocks = append(s.blocks, &streamedBlock{blockType: "text"})
+	}
+	return s.blocks[index]
+}
+
+// Add applies a single stream event to the accumulated message.
+func (s *streamAccumulator) Add(event StreamEvent) {
+	switch event.Type {
+	case StreamEventMessageStart:
+		s.model = event.Model
+		if event.Usage != nil {
+			usage := *event.Usage
+			s.usage = &usage
+		}
+	case StreamEventContentBlockStart:
+		b := s.block(event.Index)
+		b.blockType = event.BlockType
+		b.toolUseID = event.ToolUseID
+		b.toolName = event.ToolName
+		b.data = event.Data
+	case StreamEventTextDelta:
+		s.block(event.Index).text.WriteString(event.Text)
+	case StreamEventInputJSONDelta:
+		s.block(event.Index).inputJSON.WriteString(event.PartialJSON)
+	case StreamEventThinkingDelta:
+		s.block(event.Index).thinking.WriteString(event.Thinking)
+	case StreamEventSignatureDelta:
+		s.block(event.Index).signature += event.Signature
+	case StreamEventMessageDelta:
+		if event.StopReason != "" {
+			s.stopReason = event.StopReason
+		}
+		if event.Usage != nil {
+			// Output tokens are reported cumulatively; input and cache tokens only by some providers
+			if s.usage == nil {
+				s.usage = &Usage{}
+			}
+			s.usage.OutputTokens = event.Usage.OutputTokens
+			if event.Usage.InputTokens > 0 {
+				s.usage.InputTokens = event.Usage.InputTokens
+			}
+			if event.Usage.CacheCreationInputTokens > 0 {
+				s.usage.CacheCreationInputTokens = event.Usage.CacheCreationInputTokens
+			}
+			if event.Usage.CacheReadInputTokens > 0 {
+				s.usage.CacheReadInputTokens = event.Usage.CacheReadInputTokens
+			}
+		}
+	}
+}
+
+// Message returns the complete assistant message assembled from the streamed events.
+func (s *streamAccumulator) Message() Message {
+	message := NewAssistantMessage()
+	message.StopReason = s.stopReason
+	message.Model = s.model
+	message.Usage = s.usage
+	for _, b := range s.blocks {
+		switch b.blockType {
+		case "text":
+			if b.text.Len() > 0 {
+				message.Content = append(message.Content, NewTextBlock(b.text.String()))
+			}
+		case "tool_use":
+			input := b.inputJSON.String()
+			if strings.TrimSpace(input) == "" {
+				// Tools without parameters stream no input deltas at all
+				input = "{}"
+			}
+			message.Content = append(message.Content, NewToolUseBlock(b.toolUseID, b.toolName, json.RawMessage(input)))
+		case "thinking":
+			message.Content = append(message.Content, NewThinkingBlock(b.thinking.String(), b.signature))
+		case "redacted_thinking":
+			message.Content = append(message.Content, NewRedactedThinkingBlock(b.data))
+		}
+	}
+	return message
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamAccumulatorAssemblesMessage(t *testing.T) {
+	events := []StreamEvent{
+		{Type: StreamEventMessageStart, Model: "claude-test", Usage: &Usage{InputTokens: 100}},
+		{Type: StreamEventContentBlockStart, Index: 0, BlockType: "thinking"},
+		{Type: StreamEventThinkingDelta, Index: 0, Thinking: "Let me "},
+		{Type: StreamEventThinkingDelta, Index: 0, Thinking: "look."},
+		{Type: StreamEventSignatureDelta, Index: 0, Signature: "sig"},
+		{Type: StreamEventContentBlockStop, Index: 0},
+		{Type: StreamEventContentBlockStart, Index: 1, BlockType: "text"},
+		{Type: StreamEventTextDelta, Index: 1, Text: "Reading "},
+		{Type: StreamEventTextDelta, Index: 1, Text: "the file."},
+		{Type: StreamEventContentBlockStop, Index: 1},
+		{Type: StreamEventContentBlockStart, Index: 2, BlockType: "tool_use", ToolUseID: "toolu_1", ToolName: "read_file"},
+		{Type: StreamEventInputJSONDelta, Index: 2, PartialJSON: `{"path":`},
+		{Type: StreamEventInputJSONDelta, Index: 2, PartialJSON: `"main.go"}`},
+		{Type: StreamEventContentBlockStop, Index: 2},
+		{Type: StreamEventMessageDelta, StopReason: StopReasonToolUse, Usage: &Usage{OutputTokens: 42}},
+	}
+
+	var accumulator streamAccumulator
+	for _, event := range events {
+		accumulator.Add(event)
+	}
+	message := accumulator.Message()
+
+	want := []ContentBlock{
+		NewThinkingBlock("Let me look.", "sig"),
+		NewTextBlock("Reading the file."),
+		NewToolUseBlock("toolu_1", "read_file", []byte(`{"path":"main.go"}`)),
+	}
+	if !reflect.DeepEqual(message.Content, want) {
+		t.Errorf("content = %+v, want %+v", message.Content, want)
+	}
+	if message.Role != RoleAssistant || message.Model != "claude-test" || message.StopReason != StopReasonToolUse {
+		t.Errorf("role, model, stop reason = %q, %q, %q", message.Role, message.Model, message.StopReason)
+	}
+	if message.Usage == nil || *message.Usage != (Usage{InputTokens: 100, OutputTokens: 42}) {
+		t.Errorf("usage = %+v, want input 100 and output 42", message.Usage)
+	}
+}
+
+func TestStreamAccumulatorToolWithoutInput(t *testing.T) {
+	var accumulator streamAccumulator
+	accumulator.Add(StreamEvent{Type: StreamEventContentBlockStart, Index: 0, BlockType: "tool_use", ToolUseID: "toolu_1", ToolName: "list_files"})
+	accumulator.Add(StreamEvent{Type: StreamEventContentBlockStop, Index: 0})
+
+	toolUses := accumulator.Message().ToolUses()
+	if len(toolUses) != 1 || string(toolUses[0].Input) != "{}" {
+		t.Errorf("tool uses = %+v, want one call with input {}", toolUses)
+	}
+}
+
+func TestStreamAccumulatorSkipsEmptyText(t *testing.T) {
+	var accumulator streamAccumulator
+	accumulator.Add(StreamEvent{Type: StreamEventContentBlockStart, Index: 0, BlockType: "text"})
+	accumulator.Add(StreamEvent{Type: StreamEventContentBlockStop, Index: 0})
+
+	if content := accumulator.Message().Content; len(content) != 0 {
+		t.Errorf("content = %+v, want none", content)
+	}
+}
@@ -1,20 +1,37 @@
 package domain
 
 import (
+	"context"
 	"encoding/json"
-
-	"github.com/anthropics/anthropic-sdk-go"
+	"time"
 )
 
+// ToolInputSchema is the JSON schema describing the input object a tool expects.
+type ToolInputSchema struct {
+	Type       string   `json:"type"`
+	Properties any      `json:"properties,omitempty"`
+	Required   []string `json:"required,omitempty"`
+}
+
 // ToolDefinition represents a tool that can be used by the agent.
 // It includes the tool's name, a description of what it does,
 // the schema for the input it expects, and the function to execute
-// when the tool is called.
+// when the tool is called. Tools marked ReadOnly have no side effects
+// and may be executed concurrently with each other. The function receives
+// a context that is cancelled when the tool's Timeout expires or the agent stops.
+// Tools that modify files may set Preview to compute the change without making it,
+// so that the user can review it before the tool runs, and Revise to make the change
+// with content the user edited during the review.
 type ToolDefinition struct {
-	Name        string                         `json:"name"`
-	Description string                         `json:"description"`
-	InputSchema anthropic.ToolInputSchemaParam `json:"input_schema"`
-	Function    func(input json.RawMessage) (string, error)
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema ToolInputSchema `json:"input_schema"`
+	ReadOnly    bool            `json:"-"`
+	Timeout     time.Duration   `json:"-"` // 0 uses the repository default
+	Function    func(ctx context.Context, input json.RawMessage) (string, error)
+	Preview     func(input json.RawMessage) (FileChange, error) `json:"-"` // nil if the tool cannot be previewed
+	// Revise returns the input of a call that writes content instead of the previewed content; nil if the change cannot be edited
+	Revise func(input json.RawMessage, content string) (json.RawMessage, error) `json:"-"`
 }
 
 // ToolRepository defines the interface for interacting with tools.
@@ -24,6 +41,5 @@ type ToolRepository interface {
 
 	FindToolByName(name string) (ToolDefinition, bool)
 
-	ExecuteTool(id, name string, input json.RawMessage) anthropic.ContentBlockParamUnion
+	ExecuteTool(ctx context.Context, id, name string, input json.RawMessage) ContentBlock
 }
-
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxParallelTools is the default number of read-only tool calls executed concurrently.
+const DefaultMaxParallelTools = 4
+
+// executeTools executes the tool calls of one assistant message and returns their results
+// in the original order.
+//
+// Consecutive read-only tool calls run concurrently on a bounded worker pool. Tool calls
+// that may mutate state run on their own, after all preceding calls have finished and
+// before any following call starts, so the model observes the effects in the order it asked for.
+func (a *Agent) executeTools(ctx context.Context, toolUses []ContentBlock) []ContentBlock {
+	results := make([]ContentBlock, len(toolUses))
+
+	var batch []int // Indexes of pending consecutive read-only tool calls
+	for i, toolUse := range toolUses {
+		if a.isReadOnlyTool(toolUse.Name) {
+			batch = append(batch, i)
+			continue
+		}
+		a.executeConcurrently(ctx, toolUses, batch, results)
+		batch = nil
+		results[i] = a.executeTool(ctx, toolUse)
+	}
+	a.executeConcurrently(ctx, toolUses, batch, results)
+
+	return results
+}
+
+// executeConcurrently executes the tool calls at the given indexes concurrently,
+// with at most MaxParallelTools running at once, storing each result at its index.
+func (a *Agent) executeConcurrently(ctx context.Context, toolUses []ContentBlock, indexes []int, results []ContentBlock) {
+	if len(indexes) == 1 || a.MaxParallelTools <= 1 {
+		for _, i := range indexes {
+			results[i] = a.executeTool(ctx, toolUses[i])
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, a.MaxParallelTools)
+	for _, i := range indexes {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = a.executeTool(ctx, toolUses[i])
+		}(i)
+	}
+	wg.Wait()
+}
+
+// executeTool executes a single tool call through the tool repository, reporting its start and result.
+// A file change the tool would make is previewed first and, if the agent has an Approver,
+// only made once the user approves it, possibly with edits of their own.
+func (a *Agent) executeTool(ctx context.Context, toolUse ContentBlock) ContentBlock {
+	// Step 3: Act - Execute the tool
+	change, previewed := a.previewTool(toolUse)
+	diff := ""
+	if previewed {
+		diff = change.Diff()
+	}
+	a.Emit(Event{Type: EventToolCallStarted, ToolUseID: toolUse.ID, ToolName: toolUse.Name, Input: toolUse.Input, Diff: diff})
+	start := time.Now()
+
+	var result ContentBlock
+	decision := ApprovalDecision{Approved: true}
+	if previewed && a.Approver != nil {
+		decision = a.approve(ctx, ApprovalRequest{ToolUse: toolUse, Change: change, Diff: diff})
+	}
+	switch {
+	case !decision.Approved:
+		result = rejectionResult(toolUse, decision)
+	case decision.Edited:
+		revised, err := a.reviseTool(toolUse, decision.Content)
+		if err != nil {
+			result = NewToolResultBlock(toolUse.ID, fmt.Sprintf("Error applying the user's edits: %v", err), true)
+			break
+		}
+		result = a.ToolRepository.ExecuteTool(ctx, revised.ID, revised.Name, revised.Input)
+		result = editedResult(result, change, decision.Content)
+	default:
+		result = a.ToolRepository.ExecuteTool(ctx, toolUse.ID, toolUse.Name, toolUse.Input)
+	}
+	a.Emit(Event{
+		Type:      EventToolCallFinished,
+		ToolUseID: toolUse.ID,
+		ToolName:  toolUse.Name,
+		Output:    result.Content,
+		IsError:   result.IsError,
+		Duration:  time.Since(start),
+	})
+	return result
+}
+
+// isReadOnlyTool reports whether the named tool is declared free of side effects.
+// Unknown tools are treated as mutating.
+func (a *Agent) isReadOnlyTool(name string) bool {
+	tool, found := a.ToolRepository.FindToolByName(name)
+	return found && tool.ReadOnly
+}
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingToolRepository executes fake tools that sleep for a given time and records
+// the order in which tool calls start and finish.
+type recordingToolRepository struct {
+	tools  map[string]ToolDefinition
+	delays map[string]time.Duration // Tool call ID -> execution time
+
+	mu  sync.Mutex
+	log []string // "start <id>" and "finish <id>" in order
+}
+
+func (r *recordingToolRepository) GetAllTools() []ToolDefinition {
+	var tools []ToolDefinition
+	for _, tool := range r.tools {
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+func (r *recordingToolRepository) FindToolByName(name string) (ToolDefinition, bool) {
+	tool, found := r.tools[name]
+	return tool, found
+}
+
+func (r *recordingToolRepository) ExecuteTool(ctx context.Context, id, name string, input json.RawMessage) ContentBlock {
+	r.record("start " + id)
+	time.Sleep(r.delays[id])
+	r.record("finish " + id)
+	return NewToolResultBlock(id, name+" "+id, false)
+}
+
+func (r *recordingToolRepository) record(entry string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = append(r.log, entry)
+}
+
+// position returns the index of entry in the log, or -1.
+func (r *recordingToolRepository) position(entry string) int {
+	for i, e := range r.log {
+		if e == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestExecuteToolsOrdering(t *testing.T) {
+	repository := &recordingToolRepository{
+		tools: map[string]ToolDefinition{
+			"read_file":  {Name: "read_file", ReadOnly: true},
+			"edit_file":  {Name: "edit_file"},
+			"list_files": {Name: "list_files", ReadOnly: true},
+		},
+		delays: map[string]time.Duration{
+			"1": 30 * time.Millisecond,
+			"2": 10 * time.Millisecond,
+			"3": 0,
+			"4": 20 * time.Millisecond,
+			"5": 0,
+		},
+	}
+	agent := NewAgent(nil, nil, repository, nil, nil)
+	agent.MaxParallelTools = 4
+
+	toolUses := []ContentBlock{
+		NewToolUseBlock("1", "read_file", json.RawMessage(`{}`)),
+		NewToolUseBlock("2", "read_file", json.RawMessage(`{}`)),
+		NewToolUseBlock("3", "edit_file", json.RawMessage(`{}`)),
+		NewToolUseBlock("4", "list_files", json.RawMessage(`{}`)),
+		NewToolUseBlock("5", "read_file", json.RawMessage(`{}`)),
+	}
+	results := agent.executeTools(context.Background(), toolUses)
+
+	if len(results) != len(toolUses) {
+		t.Fatalf("got %d results, want %d", len(results), len(toolUses))
+	}
+	for i, result := range results {
+		if result.ToolUseID != toolUses[i].ID {
+			t.Errorf("result %d answers tool call %s, want %s", i, result.ToolUseID, toolUses[i].ID)
+		}
+	}
+
+	// The write starts only after the reads before it finished, and before the reads after it start
+	edit := repository.position("start 3")
+	for _, id := range []string{"1", "2"} {
+		if finish := repository.position("finish " + id); finish > edit {
+			t.Errorf("read %s finished after the edit started: %v", id, repository.log)
+		}
+	}
+	for _, id := range []string{"4", "5"} {
+		if start := repository.position("start " + id); start < repository.position("finish 3") {
+			t.Errorf("read %s started before the edit finished: %v", id, repository.log)
+		}
+	}
+}
+
+func TestExecuteToolsUnknownToolIsSequential(t *testing.T) {
+	repository := &recordingToolRepository{
+		tools:  map[string]ToolDefinition{"read_file": {Name: "read_file", ReadOnly: true}},
+		delays: map[string]time.Duration{"1": 20 * time.Millisecond},
+	}
+	agent := NewAgent(nil, nil, repository, nil, nil)
+
+	agent.executeTools(context.Background(), []ContentBlock{
+		NewToolUseBlock("1", "read_file", json.RawMessage(`{}`)),
+		NewToolUseBlock("2", "unknown_tool", json.RawMessage(`{}`)),
+	})
+
+	if repository.position("start 2") < repository.position("finish 1") {
+		t.Errorf("unknown tool ran concurrently with a read: %v", repository.log)
+	}
+}
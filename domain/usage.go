@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrBudgetExceeded is returned by Agent.Run when the session exceeds its token or cost budget.
+var ErrBudgetExceeded = errors.New("session budget exceeded")
+
+// Usage is the token usage reported for one or more inference calls.
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Add accumulates other into u.
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Total returns the total number of tokens, including cache reads and writes.
+func (u Usage) Total() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// CacheHitRate returns the share of prompt tokens that were read from the prompt cache.
+// It returns false if no prompt tokens were used yet.
+func (u Usage) CacheHitRate() (float64, bool) {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	if prompt == 0 {
+		return 0, false
+	}
+	return float64(u.CacheReadInputTokens) / float64(prompt), true
+}
+
+// ModelPrice is the price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// PriceTable maps model name prefixes to their prices.
+// The longest matching prefix wins, so "gpt-4o-mini" can be priced apart from "gpt-4o".
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable returns the built-in prices in USD per million tokens.
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+		"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+		"claude-3-opus":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+		"claude-3-haiku":    {Input: 0.25, Output: 1.25, CacheWrite: 0.30, CacheRead: 0.03},
+		"gpt-4o":            {Input: 2.50, Output: 10, CacheRead: 1.25},
+		"gpt-4o-mini":       {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	}
+}
+
+// Lookup returns the price of the given model, matching by longest prefix.
+func (t PriceTable) Lookup(model string) (ModelPrice, bool) {
+	var price ModelPrice
+	matched := ""
+	for prefix, p := range t {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			price = p
+			matched = prefix
+		}
+	}
+	return price, matched != ""
+}
+
+// Cost returns the cost in USD of the given usage of the given model.
+// It returns false if the model has no known price.
+func (t PriceTable) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	cost := float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheCreationInputTokens)*price.CacheWrite +
+		float64(usage.CacheReadInputTokens)*price.CacheRead
+	return cost / 1e6, true
+}
+
+// UsageTotals is the accumulated usage and cost of a number of inference calls.
+type UsageTotals struct {
+	Usage
+	Cost     float64
+	Requests int
+	Unpriced bool // At least one call used a model without a known price
+}
+
+// UsageTracker totals token usage and cost per turn and per session,
+// and enforces optional session budgets.
+type UsageTracker struct {
+	Prices    PriceTable
+	MaxCost   float64 // Maximum session cost in USD; 0 means unlimited
+	MaxTokens int64   // Maximum total session tokens; 0 means unlimited
+
+	Turn    UsageTotals
+	Session UsageTotals
+}
+
+// NewUsageTracker creates a UsageTracker using the given price table.
+func NewUsageTracker(prices PriceTable) *UsageTracker {
+	return &UsageTracker{Prices: prices}
+}
+
+// StartTurn resets the per-turn totals.
+func (t *UsageTracker) StartTurn() {
+	t.Turn = UsageTotals{}
+}
+
+// Add records the usage of a single inference call with the given model.
+func (t *UsageTracker) Add(model string, usage Usage) {
+	cost, priced := t.Prices.Cost(model, usage)
+	for _, totals := range []*UsageTotals{&t.Turn, &t.Session} {
+		totals.Add(usage)
+		totals.Cost += cost
+		totals.Requests++
+		totals.Unpriced = totals.Unpriced || !priced
+	}
+}
+
+// CheckBudget returns an error wrapping ErrBudgetExceeded if the session exceeded a budget.
+func (t *UsageTracker) CheckBudget() error {
+	if t.MaxCost > 0 && t.Session.Cost > t.MaxCost {
+		return fmt.Errorf("%w: cost $%.4f exceeds the limit of $%.4f", ErrBudgetExceeded, t.Session.Cost, t.MaxCost)
+	}
+	if t.MaxTokens > 0 && t.Session.Total() > t.MaxTokens {
+		return fmt.Errorf("%w: %d tokens exceed the limit of %d", ErrBudgetExceeded, t.Session.Total(), t.MaxTokens)
+	}
+	return nil
+}
+
+// Report returns a human-readable summary of the turn and session usage.
+func (t *UsageTracker) Report() string {
+	var report strings.Builder
+	report.WriteString("Token usage:\n")
+	report.WriteString(formatUsageTotals("Last turn", t.Turn))
+	report.WriteString(formatUsageTotals("Session", t.Session))
+	if rate, ok := t.Session.CacheHitRate(); ok {
+		fmt.Fprintf(&report, "  Cache:     %.0f%% of session prompt tokens were read from the prompt cache\n", rate*100)
+	}
+	if t.MaxCost > 0 || t.MaxTokens > 0 {
+		fmt.Fprintf(&report, "  Budget:    $%.4f max cost, %d max tokens (0 = unlimited)\n", t.MaxCost, t.MaxTokens)
+	}
+	return report.String()
+}
+
+// formatUsageTotals formats a single line of a usage report.
+func formatUsageTotals(label string, totals UsageTotals) string {
+	cost := fmt.Sprintf("$%.4f", totals.Cost)
+	if totals.Unpriced {
+		cost += " (some models have no known price)"
+	}
+	return fmt.Sprintf("  %-10s %d requests, %d input, %d output, %d cache write, %d cache read tokens, %s\n",
+		label+":", totals.Requests, totals.InputTokens, totals.OutputTokens,
+		totals.CacheCreationInputTokens, totals.CacheReadInputTokens, cost)
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// scriptedAIClient answers inference requests with the given messages in order.
+type scriptedAIClient struct {
+	responses []Message
+}
+
+func (c *scriptedAIClient) RunInference(ctx context.Context, request InferenceRequest) (*Message, error) {
+	if len(c.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	message := c.responses[0]
+	c.responses = c.responses[1:]
+	return &message, nil
+}
+
+func (c *scriptedAIClient) StreamInference(ctx context.Context, request InferenceRequest) (InferenceStream, error) {
+	return nil, errors.New("streaming is not supported")
+}
+
+// scriptedUserMessages provides the given user messages in order.
+type scriptedUserMessages []string
+
+func (m *scriptedUserMessages) GetUserMessage() (string, bool) {
+	if len(*m) == 0 {
+		return "", false
+	}
+	message := (*m)[0]
+	*m = (*m)[1:]
+	return message, true
+}
+
+// noTools is a ToolRepository without tools.
+type noTools struct{}
+
+func (noTools) GetAllTools() []ToolDefinition                     { return nil }
+func (noTools) FindToolByName(name string) (ToolDefinition, bool) { return ToolDefinition{}, false }
+func (noTools) ExecuteTool(ctx context.Context, id, name string, input json.RawMessage) ContentBlock {
+	return NewToolResultBlock(id, "executed", false)
+}
+
+func TestRunStopsWhenBudgetIsExceeded(t *testing.T) {
+	response := NewAssistantMessage(NewToolUseBlock("toolu_1", "read_file", json.RawMessage(`{"path":"a.go"}`)))
+	response.StopReason = StopReasonToolUse
+	response.Usage = &Usage{InputTokens: 800, OutputTokens: 300}
+
+	users := scriptedUserMessages{"Read a.go", "Never asked"}
+	agent := NewAgent(&scriptedAIClient{responses: []Message{response}}, &users, noTools{}, nil, nil)
+	agent.Streaming = false
+	agent.Usage.MaxTokens = 1000
+
+	if err := agent.Run(context.Background()); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Run = %v, want ErrBudgetExceeded", err)
+	}
+
+	// The tool call is answered without being executed, so the conversation stays valid
+	if len(agent.Conversation) != 3 {
+		t.Fatalf("conversation = %+v, want the request, the tool call and its result", agent.Conversation)
+	}
+	result := agent.Conversation[2].Content[0]
+	if result.Type != ContentBlockToolResult || result.ToolUseID != "toolu_1" || !result.IsError || result.Content == "executed" {
+		t.Errorf("last message = %+v, want an error result for the unexecuted tool call", agent.Conversation[2])
+	}
+	if len(users) != 1 {
+		t.Errorf("Run asked for another message after the budget was exceeded")
+	}
+}
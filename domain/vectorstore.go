@@ -8,4 +8,8 @@ type VectorStore interface {
 	Upsert(ctx context.Context, snippets []Snippet) error
 	// Query searches for snippets similar to the given text.
 	Query(ctx context.Context, embedding Embedding, k int) ([]Snippet, error)
+	// DeleteSnippetsExcept removes the snippets of indexed files except those with the given IDs,
+	// e.g. the stale snippets of changed and deleted files after the workspace was indexed again.
+	// Entries that do not belong to a file, such as stored memories, are kept.
+	DeleteSnippetsExcept(ctx context.Context, keepIDs []string) error
 }
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// WorkspaceRoot is a directory the agent works in. The default root has no name and is addressed
+// with plain relative paths; named roots, e.g. a shared library next to a service repository,
+// are addressed as "name:path".
+type WorkspaceRoot struct {
+	Name string // Empty for the default root
+	Dir  string
+}
+
+// rootNamePattern matches the names a workspace root can have.
+var rootNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidRootName reports whether name can name a workspace root.
+func ValidRootName(name string) bool {
+	return rootNamePattern.MatchString(name)
+}
+
+// SplitRootPath splits a "name:path" path into the root name and the path within that root.
+// Paths without a root name prefix belong to the default root, whose name is empty.
+func SplitRootPath(path string) (root, rel string) {
+	name, rest, found := strings.Cut(path, ":")
+	if !found || !ValidRootName(name) {
+		return "", path
+	}
+	return name, rest
+}
+
+// JoinRootPath returns the path of rel within the named root, the inverse of SplitRootPath.
+func JoinRootPath(root, rel string) string {
+	if root == "" {
+		return rel
+	}
+	return root + ":" + rel
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
+	"code-ai-editor/infrastructure/render"
+)
+
+// parseFlags parses the arguments of a subcommand.
+// Invalid flags end the process with exit status 2, like the standard flag package does.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return withExitCode(exitUsage, err)
+	}
+	return nil
+}
+
+// configPathUsage describes the -config flag.
+const configPathUsage = "Project YAML config file, applied over the user config file and below the environment and flags (a missing file is ignored)"
+
+// loadConfig loads the configuration from the config files, with the project config file at
+// projectPath, and the environment, applies the flags given on the command line with override
+// (which may be nil), and validates the result.
+func loadConfig(projectPath string, override func(*config.Config)) (config.Config, error) {
+	cfg, err := config.Load(projectPath)
+	if err != nil {
+		return config.Config{}, withExitCode(exitUsage, err)
+	}
+	if override != nil {
+		override(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, withExitCode(exitUsage, err)
+	}
+	return cfg, nil
+}
+
+// configOptions are the flags that select the config file and the workspace roots.
+// The workspace flags override the config files and environment only when given explicitly.
+type configOptions struct {
+	config    string
+	workspace string
+	roots     rootsFlag
+}
+
+// register adds the config flags to fs.
+func (o *configOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", config.DefaultProjectPath, configPathUsage)
+	fs.StringVar(&o.workspace, "workspace", "", "Default workspace root, which the agent works in and the indexer indexes. Overrides the config file and $WORKSPACE_DIR; defaults to the root of the current git repository")
+	fs.Var(&o.roots, "root", "Named workspace root as name=dir, whose files the tools address as 'name:path' (repeatable). Replaces the roots of the config files and $WORKSPACE_ROOTS")
+}
+
+// load returns the configuration from the config files and the environment,
+// with the workspace flags given on the command line taking precedence.
+func (o *configOptions) load(fs *flag.FlagSet) (config.Config, error) {
+	return loadConfig(o.config, func(cfg *config.Config) {
+		if o.override(fs, cfg) {
+			cfg.Sources = append(cfg.Sources, "flags")
+		}
+	})
+}
+
+// override applies the workspace flags that were explicitly set to cfg and reports whether there were any.
+func (o *configOptions) override(fs *flag.FlagSet, cfg *config.Config) bool {
+	overridden := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "workspace":
+			cfg.Workspace = o.workspace
+		case "root":
+			cfg.Roots = o.roots
+		default:
+			return
+		}
+		overridden = true
+	})
+	return overridden
+}
+
+// rootsFlag collects the named workspace roots given with repeated -root flags.
+type rootsFlag map[string]string
+
+func (r *rootsFlag) String() string {
+	pairs := make([]string, 0, len(*r))
+	for name, dir := range *r {
+		pairs = append(pairs, name+"="+dir)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (r *rootsFlag) Set(value string) error {
+	name, dir, ok := strings.Cut(value, "=")
+	if !ok || name == "" || dir == "" {
+		return fmt.Errorf("expected name=dir, got %q", value)
+	}
+	if *r == nil {
+		*r = make(rootsFlag)
+	}
+	(*r)[name] = dir
+	return nil
+}
+
+// modelOptions are the flags that select the config file, the workspace roots, the AI provider,
+// the model and its generation parameters. They override the config files and environment only
+// when given explicitly.
+type modelOptions struct {
+	configOptions
+	provider       string
+	model          string
+	maxTokens      int
+	temperature    float64
+	topP           float64
+	stop           string
+	thinkingBudget int
+}
+
+// register adds the model flags to fs.
+func (o *modelOptions) register(fs *flag.FlagSet) {
+	o.configOptions.register(fs)
+	fs.StringVar(&o.provider, "provider", "", "AI provider to chat with: 'anthropic' or 'openai' (any OpenAI-compatible endpoint). Overrides the config file and $AI_PROVIDER; defaults to 'anthropic'")
+	fs.StringVar(&o.model, "model", "", "Model to chat with. Overrides the config file and $AI_MODEL; defaults to the provider's default model")
+	fs.IntVar(&o.maxTokens, "max-tokens", 0, "Maximum output tokens per response (0 = default)")
+	fs.Float64Var(&o.temperature, "temperature", 0, "Sampling temperature (unset = provider default)")
+	fs.Float64Var(&o.topP, "top-p", 0, "Nucleus sampling probability (unset = provider default)")
+	fs.StringVar(&o.stop, "stop", "", "Comma-separated stop sequences")
+	fs.IntVar(&o.thinkingBudget, "thinking-budget", 0, "Enable extended thinking with this many tokens to think with (Anthropic only, 0 = disabled)")
+}
+
+// load returns the configuration from the config files and the environment,
+// with the workspace and model flags given on the command line taking precedence.
+func (o *modelOptions) load(fs *flag.FlagSet) (config.Config, error) {
+	return loadConfig(o.config, func(cfg *config.Config) {
+		if o.override(fs, cfg) {
+			cfg.Sources = append(cfg.Sources, "flags")
+		}
+	})
+}
+
+// override applies the workspace and model flags that were explicitly set to cfg and reports
+// whether there were any.
+func (o *modelOptions) override(fs *flag.FlagSet, cfg *config.Config) bool {
+	overridden := o.configOptions.override(fs, cfg)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "provider":
+			cfg.Provider = o.provider
+		case "model":
+			cfg.Model.Model = o.model
+		case "max-tokens":
+			cfg.Model.MaxTokens = o.maxTokens
+		case "temperature":
+			temperature := o.temperature
+			cfg.Model.Temperature = &temperature
+		case "top-p":
+			topP := o.topP
+			cfg.Model.TopP = &topP
+		case "stop":
+			cfg.Model.StopSequences = config.ParseStopSequences(o.stop)
+		case "thinking-budget":
+			cfg.Model.ThinkingBudget = o.thinkingBudget
+		default:
+			return
+		}
+		overridden = true
+	})
+	return overridden
+}
+
+// agentOptions are the flags shared by the commands that run the agent. Like the model flags,
+// they override the config files and environment only when given explicitly; their defaults
+// are the built-in settings.
+type agentOptions struct {
+	model             modelOptions
+	render            string
+	stream            bool
+	showThinking      bool
+	compactThreshold  int
+	maxCost           float64
+	maxTokensTotal    int64
+	maxSteps          int
+	maxRepeatedErrors int
+	parallelTools     int
+	maxContinuations  int
+	maxAttempts       int
+	toolTimeout       time.Duration
+	toolTimeouts      toolTimeoutsFlag
+	priceTable        string
+}
+
+// register adds the agent flags, including the model flags, to fs.
+func (o *agentOptions) register(fs *flag.FlagSet) {
+	o.model.register(fs)
+	defaults := config.Defaults()
+	fs.StringVar(&o.render, "render", defaults.Output.Render, "Output format: 'pretty' (colored), 'plain' (no colors), 'jsonl' (one JSON event per line) or 'auto' (pretty on a terminal unless NO_COLOR is set, plain otherwise)")
+	fs.BoolVar(&o.stream, "stream", defaults.Output.Stream, "Stream model output token-by-token as it arrives (use -stream=false to wait for complete replies)")
+	fs.BoolVar(&o.showThinking, "show-thinking", defaults.Output.ShowThinking, "Show the model's thinking dimmed (use -show-thinking=false to collapse it; toggle with /thinking)")
+	fs.IntVar(&o.compactThreshold, "compact-threshold", defaults.Agent.CompactThreshold, "Estimated prompt tokens above which older turns are summarized (0 disables automatic compaction)")
+	fs.Float64Var(&o.maxCost, "max-cost", defaults.Budget.MaxCost, "Stop the session once its cost exceeds this many USD (0 = unlimited)")
+	fs.Int64Var(&o.maxTokensTotal, "max-tokens-total", defaults.Budget.MaxTokens, "Stop the session once it has used this many tokens in total (0 = unlimited)")
+	fs.IntVar(&o.maxSteps, "max-steps", defaults.Agent.MaxSteps, "Inference steps per turn before asking whether to continue (0 = unlimited)")
+	fs.IntVar(&o.maxRepeatedErrors, "max-repeated-errors", defaults.Agent.MaxRepeatedErrors, "Identical failing tool calls per turn before asking whether to continue (0 = unlimited)")
+	fs.IntVar(&o.parallelTools, "parallel-tools", defaults.Agent.ParallelTools, "Read-only tool calls executed concurrently (1 = run all tools serially)")
+	fs.IntVar(&o.maxContinuations, "max-continuations", defaults.Agent.MaxContinuations, "Times a response cut off at the max tokens limit is continued before giving up")
+	fs.IntVar(&o.maxAttempts, "max-attempts", defaults.Agent.MaxAttempts, "Attempts per inference call on rate limits, overload and server errors (1 disables retries)")
+	fs.DurationVar(&o.toolTimeout, "tool-timeout", defaults.Tools.Timeout, "Timeout for tools that do not declare their own")
+	fs.Var(&o.toolTimeouts, "tool-timeouts", "Per-tool timeouts overriding all others, e.g. 'search_web=10s,qdrant_upsert=2m'")
+	fs.StringVar(&o.priceTable, "price-table", defaults.Budget.PriceTable, "JSON file mapping model name prefixes to {input, output, cache_write, cache_read} prices in USD per million tokens")
+}
+
+// load returns the configuration from the config files and the environment,
+// with the workspace, model and agent flags given on the command line taking precedence.
+func (o *agentOptions) load(fs *flag.FlagSet) (config.Config, error) {
+	return loadConfig(o.model.config, func(cfg *config.Config) {
+		if o.override(fs, cfg) {
+			cfg.Sources = append(cfg.Sources, "flags")
+		}
+	})
+}
+
+// override applies the workspace, model and agent flags that were explicitly set to cfg and
+// reports whether there were any.
+func (o *agentOptions) override(fs *flag.FlagSet, cfg *config.Config) bool {
+	overridden := o.model.override(fs, cfg)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "render":
+			cfg.Output.Render = o.render
+		case "stream":
+			cfg.Output.Stream = o.stream
+		case "show-thinking":
+			cfg.Output.ShowThinking = o.showThinking
+		case "compact-threshold":
+			cfg.Agent.CompactThreshold = o.compactThreshold
+		case "max-cost":
+			cfg.Budget.MaxCost = o.maxCost
+		case "max-tokens-total":
+			cfg.Budget.MaxTokens = o.maxTokensTotal
+		case "max-steps":
+			cfg.Agent.MaxSteps = o.maxSteps
+		case "max-repeated-errors":
+			cfg.Agent.MaxRepeatedErrors = o.maxRepeatedErrors
+		case "parallel-tools":
+			cfg.Agent.ParallelTools = o.parallelTools
+		case "max-continuations":
+			cfg.Agent.MaxContinuations = o.maxContinuations
+		case "max-attempts":
+			cfg.Agent.MaxAttempts = o.maxAttempts
+		case "tool-timeout":
+			cfg.Tools.Timeout = o.toolTimeout
+		case "tool-timeouts":
+			cfg.Tools.Timeouts = o.toolTimeouts
+		case "price-table":
+			cfg.Budget.PriceTable = o.priceTable
+		default:
+			return
+		}
+		overridden = true
+	})
+	return overridden
+}
+
+// toolTimeoutsFlag holds the per-tool timeouts given with -tool-timeouts.
+type toolTimeoutsFlag map[string]time.Duration
+
+func (t *toolTimeoutsFlag) String() string {
+	pairs := make([]string, 0, len(*t))
+	for name, timeout := range *t {
+		pairs = append(pairs, name+"="+timeout.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (t *toolTimeoutsFlag) Set(value string) error {
+	timeouts, err := config.ParseToolTimeouts(value)
+	if err != nil {
+		return err
+	}
+	*t = timeouts
+	return nil
+}
+
+// newEventSink creates the renderer selected with output.render, writing to out. file:line
+// references are linked relative to the current directory or the workspace.
+func newEventSink(cfg config.Config, out *os.File) (domain.EventSink, error) {
+	events, err := render.New(cfg.Output.Render, out, ".", cfg.Workspace)
+	if err != nil {
+		return nil, withExitCode(exitUsage, fmt.Errorf("invalid render format: %w", err))
+	}
+	return events, nil
+}
+
+// colored reports whether the configured output format colors what is written to out.
+func colored(cfg config.Config, out *os.File) bool {
+	switch cfg.Output.Render {
+	case render.FormatPretty:
+		return true
+	case "", render.FormatAuto:
+		return render.ColorEnabled(out)
+	}
+	return false
+}
@@ -11,6 +11,8 @@ require (
 	github.com/sashabaranov/go-openai v1.38.2
 	google.golang.org/grpc v1.66.0
 	google.golang.org/protobuf v1.34.2
+	golang.org/x/sys v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -23,8 +25,6 @@ require (
 	github.com/tidwall/sjson v1.2.5 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	golang.org/x/net v0.28.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240827150818-7e3bb234dfed // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
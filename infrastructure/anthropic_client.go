@@ -2,85 +2,386 @@ package infrastructure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
-	"github.com/joho/godotenv"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 
 	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
 )
 
 // AnthropicClient is a wrapper around the Anthropic API client.
 // It provides a simplified interface for interacting with the Anthropic API.
 type AnthropicClient struct {
-	client *anthropic.Client
+	client        *anthropic.Client
+	promptCaching bool // Whether to mark cache breakpoints on the tools, system prompt and history
 }
 
 // NewAnthropicClient creates a new Anthropic client.
 //
-// It loads the environment variables from the .env.local file.
-// It returns an error if the ANTHROPIC_API_KEY environment variable is not set.
+// It returns an error if no API key is configured (ANTHROPIC_API_KEY).
+// Prompt caching is used if enabled in the settings.
 //
 // Returns:
 //
 //	*AnthropicClient: A pointer to the new Anthropic client.
 //	error: An error if the client could not be created.
-func NewAnthropicClient() (*AnthropicClient, error) {
-	_ = godotenv.Load(".env.local")
-
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
+func NewAnthropicClient(settings config.AnthropicConfig) (*AnthropicClient, error) {
+	if settings.APIKey == "" {
 		return nil, fmt.Errorf("anthropic api key is not set")
 	}
 
 	client := anthropic.NewClient(
-		option.WithAPIKey(apiKey),
+		option.WithAPIKey(settings.APIKey),
+		// Retries are handled by RetryingAIClient, which reports them to the user
+		option.WithMaxRetries(0),
 	)
 
 	return &AnthropicClient{
-		client: &client,
+		client:        &client,
+		promptCaching: settings.PromptCaching,
 	}, nil
 }
 
 // RunInference sends a conversation to the Anthropic API and returns the response.
 //
-// It takes a context, a slice of anthropic.MessageParam representing the conversation history,
-// and a slice of domain.ToolDefinition representing the available tools.
-// It converts the domain.ToolDefinition to anthropic.ToolParam and sends the request to the Anthropic API.
-// It then prints the text content of the response to the console.
+// It takes a context and a domain.InferenceRequest holding the system prompt, the conversation
+// history, the available tools and the model settings.
+// It converts them to their Anthropic SDK counterparts, sends the request to the Anthropic API
+// and converts the response back into a domain.Message.
 //
 // Parameters:
 //   - ctx: The context for the API call.
-//   - conversation: A slice of anthropic.MessageParam representing the conversation history.
-//   - tools: A slice of domain.ToolDefinition representing the available tools.
+//   - request: The system prompt, conversation, tools and model settings to send.
 //
 // Returns:
-//   - *anthropic.Message: The response from the Anthropic API.
+//   - *domain.Message: The assistant response from the Anthropic API.
 //   - error: An error if the API call fails.
-func (a *AnthropicClient) RunInference(ctx context.Context, conversation []anthropic.MessageParam, tools []domain.ToolDefinition) (*anthropic.Message, error) {
+func (a *AnthropicClient) RunInference(ctx context.Context, request domain.InferenceRequest) (*domain.Message, error) {
+	message, err := a.client.Messages.New(ctx, newMessageParams(request, a.promptCaching))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fromAnthropicMessage(message), nil
+}
+
+// StreamInference sends a conversation to the Anthropic streaming endpoint and returns
+// an iterator over the incremental response events.
+//
+// Parameters:
+//   - ctx: The context for the API call.
+//   - request: The system prompt, conversation, tools and model settings to send.
+//
+// Returns:
+//   - domain.InferenceStream: The stream of response events.
+//   - error: An error if the stream could not be opened.
+func (a *AnthropicClient) StreamInference(ctx context.Context, request domain.InferenceRequest) (domain.InferenceStream, error) {
+	stream := a.client.Messages.NewStreaming(ctx, newMessageParams(request, a.promptCaching))
+	if err := stream.Err(); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return &anthropicStream{stream: stream}, nil
+}
+
+// defaultAnthropicModel is used when the model settings do not name a model.
+const defaultAnthropicModel = anthropic.ModelClaude3_7SonnetLatest
+
+// newMessageParams builds the request parameters shared by RunInference and StreamInference.
+// It converts the domain.ToolDefinition to anthropic.ToolParam and the domain.Message to anthropic.MessageParam,
+// and applies the model settings, leaving unset parameters to the API defaults.
+// With caching enabled, cache breakpoints are placed as described at addCacheBreakpoints.
+func newMessageParams(request domain.InferenceRequest, caching bool) anthropic.MessageNewParams {
 	anthropicTools := []anthropic.ToolUnionParam{}
-	for _, tool := range tools {
+	for _, tool := range request.Tools {
+		inputSchema := anthropic.ToolInputSchemaParam{
+			Properties: tool.InputSchema.Properties,
+			Type:       "object",
+		}
+		if len(tool.InputSchema.Required) > 0 {
+			// The SDK has no field for required properties; without them every parameter is optional.
+			// The ExtraFields field is not encoded by this SDK version, WithExtraFields is
+			inputSchema.WithExtraFields(map[string]interface{}{"required": tool.InputSchema.Required})
+		}
 		anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
 			OfTool: &anthropic.ToolParam{
 				Name:        tool.Name,
 				Description: anthropic.String(tool.Description),
-				InputSchema: tool.InputSchema,
+				InputSchema: inputSchema,
 			},
 		})
 	}
 
-	message, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.ModelClaude3_7SonnetLatest,
-		MaxTokens: int64(4096),
-		Messages:  conversation,
-		Tools:     anthropicTools,
-	})
+	settings := request.Settings
+	model := anthropic.Model(defaultAnthropicModel)
+	if settings.Model != "" {
+		model = anthropic.Model(settings.Model)
+	}
+	maxTokens := settings.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = domain.DefaultMaxTokens
+	}
 
-	if err != nil {
-		return nil, err
+	if settings.ThinkingBudget > 0 && maxTokens <= settings.ThinkingBudget {
+		// The thinking budget counts towards max_tokens, which must leave room for the answer
+		maxTokens = settings.ThinkingBudget + domain.DefaultMaxTokens
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:         model,
+		MaxTokens:     int64(maxTokens),
+		Messages:      toAnthropicMessages(request.Conversation),
+		Tools:         anthropicTools,
+		StopSequences: settings.StopSequences,
+	}
+	if settings.ThinkingBudget > 0 {
+		params.Thinking = anthropic.ThinkingConfigParamUnion{
+			OfThinkingConfigEnabled: &anthropic.ThinkingConfigEnabledParam{BudgetTokens: int64(settings.ThinkingBudget)},
+		}
+	} else {
+		// Extended thinking does not allow changing the sampling parameters
+		if settings.Temperature != nil {
+			params.Temperature = anthropic.Float(*settings.Temperature)
+		}
+		if settings.TopP != nil {
+			params.TopP = anthropic.Float(*settings.TopP)
+		}
+	}
+	if request.System != "" {
+		params.System = []anthropic.TextBlockParam{{Text: request.System}}
+	}
+	if caching {
+		addCacheBreakpoints(&params)
+	}
+	return params
+}
+
+// cacheHistoryBreakpoints is the number of rolling cache breakpoints placed in the conversation.
+// The API allows four breakpoints in total; the other two mark the tools and the system prompt.
+const cacheHistoryBreakpoints = 2
+
+// cacheBreakpoint returns the cache control marking a block as a cache breakpoint. The type is set
+// explicitly, as an empty CacheControlEphemeralParam is left out of the request.
+func cacheBreakpoint() anthropic.CacheControlEphemeralParam {
+	return anthropic.CacheControlEphemeralParam{Type: "ephemeral"}
+}
+
+// addCacheBreakpoints marks the prompt prefixes that stay the same between requests as cacheable:
+// the tool list (cached as a whole by marking its last tool), the system prompt, and a rolling
+// point at the end of the last two user messages. The latest breakpoint writes the conversation
+// so far to the cache, and the one before it reads what the previous request wrote.
+func addCacheBreakpoints(params *anthropic.MessageNewParams) {
+	if n := len(params.Tools); n > 0 && params.Tools[n-1].OfTool != nil {
+		params.Tools[n-1].OfTool.CacheControl = cacheBreakpoint()
+	}
+	if n := len(params.System); n > 0 {
+		params.System[n-1].CacheControl = cacheBreakpoint()
 	}
 
-	return message, nil
+	marked := 0
+	for i := len(params.Messages) - 1; i >= 0 && marked < cacheHistoryBreakpoints; i-- {
+		message := params.Messages[i]
+		if message.Role != anthropic.MessageParamRoleUser || len(message.Content) == 0 {
+			continue
+		}
+		if cacheControl := message.Content[len(message.Content)-1].GetCacheControl(); cacheControl != nil {
+			*cacheControl = cacheBreakpoint()
+			marked++
+		}
+	}
+}
+
+// toAnthropicMessages converts the domain conversation history into Anthropic message parameters.
+func toAnthropicMessages(conversation []domain.Message) []anthropic.MessageParam {
+	messages := make([]anthropic.MessageParam, 0, len(conversation))
+	for _, message := range conversation {
+		blocks := make([]anthropic.ContentBlockParamUnion, 0, len(message.Content))
+		for _, block := range message.Content {
+			if param, ok := toAnthropicContentBlock(block); ok {
+				blocks = append(blocks, param)
+			}
+		}
+
+		if message.Role == domain.RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	return messages
+}
+
+// toAnthropicContentBlock converts a domain content block into its Anthropic parameter form.
+// It returns false for block types the Anthropic API does not understand.
+func toAnthropicContentBlock(block domain.ContentBlock) (anthropic.ContentBlockParamUnion, bool) {
+	switch block.Type {
+	case domain.ContentBlockText:
+		return anthropic.NewTextBlock(block.Text), true
+	case domain.ContentBlockToolUse:
+		return anthropic.ContentBlockParamUnion{OfRequestToolUseBlock: &anthropic.ToolUseBlockParam{
+			ID:    block.ID,
+			Name:  block.Name,
+			Input: block.Input,
+		}}, true
+	case domain.ContentBlockToolResult:
+		return anthropic.NewToolResultBlock(block.ToolUseID, block.Content, block.IsError), true
+	case domain.ContentBlockImage:
+		return anthropic.NewImageBlockBase64(block.MediaType, block.Data), true
+	case domain.ContentBlockThinking:
+		return anthropic.ContentBlockParamUnion{OfRequestThinkingBlock: &anthropic.ThinkingBlockParam{
+			Thinking:  block.Thinking,
+			Signature: block.Signature,
+		}}, true
+	case domain.ContentBlockRedactedThinking:
+		return anthropic.ContentBlockParamUnion{OfRequestRedactedThinkingBlock: &anthropic.RedactedThinkingBlockParam{
+			Data: block.Data,
+		}}, true
+	default:
+		return anthropic.ContentBlockParamUnion{}, false
+	}
+}
+
+// fromAnthropicMessage converts an Anthropic API response into a domain assistant message.
+func fromAnthropicMessage(message *anthropic.Message) *domain.Message {
+	result := domain.NewAssistantMessage()
+	result.StopReason = string(message.StopReason)
+	result.Model = string(message.Model)
+	result.Usage = fromAnthropicUsage(message.Usage)
+	for _, content := range message.Content {
+		switch content.Type {
+		case "text":
+			result.Content = append(result.Content, domain.NewTextBlock(content.Text))
+		case "tool_use":
+			result.Content = append(result.Content, domain.NewToolUseBlock(content.ID, content.Name, content.Input))
+		case "thinking":
+			result.Content = append(result.Content, domain.NewThinkingBlock(content.Thinking, content.Signature))
+		case "redacted_thinking":
+			result.Content = append(result.Content, domain.NewRedactedThinkingBlock(content.Data))
+		}
+	}
+	return &result
+}
+
+// fromAnthropicUsage converts Anthropic token usage into domain usage.
+func fromAnthropicUsage(usage anthropic.Usage) *domain.Usage {
+	return &domain.Usage{
+		InputTokens:              usage.InputTokens,
+		OutputTokens:             usage.OutputTokens,
+		CacheCreationInputTokens: usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     usage.CacheReadInputTokens,
+	}
+}
+
+// anthropicStream adapts the SDK's server-sent event stream to domain.InferenceStream.
+type anthropicStream struct {
+	stream  *ssestream.Stream[anthropic.MessageStreamEventUnion]
+	current domain.StreamEvent
+}
+
+// Next advances to the next event relevant to the agent, skipping events it does not need.
+func (s *anthropicStream) Next() bool {
+	for s.stream.Next() {
+		event := s.stream.Current()
+		switch event.Type {
+		case "message_start":
+			s.current = domain.StreamEvent{
+				Type:  domain.StreamEventMessageStart,
+				Model: string(event.Message.Model),
+				Usage: fromAnthropicUsage(event.Message.Usage),
+			}
+			return true
+		case "content_block_start":
+			s.current = domain.StreamEvent{
+				Type:      domain.StreamEventContentBlockStart,
+				Index:     int(event.Index),
+				BlockType: event.ContentBlock.Type,
+				ToolUseID: event.ContentBlock.ID,
+				ToolName:  event.ContentBlock.Name,
+				Data:      event.ContentBlock.Data,
+			}
+			return true
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				s.current = domain.StreamEvent{Type: domain.StreamEventTextDelta, Index: int(event.Index), Text: event.Delta.Text}
+				return true
+			case "input_json_delta":
+				s.current = domain.StreamEvent{Type: domain.StreamEventInputJSONDelta, Index: int(event.Index), PartialJSON: event.Delta.PartialJSON}
+				return true
+			case "thinking_delta":
+				s.current = domain.StreamEvent{Type: domain.StreamEventThinkingDelta, Index: int(event.Index), Thinking: event.Delta.Thinking}
+				return true
+			case "signature_delta":
+				s.current = domain.StreamEvent{Type: domain.StreamEventSignatureDelta, Index: int(event.Index), Signature: event.Delta.Signature}
+				return true
+			}
+		case "content_block_stop":
+			s.current = domain.StreamEvent{Type: domain.StreamEventContentBlockStop, Index: int(event.Index)}
+			return true
+		case "message_delta":
+			s.current = domain.StreamEvent{
+				Type:       domain.StreamEventMessageDelta,
+				StopReason: string(event.Delta.StopReason),
+				Usage:      &domain.Usage{OutputTokens: event.Usage.OutputTokens},
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Current returns the event the stream is positioned on.
+func (s *anthropicStream) Current() domain.StreamEvent {
+	return s.current
+}
+
+// Err returns the error that terminated the stream, if any.
+// An error event sent by the API is returned as an *anthropicStreamError.
+func (s *anthropicStream) Err() error {
+	if err := s.stream.Err(); err != nil {
+		return parseStreamError(err)
+	}
+	return nil
+}
+
+// anthropicStreamError is an error event received after the response started streaming,
+// e.g. an overloaded_error when the API became overloaded mid-response.
+type anthropicStreamError struct {
+	Type    string // e.g. "overloaded_error" or "api_error"
+	Message string
+}
+
+func (e *anthropicStreamError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// parseStreamError converts the error the SDK reports for an error event, which carries the
+// event's JSON data in its message, into an *anthropicStreamError. Other errors are returned as they are.
+func parseStreamError(err error) error {
+	data, ok := strings.CutPrefix(err.Error(), "received error while streaming: ")
+	if !ok {
+		return err
+	}
+	var event struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(data), &event) != nil || event.Error.Type == "" {
+		return err
+	}
+	return &anthropicStreamError{Type: event.Error.Type, Message: event.Error.Message}
+}
+
+// Close releases the underlying HTTP connection.
+func (s *anthropicStream) Close() error {
+	return s.stream.Close()
 }
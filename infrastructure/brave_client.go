@@ -1,12 +1,14 @@
 package infrastructure
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+
+	"code-ai-editor/infrastructure/config"
 )
 
 // BraveClient is a client for interacting with the Brave Search API.
@@ -30,19 +32,18 @@ type BraveSearchResponse struct {
 }
 
 // NewBraveClient creates a new BraveClient instance.
-// It retrieves the Brave API key from the BRAVE_API_KEY environment variable.
-// If the environment variable is not set, it returns an error.
+// It takes the Brave API key from the settings (BRAVE_API_KEY).
+// If no key is configured, it returns an error.
 // Otherwise, it initializes and returns a pointer to a BraveClient
 // configured with the API key, a default HTTP client, and the base URL
 // for the Brave Search API.
-func NewBraveClient() (*BraveClient, error) {
-	apiKey := os.Getenv("BRAVE_API_KEY")
-	if apiKey == "" {
+func NewBraveClient(settings config.BraveConfig) (*BraveClient, error) {
+	if settings.APIKey == "" {
 		return nil, fmt.Errorf("BRAVE_API_KEY is not set")
 	}
 
 	return &BraveClient{
-		apiKey:     apiKey,
+		apiKey:     settings.APIKey,
 		httpClient: &http.Client{},
 		baseURL:    "https://api.search.brave.com/res/v1/web/search",
 	}, nil
@@ -59,16 +60,17 @@ func NewBraveClient() (*BraveClient, error) {
 //
 // Args:
 //
+//	ctx: The context for the request; cancelling it aborts the request.
 //	query: The search query string.
 //
 // Returns:
 //
 //	A pointer to a BraveSearchResponse struct containing the search results, or an error if the search failed.
-func (b *BraveClient) Search(query string) (*BraveSearchResponse, error) {
+func (b *BraveClient) Search(ctx context.Context, query string) (*BraveSearchResponse, error) {
 	params := url.Values{}
 	params.Add("q", query)
 
-	req, err := http.NewRequest("GET", b.baseURL+"?"+params.Encode(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"?"+params.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
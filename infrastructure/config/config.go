@@ -0,0 +1,354 @@
+// Package config loads the runtime settings of the application from layered sources:
+// built-in defaults, the user config file, the project config file and the environment.
+// Command-line flags are applied on top by the caller.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"code-ai-editor/domain"
+)
+
+// DefaultProjectPath is the project config file, relative to the working directory.
+const DefaultProjectPath = ".editor/config.yaml"
+
+// Config holds every runtime setting of the application. Each component constructor takes
+// its section, e.g. the Qdrant client takes QdrantConfig.
+type Config struct {
+	Workspace string                   `yaml:"workspace"` // Default workspace root; empty uses the enclosing git repository
+	Roots     map[string]string        `yaml:"roots"`     // Named workspace roots, from name to directory
+	Provider  string                   `yaml:"provider"`  // AI provider: "anthropic" or "openai"
+	Model     domain.ModelSettings     `yaml:"model"`
+	Retrieval domain.RetrievalSettings `yaml:"retrieval"`
+	Indexing  IndexingConfig           `yaml:"indexing"`
+	Anthropic AnthropicConfig          `yaml:"anthropic"`
+	OpenAI    OpenAIConfig             `yaml:"openai"`
+	Qdrant    QdrantConfig             `yaml:"qdrant"`
+	Brave     BraveConfig              `yaml:"brave"`
+	Sessions  SessionsConfig           `yaml:"sessions"`
+	Agent     AgentConfig              `yaml:"agent"`
+	Budget    BudgetConfig             `yaml:"budget"`
+	Tools     ToolsConfig              `yaml:"tools"`
+	Output    OutputConfig             `yaml:"output"`
+
+	Sources []string `yaml:"-"` // Where the settings came from, lowest precedence first
+}
+
+// IndexingConfig configures the indexing of the workspace.
+type IndexingConfig struct {
+	BatchSize int `yaml:"batch_size"` // Snippets embedded per request
+}
+
+// AnthropicConfig configures the Anthropic client.
+type AnthropicConfig struct {
+	APIKey        string `yaml:"api_key"`
+	PromptCaching bool   `yaml:"prompt_caching"` // Mark cache breakpoints on the tools, system prompt and history
+}
+
+// OpenAIConfig configures the OpenAI-compatible chat client and the embedding client.
+type OpenAIConfig struct {
+	APIKey         string `yaml:"api_key"`         // Only required by the OpenAI API itself
+	BaseURL        string `yaml:"base_url"`        // Empty uses the OpenAI API
+	ChatModel      string `yaml:"chat_model"`      // Requested when the model settings name none
+	EmbeddingModel string `yaml:"embedding_model"` // Must produce vectors of Qdrant.VectorSize dimensions
+}
+
+// QdrantConfig configures the Qdrant vector store.
+type QdrantConfig struct {
+	Addr       string `yaml:"addr"`        // gRPC address
+	Collection string `yaml:"collection"`  // Collection of the default root; named roots get "<collection>_<name>"
+	VectorSize int    `yaml:"vector_size"` // Dimensions of the collection, created on first use
+}
+
+// BraveConfig configures the Brave Search client behind the search_web tool.
+type BraveConfig struct {
+	APIKey string `yaml:"api_key"` // Empty disables web search
+}
+
+// SessionsConfig configures where chat transcripts are stored.
+type SessionsConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// AgentConfig configures the agent loop.
+type AgentConfig struct {
+	CompactThreshold  int `yaml:"compact_threshold"`   // Estimated prompt tokens above which older turns are summarized; 0 disables compaction
+	MaxSteps          int `yaml:"max_steps"`           // Inference steps per turn before asking whether to continue; 0 is unlimited
+	MaxRepeatedErrors int `yaml:"max_repeated_errors"` // Identical failing tool calls per turn before asking whether to continue; 0 is unlimited
+	ParallelTools     int `yaml:"parallel_tools"`      // Read-only tool calls executed concurrently; 1 runs all tools serially
+	MaxContinuations  int `yaml:"max_continuations"`   // Times a response cut off at the max tokens limit is continued
+	MaxAttempts       int `yaml:"max_attempts"`        // Attempts per inference call on rate limits, overload and server errors
+}
+
+// BudgetConfig limits what a session may spend and sets the prices it is accounted with.
+type BudgetConfig struct {
+	MaxCost    float64 `yaml:"max_cost"`    // USD; 0 is unlimited
+	MaxTokens  int64   `yaml:"max_tokens"`  // Tokens in total; 0 is unlimited
+	PriceTable string  `yaml:"price_table"` // JSON file with model prices overriding the built-in ones
+}
+
+// ToolsConfig configures how long tools may run.
+type ToolsConfig struct {
+	Timeout  time.Duration            `yaml:"timeout"`  // For tools that do not declare their own
+	Timeouts map[string]time.Duration `yaml:"timeouts"` // By tool name, overriding all others
+}
+
+// OutputConfig configures how the agent's output is shown.
+type OutputConfig struct {
+	Render       string `yaml:"render"`        // "auto", "pretty", "plain" or "jsonl"
+	Stream       bool   `yaml:"stream"`        // Show model output token-by-token as it arrives
+	ShowThinking bool   `yaml:"show_thinking"` // Show the model's thinking dimmed rather than collapsed
+}
+
+// Defaults returns the built-in settings.
+func Defaults() Config {
+	return Config{
+		Provider:  "anthropic",
+		Retrieval: domain.DefaultRetrievalSettings(),
+		Indexing:  IndexingConfig{BatchSize: 100},
+		Anthropic: AnthropicConfig{PromptCaching: true},
+		OpenAI: OpenAIConfig{
+			ChatModel:      "gpt-4o",
+			EmbeddingModel: "text-embedding-3-small",
+		},
+		Qdrant: QdrantConfig{
+			Addr:       "localhost:6334",
+			Collection: "code_snippets",
+			VectorSize: 1536, // Size of OpenAI's text-embedding-3-small vectors
+		},
+		Sessions: SessionsConfig{Dir: ".sessions"},
+		Agent: AgentConfig{
+			CompactThreshold:  domain.DefaultCompactThreshold,
+			MaxSteps:          domain.DefaultMaxStepsPerTurn,
+			MaxRepeatedErrors: domain.DefaultMaxRepeatedToolErrors,
+			ParallelTools:     domain.DefaultMaxParallelTools,
+			MaxContinuations:  domain.DefaultMaxContinuations,
+			MaxAttempts:       5,
+		},
+		Tools:   ToolsConfig{Timeout: 60 * time.Second},
+		Output:  OutputConfig{Render: "auto", Stream: true, ShowThinking: true},
+		Sources: []string{"defaults"},
+	}
+}
+
+// UserPath returns the path of the user config file, $XDG_CONFIG_HOME/code-ai-editor/config.yaml,
+// defaulting to ~/.config/code-ai-editor/config.yaml. It returns "" if the home directory is unknown.
+func UserPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "code-ai-editor", "config.yaml")
+}
+
+// Load returns the built-in defaults overridden in turn by the user config file, the project
+// config file at projectPath and the environment. Missing files are skipped. If no workspace
+// is set, it is the root of the git repository containing the working directory, or the working
+// directory itself outside of a repository. The caller applies its flags on top and then checks
+// the result with Validate.
+//
+// The project file comes with the repository, which may not be trusted, so the API keys and the
+// endpoints they are sent to cannot be set there; such settings are ignored with a warning.
+func Load(projectPath string) (Config, error) {
+	config := Defaults()
+	for _, path := range []string{UserPath(), projectPath} {
+		if path == "" {
+			continue
+		}
+		protected := config.protectedValues()
+		found, err := config.readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if found {
+			config.Sources = append(config.Sources, path)
+		}
+		if found && path == projectPath {
+			config.restoreProtected(protected, path)
+		}
+	}
+	if err := config.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if config.Workspace == "" {
+		config.Workspace = defaultWorkspace()
+	}
+	return config, nil
+}
+
+// protectedSettings lists the settings a project file may not change: the credentials, and the
+// endpoints they are sent to, by their YAML keys.
+var protectedSettings = []struct {
+	key   string
+	field func(c *Config) *string
+}{
+	{"anthropic.api_key", func(c *Config) *string { return &c.Anthropic.APIKey }},
+	{"openai.api_key", func(c *Config) *string { return &c.OpenAI.APIKey }},
+	{"openai.base_url", func(c *Config) *string { return &c.OpenAI.BaseURL }},
+	{"qdrant.addr", func(c *Config) *string { return &c.Qdrant.Addr }},
+	{"brave.api_key", func(c *Config) *string { return &c.Brave.APIKey }},
+}
+
+// protectedValues returns the current values of the protected settings.
+func (c *Config) protectedValues() []string {
+	values := make([]string, len(protectedSettings))
+	for i, setting := range protectedSettings {
+		values[i] = *setting.field(c)
+	}
+	return values
+}
+
+// restoreProtected resets the protected settings that the file at path changed to their previous values.
+func (c *Config) restoreProtected(values []string, path string) {
+	for i, setting := range protectedSettings {
+		if field := setting.field(c); *field != values[i] {
+			log.Printf("Warning: ignoring %s in the project config file '%s'; set it in the user config file or the environment instead\n", setting.key, path)
+			*field = values[i]
+		}
+	}
+}
+
+// defaultWorkspace returns the root of the git repository containing the working directory,
+// or "." if there is none.
+func defaultWorkspace() string {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "."
+	}
+	if root := strings.TrimSpace(string(output)); root != "" {
+		return root
+	}
+	return "."
+}
+
+// WorkspaceRoots returns the workspace roots, the default root first and the named roots
+// sorted by name.
+func (c Config) WorkspaceRoots() []domain.WorkspaceRoot {
+	roots := []domain.WorkspaceRoot{{Dir: c.Workspace}}
+	names := make([]string, 0, len(c.Roots))
+	for name := range c.Roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		roots = append(roots, domain.WorkspaceRoot{Name: name, Dir: c.Roots[name]})
+	}
+	return roots
+}
+
+// Collection returns the name of the Qdrant collection indexing the named workspace root.
+func (c Config) Collection(root string) string {
+	if root == "" {
+		return c.Qdrant.Collection
+	}
+	return c.Qdrant.Collection + "_" + root
+}
+
+// readFile overrides the settings with those set in the YAML file at path. Settings the file
+// does not mention are kept; unknown settings are an error, as they are most likely typos.
+func (c *Config) readFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	return true, nil
+}
+
+// Validate checks that the settings are usable, reporting every problem at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Workspace != "", "workspace must not be empty")
+	for name, dir := range c.Roots {
+		check(domain.ValidRootName(name), "roots: invalid root name %q (use letters, digits, '-' and '_')", name)
+		check(dir != "", "roots.%s must not be empty", name)
+	}
+	provider := strings.ToLower(c.Provider)
+	check(provider == "anthropic" || provider == "openai", "provider must be 'anthropic' or 'openai', got %q", c.Provider)
+	check(c.Model.MaxTokens >= 0, "model.max_tokens must not be negative, got %d", c.Model.MaxTokens)
+	if c.Model.Temperature != nil {
+		check(*c.Model.Temperature >= 0 && *c.Model.Temperature <= 2, "model.temperature must be between 0 and 2, got %g", *c.Model.Temperature)
+	}
+	if c.Model.TopP != nil {
+		check(*c.Model.TopP >= 0 && *c.Model.TopP <= 1, "model.top_p must be between 0 and 1, got %g", *c.Model.TopP)
+	}
+	check(c.Model.ThinkingBudget >= 0, "model.thinking_budget must not be negative, got %d", c.Model.ThinkingBudget)
+	check(c.Retrieval.TopK > 0, "retrieval.top_k must be positive, got %d", c.Retrieval.TopK)
+	check(c.Retrieval.MaxContextLength > 0, "retrieval.max_context_length must be positive, got %d", c.Retrieval.MaxContextLength)
+	check(c.Indexing.BatchSize > 0, "indexing.batch_size must be positive, got %d", c.Indexing.BatchSize)
+	check(c.Qdrant.Addr != "", "qdrant.addr must not be empty")
+	check(c.Qdrant.Collection != "", "qdrant.collection must not be empty")
+	check(c.Qdrant.VectorSize > 0, "qdrant.vector_size must be positive, got %d", c.Qdrant.VectorSize)
+	check(c.Sessions.Dir != "", "sessions.dir must not be empty")
+	check(c.Agent.CompactThreshold >= 0, "agent.compact_threshold must not be negative, got %d", c.Agent.CompactThreshold)
+	check(c.Agent.MaxSteps >= 0, "agent.max_steps must not be negative, got %d", c.Agent.MaxSteps)
+	check(c.Agent.MaxRepeatedErrors >= 0, "agent.max_repeated_errors must not be negative, got %d", c.Agent.MaxRepeatedErrors)
+	check(c.Agent.ParallelTools > 0, "agent.parallel_tools must be positive, got %d", c.Agent.ParallelTools)
+	check(c.Agent.MaxContinuations >= 0, "agent.max_continuations must not be negative, got %d", c.Agent.MaxContinuations)
+	check(c.Agent.MaxAttempts > 0, "agent.max_attempts must be positive, got %d", c.Agent.MaxAttempts)
+	check(c.Budget.MaxCost >= 0, "budget.max_cost must not be negative, got %g", c.Budget.MaxCost)
+	check(c.Budget.MaxTokens >= 0, "budget.max_tokens must not be negative, got %d", c.Budget.MaxTokens)
+	check(c.Tools.Timeout > 0, "tools.timeout must be positive, got %s", c.Tools.Timeout)
+	for name, timeout := range c.Tools.Timeouts {
+		check(timeout > 0, "tools.timeouts.%s must be positive, got %s", name, timeout)
+	}
+	render := c.Output.Render
+	check(render == "auto" || render == "pretty" || render == "plain" || render == "jsonl",
+		"output.render must be 'auto', 'pretty', 'plain' or 'jsonl', got %q", render)
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of the settings with the API keys masked, for display.
+func (c Config) Redacted() Config {
+	c.Anthropic.APIKey = redact(c.Anthropic.APIKey)
+	c.OpenAI.APIKey = redact(c.OpenAI.APIKey)
+	c.Brave.APIKey = redact(c.Brave.APIKey)
+	return c
+}
+
+// redact masks a secret, keeping its last four characters if it is long enough to stay secret.
+func redact(secret string) string {
+	switch {
+	case secret == "":
+		return ""
+	case len(secret) < 12:
+		return "****"
+	default:
+		return "****" + secret[len(secret)-4:]
+	}
+}
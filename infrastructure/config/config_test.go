@@ -0,0 +1,207 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateEnv clears the variables read by Load, so that the environment the tests run in
+// does not leak into the loaded settings, and points the user config at dir.
+func isolateEnv(t *testing.T, dir string) {
+	for _, name := range []string{
+		"WORKSPACE_ROOTS", "AI_PROVIDER", "AI_MODEL", "AI_MAX_TOKENS", "AI_TEMPERATURE", "AI_TOP_P",
+		"AI_THINKING_BUDGET", "RETRIEVAL_TOP_K", "RETRIEVAL_MAX_CONTEXT_LENGTH", "INDEX_BATCH_SIZE",
+		"ANTHROPIC_API_KEY", "ANTHROPIC_PROMPT_CACHING", "OPENAI_API_KEY", "OPENAI_BASE_URL",
+		"OPENAI_CHAT_MODEL", "OPENAI_EMBEDDING_MODEL", "QDRANT_ADDR", "QDRANT_COLLECTION_NAME",
+		"QDRANT_VECTOR_SIZE", "BRAVE_API_KEY", "SESSIONS_DIR", "AGENT_COMPACT_THRESHOLD",
+		"AGENT_MAX_STEPS", "AGENT_MAX_REPEATED_ERRORS", "AGENT_PARALLEL_TOOLS", "AGENT_MAX_CONTINUATIONS",
+		"AGENT_MAX_ATTEMPTS", "BUDGET_MAX_COST", "BUDGET_MAX_TOKENS", "BUDGET_PRICE_TABLE",
+		"TOOL_TIMEOUT", "TOOL_TIMEOUTS", "OUTPUT_RENDER", "OUTPUT_STREAM", "OUTPUT_SHOW_THINKING",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("WORKSPACE_DIR", "/workspace")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	// An empty AI_STOP_SEQUENCES clears the stop sequences, so it is unset; Setenv restores it afterwards
+	t.Setenv("AI_STOP_SEQUENCES", "")
+	os.Unsetenv("AI_STOP_SEQUENCES")
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	dir := t.TempDir()
+	isolateEnv(t, dir)
+
+	config, err := Load(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := Defaults()
+	want.Workspace = "/workspace"
+	want.Sources = []string{"defaults", "environment"}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Load =\n%+v\nwant\n%+v", config, want)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	isolateEnv(t, dir)
+	userPath := filepath.Join(dir, "code-ai-editor", "config.yaml")
+	writeFile(t, userPath, `
+provider: openai
+agent:
+  max_steps: 5
+  max_attempts: 2
+budget:
+  max_cost: 1.5
+output:
+  render: plain
+tools:
+  timeout: 30s
+`)
+	projectPath := filepath.Join(dir, "project", "config.yaml")
+	writeFile(t, projectPath, `
+agent:
+  max_steps: 7
+budget:
+  max_cost: 2.5
+tools:
+  timeouts:
+    run_command: 5m
+`)
+	t.Setenv("AGENT_MAX_STEPS", "9")
+	t.Setenv("OUTPUT_STREAM", "false")
+
+	config, err := Load(projectPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if config.Provider != "openai" {
+		t.Errorf("provider = %q, want the user file's openai", config.Provider)
+	}
+	if config.Agent.MaxAttempts != 2 {
+		t.Errorf("agent.max_attempts = %d, want the user file's 2", config.Agent.MaxAttempts)
+	}
+	if config.Budget.MaxCost != 2.5 {
+		t.Errorf("budget.max_cost = %g, want the project file's 2.5", config.Budget.MaxCost)
+	}
+	if config.Agent.MaxSteps != 9 {
+		t.Errorf("agent.max_steps = %d, want the environment's 9", config.Agent.MaxSteps)
+	}
+	if config.Output.Stream || config.Output.Render != "plain" || !config.Output.ShowThinking {
+		t.Errorf("output = %+v, want stream off from the environment, plain from the user file and the default show_thinking", config.Output)
+	}
+	if config.Tools.Timeout != 30*time.Second || config.Tools.Timeouts["run_command"] != 5*time.Minute {
+		t.Errorf("tools = %+v, want a 30s default and 5m for run_command", config.Tools)
+	}
+	if config.Agent.ParallelTools != Defaults().Agent.ParallelTools {
+		t.Errorf("agent.parallel_tools = %d, want the default", config.Agent.ParallelTools)
+	}
+	if want := []string{"defaults", userPath, projectPath, "environment"}; !reflect.DeepEqual(config.Sources, want) {
+		t.Errorf("sources = %v, want %v", config.Sources, want)
+	}
+}
+
+func TestLoadIgnoresCredentialsInProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	isolateEnv(t, dir)
+	writeFile(t, filepath.Join(dir, "code-ai-editor", "config.yaml"), "openai:\n  base_url: http://localhost:8080/v1\n")
+	projectPath := filepath.Join(dir, "project", "config.yaml")
+	writeFile(t, projectPath, `
+openai:
+  base_url: https://attacker.example/v1
+  chat_model: qwen2.5-coder
+anthropic:
+  api_key: sk-project
+qdrant:
+  addr: attacker.example:6334
+`)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-environment")
+
+	config, err := Load(projectPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if config.OpenAI.BaseURL != "http://localhost:8080/v1" {
+		t.Errorf("openai.base_url = %q, want the user file's", config.OpenAI.BaseURL)
+	}
+	if config.Qdrant.Addr != Defaults().Qdrant.Addr {
+		t.Errorf("qdrant.addr = %q, want the default", config.Qdrant.Addr)
+	}
+	if config.Anthropic.APIKey != "sk-environment" {
+		t.Errorf("anthropic.api_key = %q, want the environment's", config.Anthropic.APIKey)
+	}
+	if config.OpenAI.ChatModel != "qwen2.5-coder" {
+		t.Errorf("openai.chat_model = %q, want the project file's", config.OpenAI.ChatModel)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	isolateEnv(t, dir)
+
+	t.Setenv("AGENT_MAX_STEPS", "many")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "AGENT_MAX_STEPS") {
+		t.Errorf("Load with an invalid variable: err = %v", err)
+	}
+
+	t.Setenv("AGENT_MAX_STEPS", "")
+	projectPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, projectPath, "agent:\n  max_step: 3\n")
+	if _, err := Load(projectPath); err == nil {
+		t.Error("Load accepted an unknown key")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := Defaults()
+	config.Workspace = "."
+	config.Agent.ParallelTools = 0
+	config.Budget.MaxCost = -1
+	config.Output.Render = "fancy"
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted invalid settings")
+	}
+	for _, want := range []string{"agent.parallel_tools", "budget.max_cost", "output.render"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseToolTimeouts(t *testing.T) {
+	timeouts, err := ParseToolTimeouts("run_command=5m, search_web = 30s,")
+	if err != nil {
+		t.Fatalf("ParseToolTimeouts: %v", err)
+	}
+	want := map[string]time.Duration{"run_command": 5 * time.Minute, "search_web": 30 * time.Second}
+	if !reflect.DeepEqual(timeouts, want) {
+		t.Errorf("ParseToolTimeouts = %v, want %v", timeouts, want)
+	}
+
+	for _, spec := range []string{"run_command", "run_command=soon"} {
+		if _, err := ParseToolTimeouts(spec); err == nil {
+			t.Errorf("ParseToolTimeouts(%q) returned no error", spec)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides the settings with those set in environment variables, which may come from
+// .env.local. Empty variables are ignored, except AI_STOP_SEQUENCES, where empty clears the list.
+//
+// The variables are:
+//   - WORKSPACE_DIR: The default workspace root.
+//   - WORKSPACE_ROOTS: A comma-separated list of name=dir named workspace roots, replacing those of the config files.
+//   - AI_PROVIDER: The AI provider, "anthropic" or "openai".
+//   - AI_MODEL, AI_MAX_TOKENS, AI_TEMPERATURE, AI_TOP_P, AI_THINKING_BUDGET: The model settings.
+//   - AI_STOP_SEQUENCES: A comma-separated list of stop sequences.
+//   - RETRIEVAL_TOP_K, RETRIEVAL_MAX_CONTEXT_LENGTH: The context retrieval settings.
+//   - INDEX_BATCH_SIZE: The number of snippets embedded per request.
+//   - ANTHROPIC_API_KEY, ANTHROPIC_PROMPT_CACHING: The Anthropic client settings.
+//   - OPENAI_API_KEY, OPENAI_BASE_URL, OPENAI_CHAT_MODEL, OPENAI_EMBEDDING_MODEL: The OpenAI client settings.
+//   - QDRANT_ADDR, QDRANT_COLLECTION_NAME, QDRANT_VECTOR_SIZE: The Qdrant settings.
+//   - BRAVE_API_KEY: The Brave Search API key.
+//   - SESSIONS_DIR: The directory of the chat transcripts.
+//   - AGENT_COMPACT_THRESHOLD, AGENT_MAX_STEPS, AGENT_MAX_REPEATED_ERRORS, AGENT_PARALLEL_TOOLS,
+//     AGENT_MAX_CONTINUATIONS, AGENT_MAX_ATTEMPTS: The agent loop settings.
+//   - BUDGET_MAX_COST, BUDGET_MAX_TOKENS, BUDGET_PRICE_TABLE: The session budget and prices.
+//   - TOOL_TIMEOUT: The timeout of tools that do not declare their own, e.g. "90s".
+//   - TOOL_TIMEOUTS: A comma-separated list of name=duration tool timeouts, replacing those of the config files.
+//   - OUTPUT_RENDER, OUTPUT_STREAM, OUTPUT_SHOW_THINKING: The output settings.
+func (c *Config) applyEnv() error {
+	var env envReader
+	env.string("WORKSPACE_DIR", &c.Workspace)
+	if value, ok := env.lookup("WORKSPACE_ROOTS"); ok {
+		roots, err := ParseRoots(value)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("invalid WORKSPACE_ROOTS %q: %w", value, err))
+		} else {
+			c.Roots = roots
+		}
+	}
+	env.string("AI_PROVIDER", &c.Provider)
+	env.string("AI_MODEL", &c.Model.Model)
+	env.int("AI_MAX_TOKENS", &c.Model.MaxTokens)
+	env.float("AI_TEMPERATURE", &c.Model.Temperature)
+	env.float("AI_TOP_P", &c.Model.TopP)
+	env.int("AI_THINKING_BUDGET", &c.Model.ThinkingBudget)
+	if value, ok := os.LookupEnv("AI_STOP_SEQUENCES"); ok {
+		c.Model.StopSequences = ParseStopSequences(value)
+		env.used = true
+	}
+	env.int("RETRIEVAL_TOP_K", &c.Retrieval.TopK)
+	env.int("RETRIEVAL_MAX_CONTEXT_LENGTH", &c.Retrieval.MaxContextLength)
+	env.int("INDEX_BATCH_SIZE", &c.Indexing.BatchSize)
+	env.string("ANTHROPIC_API_KEY", &c.Anthropic.APIKey)
+	env.bool("ANTHROPIC_PROMPT_CACHING", &c.Anthropic.PromptCaching)
+	env.string("OPENAI_API_KEY", &c.OpenAI.APIKey)
+	env.string("OPENAI_BASE_URL", &c.OpenAI.BaseURL)
+	env.string("OPENAI_CHAT_MODEL", &c.OpenAI.ChatModel)
+	env.string("OPENAI_EMBEDDING_MODEL", &c.OpenAI.EmbeddingModel)
+	env.string("QDRANT_ADDR", &c.Qdrant.Addr)
+	env.string("QDRANT_COLLECTION_NAME", &c.Qdrant.Collection)
+	env.int("QDRANT_VECTOR_SIZE", &c.Qdrant.VectorSize)
+	env.string("BRAVE_API_KEY", &c.Brave.APIKey)
+	env.string("SESSIONS_DIR", &c.Sessions.Dir)
+	env.int("AGENT_COMPACT_THRESHOLD", &c.Agent.CompactThreshold)
+	env.int("AGENT_MAX_STEPS", &c.Agent.MaxSteps)
+	env.int("AGENT_MAX_REPEATED_ERRORS", &c.Agent.MaxRepeatedErrors)
+	env.int("AGENT_PARALLEL_TOOLS", &c.Agent.ParallelTools)
+	env.int("AGENT_MAX_CONTINUATIONS", &c.Agent.MaxContinuations)
+	env.int("AGENT_MAX_ATTEMPTS", &c.Agent.MaxAttempts)
+	env.number("BUDGET_MAX_COST", &c.Budget.MaxCost)
+	env.int64("BUDGET_MAX_TOKENS", &c.Budget.MaxTokens)
+	env.string("BUDGET_PRICE_TABLE", &c.Budget.PriceTable)
+	env.duration("TOOL_TIMEOUT", &c.Tools.Timeout)
+	if value, ok := env.lookup("TOOL_TIMEOUTS"); ok {
+		timeouts, err := ParseToolTimeouts(value)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("invalid TOOL_TIMEOUTS %q: %w", value, err))
+		} else {
+			c.Tools.Timeouts = timeouts
+		}
+	}
+	env.string("OUTPUT_RENDER", &c.Output.Render)
+	env.bool("OUTPUT_STREAM", &c.Output.Stream)
+	env.bool("OUTPUT_SHOW_THINKING", &c.Output.ShowThinking)
+
+	if env.used {
+		c.Sources = append(c.Sources, "environment")
+	}
+	return errors.Join(env.errs...)
+}
+
+// envReader reads typed settings from environment variables, collecting parse errors.
+type envReader struct {
+	used bool // Whether any variable was set
+	errs []error
+}
+
+// lookup returns the value of a non-empty variable.
+func (r *envReader) lookup(name string) (string, bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", false
+	}
+	r.used = true
+	return value, true
+}
+
+func (r *envReader) string(name string, dst *string) {
+	if value, ok := r.lookup(name); ok {
+		*dst = value
+	}
+}
+
+func (r *envReader) int(name string, dst *int) {
+	if value, ok := r.lookup(name); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) int64(name string, dst *int64) {
+	if value, ok := r.lookup(name); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = n
+	}
+}
+
+// number reads a float that is always set, unlike the optional ones read with float.
+func (r *envReader) number(name string, dst *float64) {
+	if value, ok := r.lookup(name); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (r *envReader) duration(name string, dst *time.Duration) {
+	if value, ok := r.lookup(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (r *envReader) float(name string, dst **float64) {
+	if value, ok := r.lookup(name); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = &f
+	}
+}
+
+func (r *envReader) bool(name string, dst *bool) {
+	if value, ok := r.lookup(name); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("invalid %s %q: %w", name, value, err))
+			return
+		}
+		*dst = b
+	}
+}
+
+// ParseRoots parses a comma-separated list of name=dir named workspace roots.
+func ParseRoots(spec string) (map[string]string, error) {
+	roots := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, dir, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=dir, got %q", pair)
+		}
+		roots[strings.TrimSpace(name)] = strings.TrimSpace(dir)
+	}
+	return roots, nil
+}
+
+// ParseToolTimeouts parses a comma-separated list of name=duration tool timeouts.
+func ParseToolTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=duration, got %q", pair)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for tool %q: %w", name, err)
+		}
+		timeouts[strings.TrimSpace(name)] = timeout
+	}
+	return timeouts, nil
+}
+
+// ParseStopSequences splits a comma-separated list of stop sequences, dropping empty entries.
+func ParseStopSequences(spec string) []string {
+	var sequences []string
+	for _, sequence := range strings.Split(spec, ",") {
+		if sequence != "" {
+			sequences = append(sequences, sequence)
+		}
+	}
+	return sequences
+}
@@ -3,9 +3,10 @@ package embedding
 import (
 	"context"
 	"errors"
-	"os"
+	"strings"
 
 	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
 
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -16,15 +17,19 @@ type OpenAIEmbeddingClient struct {
 	model  openai.EmbeddingModel // e.g., text-embedding-3-small
 }
 
-// NewOpenAIEmbeddingClient creates a new OpenAIEmbeddingClient.
-// It reads the API key from the OPENAI_API_KEY environment variable.
-func NewOpenAIEmbeddingClient(model openai.EmbeddingModel) (*OpenAIEmbeddingClient, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
+// NewOpenAIEmbeddingClient creates a new OpenAIEmbeddingClient using the configured API key,
+// base URL and embedding model. With a base URL, embeddings are requested from that server
+// instead of the OpenAI API, like the chat completions.
+func NewOpenAIEmbeddingClient(settings config.OpenAIConfig) (*OpenAIEmbeddingClient, error) {
+	if settings.APIKey == "" && settings.BaseURL == "" {
 		return nil, errors.New("OPENAI_API_KEY environment variable not set")
 	}
-	client := openai.NewClient(apiKey)
-	return &OpenAIEmbeddingClient{client: client, model: model}, nil
+	clientConfig := openai.DefaultConfig(settings.APIKey)
+	if settings.BaseURL != "" {
+		clientConfig.BaseURL = strings.TrimSuffix(settings.BaseURL, "/")
+	}
+	client := openai.NewClientWithConfig(clientConfig)
+	return &OpenAIEmbeddingClient{client: client, model: openai.EmbeddingModel(settings.EmbeddingModel)}, nil
 }
 
 // GenerateEmbeddings generates embeddings for the given texts using the specified OpenAI model.
@@ -3,94 +3,56 @@ package infrastructure
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/google/uuid"
 	"github.com/invopop/jsonschema"
 
 	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
 )
 
-// Helper function to validate and resolve paths within the workspace
-func resolveWorkspacePath(relativePath string) (string, error) {
-	// Get current working directory (project root)
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("failed to get current working directory: %w", err)
-	}
-	workspaceDir := filepath.Join(cwd, "workspace")
-
-	// Ensure the workspace directory exists, create if not
-	if _, err := os.Stat(workspaceDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(workspaceDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create workspace directory '%s': %w", workspaceDir, err)
-		}
-	}
-
-	// Clean the user-provided path and join it with the workspace directory
-	// Users should provide paths relative to workspace, e.g., "my_subdir/my_file.go"
-	// No need to prefix with "workspace/" in the input.
-	cleanedRelativePath := filepath.Clean(relativePath)
-
-	// Prevent path traversal attempts like "../sensitive_file"
-	if strings.HasPrefix(cleanedRelativePath, "..") {
-		return "", fmt.Errorf("invalid path: '%s' attempts to traverse outside the workspace", relativePath)
-	}
-
-	fullPath := filepath.Join(workspaceDir, cleanedRelativePath)
-
-	// Get absolute paths for robust comparison
-	absWorkspaceDir, err := filepath.Abs(workspaceDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path for workspace: %w", err)
-	}
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path for target: %w", err)
-	}
-
-	// Final check: Ensure the resolved absolute path is truly within the workspace directory
-	if !strings.HasPrefix(absFullPath, absWorkspaceDir) {
-		return "", fmt.Errorf("invalid path: '%s' resolves outside the workspace directory", relativePath)
-	}
-
-	return absFullPath, nil
-}
-
 // FileToolRepository manages tool definitions and provides interfaces to interact with the BraveClient API.
 // It holds a collection of tool definitions in the 'tools' slice and an instance of BraveClient in the 'braveClient'
 // field, which is used to communicate with external services.
 type FileToolRepository struct {
 	tools           []domain.ToolDefinition
+	workspace       *Workspace
 	braveClient     *BraveClient
 	vectorStore     domain.VectorStore
 	embeddingClient domain.EmbeddingClient
+	defaultTimeout  time.Duration
+	timeouts        map[string]time.Duration
 }
 
+// DefaultToolTimeout applies to tools that do not declare a timeout of their own.
+const DefaultToolTimeout = 60 * time.Second
+
 // NewFileToolRepository creates and returns a new FileToolRepository.
 // It initializes the necessary file tool definitions used for reading,
 // listing, and editing files. Additionally, if the creation of a Brave
 // web search client is successful, it also adds a web search tool to the
 // repository. The returned repository contains both the initialized tools
-// and the Brave client (if available).
-func NewFileToolRepository(vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient) *FileToolRepository {
-	braveClient, err := NewBraveClient()
+// and the Brave client (if available). The file tools work within the roots of workspace.
+func NewFileToolRepository(workspace *Workspace, vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient, brave config.BraveConfig) *FileToolRepository {
+	braveClient, err := NewBraveClient(brave)
 	var searchTool domain.ToolDefinition
 	if err == nil {
 		searchTool = SearchWebDefinition(braveClient)
 	}
 
 	tools := []domain.ToolDefinition{
-		ReadFileDefinition(),
-		ListFilesDefinition(),
-		EditFileDefinition(),
-		CreateFileDefinition(),
+		ReadFileDefinition(workspace),
+		ListFilesDefinition(workspace),
+		EditFileDefinition(workspace),
+		CreateFileDefinition(workspace),
 	}
 
 	if err == nil {
@@ -100,16 +62,19 @@ func NewFileToolRepository(vectorStore domain.VectorStore, embeddingClient domai
 	// Add Qdrant tools if vector store and embedding client are available
 	if vectorStore != nil && embeddingClient != nil {
 		tools = append(tools,
-			QdrantSearchDefinition(vectorStore, embeddingClient),
-			QdrantUpsertDefinition(vectorStore, embeddingClient),
+			QdrantSearchDefinition(workspace, vectorStore, embeddingClient),
+			QdrantUpsertDefinition(workspace, vectorStore, embeddingClient),
 		)
 	}
 
 	return &FileToolRepository{
 		tools:           tools,
+		workspace:       workspace,
 		braveClient:     braveClient,
 		vectorStore:     vectorStore,
 		embeddingClient: embeddingClient,
+		defaultTimeout:  DefaultToolTimeout,
+		timeouts:        make(map[string]time.Duration),
 	}
 }
 
@@ -136,26 +101,113 @@ func (r *FileToolRepository) FindToolByName(name string) (domain.ToolDefinition,
 // It searches for the tool definition by name and, if found, calls the tool's function with the input.
 // If the tool is not found, it returns a result indicating the tool was not found.
 // If an error occurs during execution, it returns the error message.
+// The tool runs with the timeout of its definition (or the repository default); if the timeout
+// expires or ctx is cancelled first, a structured error result is returned. Read-only tools are not
+// waited for; tools with side effects are, so that a change is never made after the model was told
+// that the tool failed.
 // Parameters:
+//   - ctx: The context for the tool execution, cancelled e.g. when the user presses Ctrl+C.
 //   - id: The identifier for the tool execution.
 //   - name: The name of the tool to execute.
 //   - input: The JSON-encoded input for the tool.
 //
 // Returns:
 //
-//	anthropic.ContentBlockParamUnion: The result of the tool execution, which may include an error message.
-func (r *FileToolRepository) ExecuteTool(id, name string, input json.RawMessage) anthropic.ContentBlockParamUnion {
+//	domain.ContentBlock: The tool_result block of the tool execution, which may include an error message.
+func (r *FileToolRepository) ExecuteTool(ctx context.Context, id, name string, input json.RawMessage) domain.ContentBlock {
 	toolDef, found := r.FindToolByName(name)
 	if !found {
-		return anthropic.NewToolResultBlock(id, "tool not found", true)
+		return domain.NewToolResultBlock(id, "tool not found", true)
 	}
 
-	fmt.Printf("\u001b[92mtool\u001b[0m: %s(%s)\n", name, input)
-	response, err := toolDef.Function(input)
+	timeout := r.toolTimeout(toolDef)
+	toolCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type toolOutput struct {
+		response string
+		err      error
+	}
+	done := make(chan toolOutput, 1)
+
+	go func() {
+		response, err := toolDef.Function(toolCtx, input)
+		done <- toolOutput{response: response, err: err}
+	}()
+
+	var output toolOutput
+	select {
+	case output = <-done:
+	case <-toolCtx.Done():
+		if toolDef.ReadOnly {
+			output = toolOutput{err: toolCtx.Err()}
+		} else {
+			// The tool may still write; report what it actually did
+			output = <-done
+		}
+	}
+
+	switch {
+	case output.err == nil:
+		return domain.NewToolResultBlock(id, output.response, false)
+	case errors.Is(output.err, context.DeadlineExceeded) && ctx.Err() == nil:
+		return toolErrorResult(id, toolError{
+			Error:          "timeout",
+			Tool:           name,
+			Message:        fmt.Sprintf("tool '%s' did not finish within %s", name, timeout),
+			TimeoutSeconds: timeout.Seconds(),
+		})
+	case ctx.Err() != nil:
+		return toolErrorResult(id, toolError{
+			Error:   "cancelled",
+			Tool:    name,
+			Message: fmt.Sprintf("tool '%s' was cancelled: %v", name, ctx.Err()),
+		})
+	default:
+		return domain.NewToolResultBlock(id, fmt.Sprintf("Error executing tool '%s': %v", name, output.err), true)
+	}
+}
+
+// toolError is the structured error reported to the model when a tool times out or is cancelled.
+type toolError struct {
+	Error          string  `json:"error"`
+	Tool           string  `json:"tool"`
+	Message        string  `json:"message"`
+	TimeoutSeconds float64 `json:"timeout_seconds,omitempty"`
+}
+
+// toolErrorResult returns a tool_result error block carrying the JSON-encoded toolError.
+func toolErrorResult(id string, toolErr toolError) domain.ContentBlock {
+	content, err := json.Marshal(toolErr)
 	if err != nil {
-		return anthropic.NewToolResultBlock(id, fmt.Sprintf("Error executing tool '%s': %v", name, err), true)
+		return domain.NewToolResultBlock(id, toolErr.Message, true)
+	}
+	return domain.NewToolResultBlock(id, string(content), true)
+}
+
+// SetTimeouts configures tool timeouts. defaultTimeout applies to tools without a timeout
+// of their own; overrides maps tool names to timeouts that take precedence over both.
+// Non-positive values are ignored.
+func (r *FileToolRepository) SetTimeouts(defaultTimeout time.Duration, overrides map[string]time.Duration) {
+	if defaultTimeout > 0 {
+		r.defaultTimeout = defaultTimeout
+	}
+	for name, timeout := range overrides {
+		if timeout > 0 {
+			r.timeouts[name] = timeout
+		}
+	}
+}
+
+// toolTimeout returns the timeout that applies to the given tool.
+func (r *FileToolRepository) toolTimeout(toolDef domain.ToolDefinition) time.Duration {
+	if timeout, ok := r.timeouts[toolDef.Name]; ok {
+		return timeout
+	}
+	if toolDef.Timeout > 0 {
+		return toolDef.Timeout
 	}
-	return anthropic.NewToolResultBlock(id, response, false)
+	return r.defaultTimeout
 }
 
 // GenerateSchema creates a JSON schema for the specified type T.
@@ -163,8 +215,8 @@ func (r *FileToolRepository) ExecuteTool(id, name string, input json.RawMessage)
 // The generated schema does not allow additional properties and does not create references.
 // Returns:
 //
-//	anthropic.ToolInputSchemaParam: The generated JSON schema for the input type.
-func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
+//	domain.ToolInputSchema: The generated JSON schema for the input type.
+func GenerateSchema[T any]() domain.ToolInputSchema {
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
 		DoNotReference:            true,
@@ -173,8 +225,9 @@ func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
 
 	schema := reflector.Reflect(v)
 
-	return anthropic.ToolInputSchemaParam{
+	return domain.ToolInputSchema{
 		Properties: schema.Properties,
+		Required:   schema.Required,
 		Type:       "object",
 	}
 }
@@ -193,8 +246,10 @@ func SearchWebDefinition(braveClient *BraveClient) domain.ToolDefinition {
 		Name:        "search_web",
 		Description: "Search the web using Brave Search API. Use this when you need to find information on the internet.",
 		InputSchema: GenerateSchema[SearchWebInput](),
-		Function: func(input json.RawMessage) (string, error) {
-			return SearchWeb(braveClient, input)
+		ReadOnly:    true,
+		Timeout:     30 * time.Second,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return SearchWeb(ctx, braveClient, input)
 		},
 	}
 }
@@ -205,13 +260,14 @@ func SearchWebDefinition(braveClient *BraveClient) domain.ToolDefinition {
 // On success, it returns the search results as a formatted JSON string.
 //
 // Parameters:
+//   - ctx: The context for the search request.
 //   - braveClient: An instance of BraveClient used to perform the search.
 //   - input: A JSON-encoded raw message containing the search query.
 //
 // Returns:
 //   - A string containing the formatted JSON results of the search.
 //   - An error if the search fails or if the input is invalid.
-func SearchWeb(braveClient *BraveClient, input json.RawMessage) (string, error) {
+func SearchWeb(ctx context.Context, braveClient *BraveClient, input json.RawMessage) (string, error) {
 	if braveClient == nil {
 		return "", fmt.Errorf("Brave Search API client is not configured (BRAVE_API_KEY missing?)")
 	}
@@ -225,7 +281,7 @@ func SearchWeb(braveClient *BraveClient, input json.RawMessage) (string, error)
 		return "", fmt.Errorf("query is required for search_web")
 	}
 
-	results, err := braveClient.Search(searchWebInput.Query)
+	results, err := braveClient.Search(ctx, searchWebInput.Query)
 	if err != nil {
 		return "", fmt.Errorf("Brave Search API error: %w", err)
 	}
@@ -247,19 +303,22 @@ type ReadFileInput struct {
 // ReadFileDefinition returns a ToolDefinition for the "read_file" tool, which allows reading the contents
 // of a specified file within the workspace directory. This tool should be used to inspect the contents of files.
 // The path must be relative to the workspace directory.
-func ReadFileDefinition() domain.ToolDefinition {
+func ReadFileDefinition(workspace *Workspace) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "read_file",
-		Description: "Read the contents of a file within the workspace directory. Provide the path relative to the workspace root (e.g., 'subdir/my_file.txt'). Do not use directory names.",
+		Description: "Read the contents of a file within the workspace directory. Provide the path relative to the workspace root (e.g., 'subdir/my_file.txt'). Do not use directory names." + workspace.pathHelp(),
 		InputSchema: GenerateSchema[ReadFileInput](),
-		Function:    ReadFile,
+		ReadOnly:    true,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return ReadFile(ctx, workspace, input)
+		},
 	}
 }
 
 // ReadFile reads the contents of a file specified in the input JSON, ensuring it's within the workspace.
 // The input must contain the file path relative to the workspace.
 // It returns the file contents as a string, or an error if the path is invalid or the file cannot be read.
-func ReadFile(input json.RawMessage) (string, error) {
+func ReadFile(ctx context.Context, workspace *Workspace, input json.RawMessage) (string, error) {
 	var readFileInput ReadFileInput
 	err := json.Unmarshal(input, &readFileInput)
 	if err != nil {
@@ -269,7 +328,7 @@ func ReadFile(input json.RawMessage) (string, error) {
 		return "", fmt.Errorf("path is required for read_file")
 	}
 
-	absPath, err := resolveWorkspacePath(readFileInput.Path)
+	absPath, err := workspace.Resolve(readFileInput.Path)
 	if err != nil {
 		return "", err
 	}
@@ -301,19 +360,23 @@ type ListFilesInput struct {
 
 // ListFilesDefinition returns a ToolDefinition for listing files and directories within the workspace.
 // It lists files in the specified path relative to the workspace root.
-func ListFilesDefinition() domain.ToolDefinition {
+func ListFilesDefinition(workspace *Workspace) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "list_files",
-		Description: "List files and directories within the workspace directory. Provide the path relative to the workspace root (e.g., 'subdir' or '.'). Defaults to the workspace root if no path is provided.",
+		Description: "List files and directories within the workspace directory. Provide the path relative to the workspace root (e.g., 'subdir' or '.'). Defaults to the workspace root if no path is provided." + workspace.pathHelp(),
 		InputSchema: GenerateSchema[ListFilesInput](),
-		Function:    ListFiles,
+		ReadOnly:    true,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return ListFiles(ctx, workspace, input)
+		},
 	}
 }
 
 // ListFiles lists files and directories within a specified path inside the workspace.
 // The input path is relative to the workspace root. Defaults to the workspace root if empty.
-// Returns a JSON-encoded list of relative paths (directories suffixed with '/').
-func ListFiles(input json.RawMessage) (string, error) {
+// Returns a JSON-encoded list of relative paths (directories suffixed with '/'), prefixed with
+// the root name for the named roots.
+func ListFiles(ctx context.Context, workspace *Workspace, input json.RawMessage) (string, error) {
 	var listFilesInput ListFilesInput
 	if len(input) > 0 && string(input) != "null" && string(input) != "{}" {
 		err := json.Unmarshal(input, &listFilesInput)
@@ -322,11 +385,13 @@ func ListFiles(input json.RawMessage) (string, error) {
 		}
 	}
 	relativePath := listFilesInput.Path
-	if relativePath == "" {
-		relativePath = "."
+	root, pathInRoot := domain.SplitRootPath(relativePath)
+	if pathInRoot == "" {
+		pathInRoot = "."
+		relativePath = domain.JoinRootPath(root, pathInRoot)
 	}
 
-	absPath, err := resolveWorkspacePath(relativePath)
+	absPath, err := workspace.Resolve(relativePath)
 	if err != nil {
 		return "", err
 	}
@@ -353,7 +418,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 		if entry.IsDir() {
 			name += "/"
 		}
-		results = append(results, filepath.ToSlash(filepath.Join(relativePath, name)))
+		results = append(results, domain.JoinRootPath(root, filepath.ToSlash(filepath.Join(pathInRoot, name))))
 	}
 
 	resultJSON, err := json.Marshal(results)
@@ -374,66 +439,110 @@ type EditFileInput struct {
 }
 
 // EditFileDefinition returns the tool definition for editing a file within the workspace.
-func EditFileDefinition() domain.ToolDefinition {
+func EditFileDefinition(workspace *Workspace) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "edit_file",
-		Description: "Search for an exact string ('old_str') in a file within the workspace (specified by 'path' relative to workspace root) and replace its single occurrence with 'new_str'. Fails if 'old_str' is not found or found multiple times.",
+		Description: "Search for an exact string ('old_str') in a file within the workspace (specified by 'path' relative to workspace root) and replace its single occurrence with 'new_str'. Fails if 'old_str' is not found or found multiple times." + workspace.pathHelp(),
 		InputSchema: GenerateSchema[EditFileInput](),
-		Function:    EditFile,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return EditFile(ctx, workspace, input)
+		},
+		Preview: func(input json.RawMessage) (domain.FileChange, error) {
+			return PreviewEditFile(workspace, input)
+		},
+		Revise: func(input json.RawMessage, content string) (json.RawMessage, error) {
+			return ReviseEditFile(workspace, input, content)
+		},
 	}
 }
 
-// EditFile reads a file, replaces exactly one occurrence of oldStr with newStr, and writes it back.
-// Paths are resolved relative to the workspace directory.
-func EditFile(input json.RawMessage) (string, error) {
+// fileEdit is a planned change to a file: where it is written, with which permissions, and the change itself.
+type fileEdit struct {
+	absPath string
+	mode    os.FileMode
+	change  domain.FileChange
+}
+
+// planEditFile checks an edit_file input against the file on disk and computes the edited content.
+func planEditFile(workspace *Workspace, input json.RawMessage) (fileEdit, error) {
 	var editFileInput EditFileInput
 	err := json.Unmarshal(input, &editFileInput)
 	if err != nil {
-		return "", fmt.Errorf("invalid input format for edit_file: %w", err)
+		return fileEdit{}, fmt.Errorf("invalid input format for edit_file: %w", err)
 	}
 
 	if editFileInput.Path == "" || editFileInput.OldStr == "" {
-		return "", fmt.Errorf("path and old_str are required for edit_file")
+		return fileEdit{}, fmt.Errorf("path and old_str are required for edit_file")
 	}
 
-	absPath, err := resolveWorkspacePath(editFileInput.Path)
+	absPath, err := workspace.Resolve(editFileInput.Path)
 	if err != nil {
-		return "", err
+		return fileEdit{}, err
 	}
 
 	fileInfo, err := os.Stat(absPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("file not found at path '%s' within workspace", editFileInput.Path)
+			return fileEdit{}, fmt.Errorf("file not found at path '%s' within workspace", editFileInput.Path)
 		}
-		return "", fmt.Errorf("failed to stat file '%s': %w", editFileInput.Path, err)
+		return fileEdit{}, fmt.Errorf("failed to stat file '%s': %w", editFileInput.Path, err)
 	}
 	if fileInfo.IsDir() {
-		return "", fmt.Errorf("path '%s' is a directory, cannot edit", editFileInput.Path)
+		return fileEdit{}, fmt.Errorf("path '%s' is a directory, cannot edit", editFileInput.Path)
 	}
 
 	contentBytes, err := os.ReadFile(absPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file '%s': %w", editFileInput.Path, err)
+		return fileEdit{}, fmt.Errorf("failed to read file '%s': %w", editFileInput.Path, err)
 	}
 	content := string(contentBytes)
 
 	count := strings.Count(content, editFileInput.OldStr)
 	if count == 0 {
-		return "", fmt.Errorf("string '%s' not found in file '%s'", editFileInput.OldStr, editFileInput.Path)
+		return fileEdit{}, fmt.Errorf("string '%s' not found in file '%s'", editFileInput.OldStr, editFileInput.Path)
 	}
 	if count > 1 {
-		return "", fmt.Errorf("string '%s' found multiple times (%d) in file '%s', expected exactly one", editFileInput.OldStr, count, editFileInput.Path)
+		return fileEdit{}, fmt.Errorf("string '%s' found multiple times (%d) in file '%s', expected exactly one", editFileInput.OldStr, count, editFileInput.Path)
 	}
 
 	newContent := strings.Replace(content, editFileInput.OldStr, editFileInput.NewStr, 1)
+	return fileEdit{
+		absPath: absPath,
+		mode:    fileInfo.Mode(),
+		change:  domain.FileChange{Path: editFileInput.Path, Before: content, After: newContent},
+	}, nil
+}
 
-	err = os.WriteFile(absPath, []byte(newContent), fileInfo.Mode())
+// EditFile reads a file, replaces exactly one occurrence of oldStr with newStr, and writes it back.
+// Paths are resolved relative to the workspace directory.
+func EditFile(ctx context.Context, workspace *Workspace, input json.RawMessage) (string, error) {
+	edit, err := planEditFile(workspace, input)
 	if err != nil {
-		return "", fmt.Errorf("failed to write changes to file '%s': %w", editFileInput.Path, err)
+		return "", err
 	}
 
-	return fmt.Sprintf("Successfully edited file '%s'", editFileInput.Path), nil
+	err = os.WriteFile(edit.absPath, []byte(edit.change.After), edit.mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to write changes to file '%s': %w", edit.change.Path, err)
+	}
+
+	return fmt.Sprintf("Successfully edited file '%s'", edit.change.Path), nil
+}
+
+// PreviewEditFile returns the change an edit_file call would make, without making it.
+func PreviewEditFile(workspace *Workspace, input json.RawMessage) (domain.FileChange, error) {
+	edit, err := planEditFile(workspace, input)
+	return edit.change, err
+}
+
+// ReviseEditFile returns an edit_file input that gives the file the content the user edited
+// during review, by replacing the whole current content of the file.
+func ReviseEditFile(workspace *Workspace, input json.RawMessage, content string) (json.RawMessage, error) {
+	edit, err := planEditFile(workspace, input)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(EditFileInput{Path: edit.change.Path, OldStr: edit.change.Before, NewStr: content})
 }
 
 // CreateFileInput defines the input for creating a new file within the workspace.
@@ -443,50 +552,87 @@ type CreateFileInput struct {
 }
 
 // CreateFileDefinition returns the tool definition for creating a new file within the workspace.
-func CreateFileDefinition() domain.ToolDefinition {
+func CreateFileDefinition(workspace *Workspace) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "create_file",
-		Description: "Create a new file with the specified content at a path relative to the workspace root. Fails if the file already exists or the path is invalid.",
+		Description: "Create a new file with the specified content at a path relative to the workspace root. Fails if the file already exists or the path is invalid." + workspace.pathHelp(),
 		InputSchema: GenerateSchema[CreateFileInput](),
-		Function:    CreateFile,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return CreateFile(ctx, workspace, input)
+		},
+		Preview: func(input json.RawMessage) (domain.FileChange, error) {
+			return PreviewCreateFile(workspace, input)
+		},
+		Revise: ReviseCreateFile,
 	}
 }
 
-// CreateFile creates a new file at the specified path within the workspace.
-// Fails if the file already exists or the path is invalid.
-func CreateFile(input json.RawMessage) (string, error) {
+// planCreateFile checks a create_file input against the workspace.
+func planCreateFile(workspace *Workspace, input json.RawMessage) (fileEdit, error) {
 	var createFileInput CreateFileInput
 	err := json.Unmarshal(input, &createFileInput)
 	if err != nil {
-		return "", fmt.Errorf("invalid input format for create_file: %w", err)
+		return fileEdit{}, fmt.Errorf("invalid input format for create_file: %w", err)
 	}
 
 	if createFileInput.Path == "" {
-		return "", fmt.Errorf("path is required for create_file")
+		return fileEdit{}, fmt.Errorf("path is required for create_file")
 	}
 
-	absPath, err := resolveWorkspacePath(createFileInput.Path)
+	absPath, err := workspace.Resolve(createFileInput.Path)
 	if err != nil {
-		return "", err
+		return fileEdit{}, err
 	}
 
 	if _, err := os.Stat(absPath); err == nil {
-		return "", fmt.Errorf("file already exists at path '%s'", createFileInput.Path)
+		return fileEdit{}, fmt.Errorf("file already exists at path '%s'", createFileInput.Path)
 	} else if !os.IsNotExist(err) {
-		return "", fmt.Errorf("failed to check file status for '%s': %w", createFileInput.Path, err)
+		return fileEdit{}, fmt.Errorf("failed to check file status for '%s': %w", createFileInput.Path, err)
+	}
+
+	return fileEdit{
+		absPath: absPath,
+		mode:    0644,
+		change:  domain.FileChange{Path: createFileInput.Path, After: createFileInput.Content, Create: true},
+	}, nil
+}
+
+// ReviseCreateFile returns a create_file input that creates the file with the content the user
+// edited during review.
+func ReviseCreateFile(input json.RawMessage, content string) (json.RawMessage, error) {
+	var createFileInput CreateFileInput
+	if err := json.Unmarshal(input, &createFileInput); err != nil {
+		return nil, fmt.Errorf("invalid input format for create_file: %w", err)
+	}
+	createFileInput.Content = content
+	return json.Marshal(createFileInput)
+}
+
+// CreateFile creates a new file at the specified path within the workspace.
+// Fails if the file already exists or the path is invalid.
+func CreateFile(ctx context.Context, workspace *Workspace, input json.RawMessage) (string, error) {
+	edit, err := planCreateFile(workspace, input)
+	if err != nil {
+		return "", err
 	}
 
-	parentDir := filepath.Dir(absPath)
+	parentDir := filepath.Dir(edit.absPath)
 	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create parent directory for '%s': %w", createFileInput.Path, err)
+		return "", fmt.Errorf("failed to create parent directory for '%s': %w", edit.change.Path, err)
 	}
 
-	err = os.WriteFile(absPath, []byte(createFileInput.Content), 0644)
+	err = os.WriteFile(edit.absPath, []byte(edit.change.After), edit.mode)
 	if err != nil {
-		return "", fmt.Errorf("failed to create or write file '%s': %w", createFileInput.Path, err)
+		return "", fmt.Errorf("failed to create or write file '%s': %w", edit.change.Path, err)
 	}
 
-	return fmt.Sprintf("Successfully created file '%s'", createFileInput.Path), nil
+	return fmt.Sprintf("Successfully created file '%s'", edit.change.Path), nil
+}
+
+// PreviewCreateFile returns the file a create_file call would create, without creating it.
+func PreviewCreateFile(workspace *Workspace, input json.RawMessage) (domain.FileChange, error) {
+	edit, err := planCreateFile(workspace, input)
+	return edit.change, err
 }
 
 // QdrantSearchInput defines the input for searching the Qdrant vector store.
@@ -496,20 +642,22 @@ type QdrantSearchInput struct {
 }
 
 // QdrantSearchDefinition returns a tool definition for searching in the Qdrant vector store.
-func QdrantSearchDefinition(vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient) domain.ToolDefinition {
+func QdrantSearchDefinition(workspace *Workspace, vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "qdrant_search",
 		Description: "Searches for relevant information in the Qdrant vector store (long-term memory or RAG context) using a query string.",
 		InputSchema: GenerateSchema[QdrantSearchInput](),
-		Function: func(input json.RawMessage) (string, error) {
-			return QdrantSearch(vectorStore, embeddingClient, input)
+		ReadOnly:    true,
+		Timeout:     30 * time.Second,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return QdrantSearch(ctx, workspace, vectorStore, embeddingClient, input)
 		},
 	}
 }
 
 // QdrantSearch performs a search in the Qdrant vector store.
-// If vector search fails, it falls back to searching fallback files.
-func QdrantSearch(vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient, input json.RawMessage) (string, error) {
+// If vector search fails, it falls back to searching fallback files in the default workspace root.
+func QdrantSearch(ctx context.Context, workspace *Workspace, vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient, input json.RawMessage) (string, error) {
 	if vectorStore == nil || embeddingClient == nil {
 		return "", fmt.Errorf("vector store or embedding client is not configured")
 	}
@@ -529,32 +677,32 @@ func QdrantSearch(vectorStore domain.VectorStore, embeddingClient domain.Embeddi
 	}
 
 	// Create embedding for the query
-	fmt.Println("Generating embeddings for search query...")
-	embeddings, err := embeddingClient.GenerateEmbeddings(context.Background(), []string{searchInput.Query})
+	embeddings, err := embeddingClient.GenerateEmbeddings(ctx, []string{searchInput.Query})
 	if err != nil {
-		fmt.Printf("Error generating embeddings: %v\n", err)
-		return fallbackToFileSearch(searchInput.Query)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Warning: qdrant_search failed to generate embeddings, falling back to file search: %v\n", err)
+		return fallbackToFileSearch(workspace, searchInput.Query)
 	}
 
 	if len(embeddings) == 0 {
-		fmt.Println("No embeddings generated for search query")
-		return fallbackToFileSearch(searchInput.Query)
+		log.Println("Warning: qdrant_search got no embeddings for the query, falling back to file search")
+		return fallbackToFileSearch(workspace, searchInput.Query)
 	}
 
 	// Search in vector store
-	fmt.Println("Attempting to search in vector store...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	results, err := vectorStore.Query(ctx, embeddings[0], searchInput.K)
 	if err != nil {
-		fmt.Printf("Error searching in vector store: %v\n", err)
-		return fallbackToFileSearch(searchInput.Query)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Warning: qdrant_search failed to query the vector store, falling back to file search: %v\n", err)
+		return fallbackToFileSearch(workspace, searchInput.Query)
 	}
 
 	if len(results) == 0 {
-		fmt.Println("No results found in vector store, falling back to file search")
-		return fallbackToFileSearch(searchInput.Query)
+		return fallbackToFileSearch(workspace, searchInput.Query)
 	}
 
 	resultJSON, err := json.MarshalIndent(results, "", "  ")
@@ -565,19 +713,10 @@ func QdrantSearch(vectorStore domain.VectorStore, embeddingClient domain.Embeddi
 	return string(resultJSON), nil
 }
 
-// fallbackToFileSearch searches for relevant information in fallback files
-func fallbackToFileSearch(query string) (string, error) {
-	fmt.Println("Falling back to file search...")
-
-	// Get workspace directory
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("failed to get current working directory: %w", err)
-	}
-	workspaceDir := filepath.Join(cwd, "workspace")
-
+// fallbackToFileSearch searches for relevant information in the fallback files of the default workspace root
+func fallbackToFileSearch(workspace *Workspace, query string) (string, error) {
 	// Find all fallback files
-	pattern := filepath.Join(workspaceDir, "vector_store_fallback_*.txt")
+	pattern := filepath.Join(workspace.Dir(), "vector_store_fallback_*.txt")
 	files, err := filepath.Glob(pattern)
 	if err != nil {
 		return "", fmt.Errorf("failed to list fallback files: %w", err)
@@ -601,7 +740,7 @@ func fallbackToFileSearch(query string) (string, error) {
 	for _, file := range files {
 		content, err := os.ReadFile(file)
 		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", file, err)
+			log.Printf("Warning: Failed to read fallback file %s: %v\n", file, err)
 			continue
 		}
 
@@ -675,27 +814,27 @@ type QdrantUpsertInput struct {
 }
 
 // QdrantUpsertDefinition returns a tool definition for upserting into the Qdrant vector store.
-func QdrantUpsertDefinition(vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient) domain.ToolDefinition {
+func QdrantUpsertDefinition(workspace *Workspace, vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient) domain.ToolDefinition {
 	return domain.ToolDefinition{
 		Name:        "qdrant_upsert",
 		Description: "Upserts (inserts or updates) information into the Qdrant vector store (long-term memory or RAG context).",
 		InputSchema: GenerateSchema[QdrantUpsertInput](),
-		Function: func(input json.RawMessage) (string, error) {
-			return QdrantUpsert(vectorStore, embeddingClient, input)
+		Timeout:     60 * time.Second,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return QdrantUpsert(ctx, workspace, vectorStore, embeddingClient, input)
 		},
 	}
 }
 
 // QdrantUpsert performs an upsert operation in the Qdrant vector store.
-// If the upsert to vector store fails, it automatically falls back to saving the content as a file.
-func QdrantUpsert(vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient, input json.RawMessage) (string, error) {
+// If the upsert to vector store fails, it automatically falls back to saving the content as a file
+// in the default workspace root.
+func QdrantUpsert(ctx context.Context, workspace *Workspace, vectorStore domain.VectorStore, embeddingClient domain.EmbeddingClient, input json.RawMessage) (string, error) {
 	if vectorStore == nil {
-		fmt.Println("Error: Vector store is nil")
 		return "", fmt.Errorf("vector store is not configured")
 	}
 
 	if embeddingClient == nil {
-		fmt.Println("Error: Embedding client is nil")
 		return "", fmt.Errorf("embedding client is not configured")
 	}
 
@@ -710,33 +849,27 @@ func QdrantUpsert(vectorStore domain.VectorStore, embeddingClient domain.Embeddi
 	}
 
 	// Create embedding for the text content
-	fmt.Println("Generating embeddings via OpenAI API...")
-
-	// Using timeout context for embedding generation
-	embedCtx, embedCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer embedCancel()
-
-	embeddings, err := embeddingClient.GenerateEmbeddings(embedCtx, []string{upsertInput.TextContent})
+	embeddings, err := embeddingClient.GenerateEmbeddings(ctx, []string{upsertInput.TextContent})
 	if err != nil {
-		fmt.Printf("Error generating embeddings: %v\n", err)
-		return fallbackToFileStore(upsertInput)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Warning: qdrant_upsert failed to generate embeddings, falling back to file storage: %v\n", err)
+		return fallbackToFileStore(ctx, workspace, upsertInput)
 	}
 
 	if len(embeddings) == 0 {
-		fmt.Println("No embeddings generated - empty result from embedding client")
-		return fallbackToFileStore(upsertInput)
+		log.Println("Warning: qdrant_upsert got no embeddings from the embedding client, falling back to file storage")
+		return fallbackToFileStore(ctx, workspace, upsertInput)
 	}
 
 	if len(embeddings[0]) == 0 {
-		fmt.Println("Generated embedding has zero dimensions - invalid embedding")
-		return fallbackToFileStore(upsertInput)
+		log.Println("Warning: qdrant_upsert got an embedding with zero dimensions, falling back to file storage")
+		return fallbackToFileStore(ctx, workspace, upsertInput)
 	}
 
-	fmt.Printf("Successfully generated embedding with %d dimensions\n", len(embeddings[0]))
-
 	// Create a UUID for the vector
 	id := uuid.New().String()
-	fmt.Printf("Created UUID: %s\n", id)
 
 	// Prepare the point with embedding, payload and ID
 	point := domain.Snippet{
@@ -751,35 +884,21 @@ func QdrantUpsert(vectorStore domain.VectorStore, embeddingClient domain.Embeddi
 		Symbols:   []string{},
 	}
 
-	// Log the prepared point
-	fmt.Printf("Prepared snippet with ID: %s, Embedding length: %d, Content length: %d bytes\n",
-		point.ID, len(point.Embedding), len(point.Content))
-
-	if len(point.Metadata) > 0 {
-		fmt.Println("Metadata fields:")
-		for k, v := range point.Metadata {
-			fmt.Printf("  %s: %s\n", k, v)
-		}
-	}
-
 	// Upsert the point
-	fmt.Println("Attempting to upsert to vector store...")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	err = vectorStore.Upsert(ctx, []domain.Snippet{point})
 	if err != nil {
-		fmt.Printf("Error upserting to vector store: %v\n", err)
-		return fallbackToFileStore(upsertInput)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Warning: qdrant_upsert failed to upsert to the vector store, falling back to file storage: %v\n", err)
+		return fallbackToFileStore(ctx, workspace, upsertInput)
 	}
 
 	return fmt.Sprintf("Successfully upserted content with ID: %s", id), nil
 }
 
 // fallbackToFileStore saves the content to a file when vector store operations fail
-func fallbackToFileStore(input QdrantUpsertInput) (string, error) {
-	fmt.Println("Falling back to file storage...")
-
+func fallbackToFileStore(ctx context.Context, workspace *Workspace, input QdrantUpsertInput) (string, error) {
 	// Create a filename based on the current timestamp
 	timestamp := time.Now().Format("20241201_120000")
 	filename := fmt.Sprintf("vector_store_fallback_%s.txt", timestamp)
@@ -806,5 +925,5 @@ func fallbackToFileStore(input QdrantUpsertInput) (string, error) {
 		return "", fmt.Errorf("failed to create fallback file (marshal error): %w", err)
 	}
 
-	return CreateFile(inputJSON)
+	return CreateFile(ctx, workspace, inputJSON)
 }
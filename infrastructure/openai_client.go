@@ -0,0 +1,419 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
+)
+
+// OpenAIChatClient implements domain.AIClient against any OpenAI-compatible
+// /v1/chat/completions endpoint, such as OpenAI itself, llama.cpp or vLLM.
+type OpenAIChatClient struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIChatClient creates a new OpenAI-compatible chat client.
+//
+// It uses the following settings:
+//   - BaseURL: The API base URL, e.g. "http://localhost:8080/v1". Empty uses the OpenAI API.
+//   - ChatModel: The model name to request when the model settings name none.
+//   - APIKey: The API key. Only required when talking to the OpenAI API itself;
+//     self-hosted servers usually accept any key.
+//
+// Returns:
+//
+//	*OpenAIChatClient: A pointer to the new client.
+//	error: An error if the client could not be created.
+func NewOpenAIChatClient(settings config.OpenAIConfig) (*OpenAIChatClient, error) {
+	if settings.APIKey == "" && settings.BaseURL == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set (set OPENAI_BASE_URL to use a self-hosted server without a key)")
+	}
+
+	clientConfig := openai.DefaultConfig(settings.APIKey)
+	if settings.BaseURL != "" {
+		clientConfig.BaseURL = strings.TrimSuffix(settings.BaseURL, "/")
+	}
+	clientConfig.HTTPClient = explicitZeroDoer{doer: clientConfig.HTTPClient}
+
+	return &OpenAIChatClient{
+		client: openai.NewClientWithConfig(clientConfig),
+		model:  settings.ChatModel,
+	}, nil
+}
+
+// RunInference sends a conversation to the chat-completions endpoint and returns the response.
+//
+// The domain.ToolDefinition schemas are sent as function-calling tools, and any tool_calls in the
+// response are mapped back to tool_use content blocks.
+func (c *OpenAIChatClient) RunInference(ctx context.Context, request domain.InferenceRequest) (*domain.Message, error) {
+	ctx = withExplicitZeros(ctx, request.Settings)
+	resp, err := c.client.CreateChatCompletion(ctx, c.newChatCompletionRequest(request))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion returned no choices")
+	}
+
+	choice := resp.Choices[0]
+	message := domain.NewAssistantMessage()
+	message.StopReason = toDomainStopReason(choice.FinishReason)
+	message.Model = resp.Model
+	message.Usage = fromOpenAIUsage(resp.Usage)
+	if choice.Message.Content != "" {
+		message.Content = append(message.Content, domain.NewTextBlock(choice.Message.Content))
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		message.Content = append(message.Content, domain.NewToolUseBlock(toolCall.ID, toolCall.Function.Name, toolCallInput(toolCall.Function.Arguments)))
+	}
+
+	return &message, nil
+}
+
+// StreamInference sends a conversation to the chat-completions endpoint in streaming mode
+// and returns an iterator over the incremental response events.
+func (c *OpenAIChatClient) StreamInference(ctx context.Context, request domain.InferenceRequest) (domain.InferenceStream, error) {
+	req := c.newChatCompletionRequest(request)
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := c.client.CreateChatCompletionStream(withExplicitZeros(ctx, request.Settings), req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openAIStream{stream: stream, textIndex: -1, toolIndexes: map[int]int{}}, nil
+}
+
+// newChatCompletionRequest builds the request shared by RunInference and StreamInference.
+// Unset model settings fall back to the client's model and the server defaults.
+func (c *OpenAIChatClient) newChatCompletionRequest(request domain.InferenceRequest) openai.ChatCompletionRequest {
+	openaiTools := make([]openai.Tool, 0, len(request.Tools))
+	for _, tool := range request.Tools {
+		openaiTools = append(openaiTools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	messages := toOpenAIMessages(request.Conversation)
+	if request.System != "" {
+		messages = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: request.System}}, messages...)
+	}
+
+	settings := request.Settings
+	model := c.model
+	if settings.Model != "" {
+		model = settings.Model
+	}
+	maxTokens := settings.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = domain.DefaultMaxTokens
+	}
+
+	req := openai.ChatCompletionRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+		Messages:  messages,
+		Tools:     openaiTools,
+		Stop:      settings.StopSequences,
+	}
+	if settings.Temperature != nil {
+		req.Temperature = float32(*settings.Temperature)
+	}
+	if settings.TopP != nil {
+		req.TopP = float32(*settings.TopP)
+	}
+	return req
+}
+
+// explicitZerosKey is the context key of the request fields that must be sent as an explicit 0.
+type explicitZerosKey struct{}
+
+// withExplicitZeros returns a context carrying the sampling settings that are set to 0. go-openai
+// omits zero temperature and top_p from the request, which would make the server use its default.
+func withExplicitZeros(ctx context.Context, settings domain.ModelSettings) context.Context {
+	var fields []string
+	if settings.Temperature != nil && float32(*settings.Temperature) == 0 {
+		fields = append(fields, "temperature")
+	}
+	if settings.TopP != nil && float32(*settings.TopP) == 0 {
+		fields = append(fields, "top_p")
+	}
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, explicitZerosKey{}, fields)
+}
+
+// explicitZeroDoer sends requests through doer, adding the fields named by the request context
+// with the value 0 to the JSON request body.
+type explicitZeroDoer struct {
+	doer openai.HTTPDoer
+}
+
+// Do sends the request, with the explicit zero fields added to its body.
+func (d explicitZeroDoer) Do(req *http.Request) (*http.Response, error) {
+	fields, _ := req.Context().Value(explicitZerosKey{}).([]string)
+	if len(fields) == 0 || req.Body == nil {
+		return d.doer.Do(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body, err = addZeroFields(body, fields)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return d.doer.Do(req)
+}
+
+// addZeroFields sets the given fields of a JSON object to 0.
+func addZeroFields(body []byte, fields []string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, fmt.Errorf("failed to add sampling parameters to the request: %w", err)
+	}
+	for _, field := range fields {
+		object[field] = json.RawMessage("0")
+	}
+	return json.Marshal(object)
+}
+
+// toOpenAIMessages converts the domain conversation history into chat-completion messages.
+//
+// Tool results, which the domain model carries inside user messages, become separate
+// "tool" role messages placed before any remaining user content.
+func toOpenAIMessages(conversation []domain.Message) []openai.ChatCompletionMessage {
+	var messages []openai.ChatCompletionMessage
+	for _, message := range conversation {
+		if message.Role == domain.RoleAssistant {
+			assistant := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+			for _, block := range message.Content {
+				switch block.Type {
+				case domain.ContentBlockText:
+					assistant.Content += block.Text
+				case domain.ContentBlockToolUse:
+					assistant.ToolCalls = append(assistant.ToolCalls, openai.ToolCall{
+						ID:   block.ID,
+						Type: openai.ToolTypeFunction,
+						Function: openai.FunctionCall{
+							Name:      block.Name,
+							Arguments: string(block.Input),
+						},
+					})
+				}
+			}
+			messages = append(messages, assistant)
+			continue
+		}
+
+		var parts []openai.ChatMessagePart
+		hasImage := false
+		for _, block := range message.Content {
+			switch block.Type {
+			case domain.ContentBlockToolResult:
+				content := block.Content
+				if block.IsError {
+					content = "Error: " + content
+				}
+				messages = append(messages, openai.ChatCompletionMessage{
+					Role:       openai.ChatMessageRoleTool,
+					Content:    content,
+					ToolCallID: block.ToolUseID,
+				})
+			case domain.ContentBlockText:
+				parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: block.Text})
+			case domain.ContentBlockImage:
+				hasImage = true
+				parts = append(parts, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: fmt.Sprintf("data:%s;base64,%s", block.MediaType, block.Data)},
+				})
+			}
+		}
+
+		switch {
+		case len(parts) == 0:
+			// Message only carried tool results
+		case hasImage:
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts})
+		default:
+			// Plain text is sent as a string for servers without multi-part support
+			var text strings.Builder
+			for _, part := range parts {
+				text.WriteString(part.Text)
+			}
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text.String()})
+		}
+	}
+	return messages
+}
+
+// toolCallInput converts function-call arguments into tool_use input, treating empty arguments as an empty object.
+func toolCallInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// toDomainStopReason maps a chat-completion finish reason onto the domain stop reasons.
+func toDomainStopReason(reason openai.FinishReason) string {
+	switch reason {
+	case openai.FinishReasonStop:
+		return domain.StopReasonEndTurn
+	case openai.FinishReasonLength:
+		return domain.StopReasonMaxTokens
+	case openai.FinishReasonToolCalls:
+		return domain.StopReasonToolUse
+	default:
+		return string(reason)
+	}
+}
+
+// fromOpenAIUsage converts chat-completion token usage into domain usage.
+// Prompt tokens served from the server's automatic prompt cache are reported as cache reads.
+func fromOpenAIUsage(usage openai.Usage) *domain.Usage {
+	result := &domain.Usage{
+		InputTokens:  int64(usage.PromptTokens),
+		OutputTokens: int64(usage.CompletionTokens),
+	}
+	if details := usage.PromptTokensDetails; details != nil && details.CachedTokens > 0 {
+		result.CacheReadInputTokens = int64(details.CachedTokens)
+		result.InputTokens -= int64(details.CachedTokens)
+	}
+	return result
+}
+
+// openAIStream adapts a chat-completion stream to domain.InferenceStream.
+//
+// Chat-completion chunks have no notion of content blocks, so the stream assigns
+// block indexes itself: one for the text, and one per tool call.
+type openAIStream struct {
+	stream      *openai.ChatCompletionStream
+	pending     []domain.StreamEvent
+	current     domain.StreamEvent
+	err         error
+	started     bool // Whether the message start event was emitted
+	nextIndex   int
+	textIndex   int         // Block index of the text, or -1 if no text was received yet
+	textClosed  bool        // Whether a stop event was already emitted for the text block
+	toolIndexes map[int]int // Tool call index -> block index
+}
+
+// Next advances to the next event, receiving further chunks as needed.
+func (s *openAIStream) Next() bool {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return false
+		}
+		chunk, err := s.stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.err = err
+			}
+			return false
+		}
+		s.handleChunk(chunk)
+	}
+
+	s.current = s.pending[0]
+	s.pending = s.pending[1:]
+	return true
+}
+
+// handleChunk translates a single chunk into pending stream events.
+func (s *openAIStream) handleChunk(chunk openai.ChatCompletionStreamResponse) {
+	if !s.started {
+		s.started = true
+		s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventMessageStart, Model: chunk.Model})
+	}
+	if chunk.Usage != nil {
+		// Sent in a final chunk without choices when usage reporting is requested
+		s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventMessageDelta, Usage: fromOpenAIUsage(*chunk.Usage)})
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+
+	if choice.Delta.Content != "" {
+		if s.textIndex < 0 {
+			s.textIndex = s.nextIndex
+			s.nextIndex++
+			s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventContentBlockStart, Index: s.textIndex, BlockType: "text"})
+		}
+		s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventTextDelta, Index: s.textIndex, Text: choice.Delta.Content})
+	}
+
+	for i, toolCall := range choice.Delta.ToolCalls {
+		callIndex := i
+		if toolCall.Index != nil {
+			callIndex = *toolCall.Index
+		}
+
+		blockIndex, ok := s.toolIndexes[callIndex]
+		if !ok {
+			if s.textIndex >= 0 && !s.textClosed {
+				// Close the text block so the text output ends before the tool call
+				s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventContentBlockStop, Index: s.textIndex})
+				s.textClosed = true
+			}
+			blockIndex = s.nextIndex
+			s.nextIndex++
+			s.toolIndexes[callIndex] = blockIndex
+			s.pending = append(s.pending, domain.StreamEvent{
+				Type:      domain.StreamEventContentBlockStart,
+				Index:     blockIndex,
+				BlockType: "tool_use",
+				ToolUseID: toolCall.ID,
+				ToolName:  toolCall.Function.Name,
+			})
+		}
+		if toolCall.Function.Arguments != "" {
+			s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventInputJSONDelta, Index: blockIndex, PartialJSON: toolCall.Function.Arguments})
+		}
+	}
+
+	if choice.FinishReason != "" {
+		s.pending = append(s.pending, domain.StreamEvent{Type: domain.StreamEventMessageDelta, StopReason: toDomainStopReason(choice.FinishReason)})
+	}
+}
+
+// Current returns the event the stream is positioned on.
+func (s *openAIStream) Current() domain.StreamEvent {
+	return s.current
+}
+
+// Err returns the error that terminated the stream, if any.
+func (s *openAIStream) Err() error {
+	return s.err
+}
+
+// Close releases the underlying HTTP connection.
+func (s *openAIStream) Close() error {
+	return s.stream.Close()
+}
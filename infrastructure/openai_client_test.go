@@ -0,0 +1,134 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
+)
+
+func TestToOpenAIMessages(t *testing.T) {
+	conversation := []domain.Message{
+		domain.NewUserMessage(domain.NewTextBlock("Read a.go and b.go")),
+		domain.NewAssistantMessage(
+			domain.NewThinkingBlock("Two files to read", "sig"),
+			domain.NewTextBlock("Reading them."),
+			domain.NewToolUseBlock("call_1", "read_file", json.RawMessage(`{"path":"a.go"}`)),
+			domain.NewToolUseBlock("call_2", "read_file", json.RawMessage(`{"path":"b.go"}`)),
+		),
+		domain.NewUserMessage(
+			domain.NewToolResultBlock("call_1", "package a", false),
+			domain.NewToolResultBlock("call_2", "file not found", true),
+			domain.NewTextBlock("Also look at this"),
+			domain.NewImageBlock("image/png", "aGVsbG8="),
+		),
+		domain.NewAssistantMessage(domain.NewTextBlock("Done.")),
+		domain.NewUserMessage(domain.NewTextBlock("Thanks, "), domain.NewTextBlock("bye")),
+	}
+
+	want := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Read a.go and b.go"},
+		{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: "Reading them.",
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read_file", Arguments: `{"path":"a.go"}`}},
+				{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read_file", Arguments: `{"path":"b.go"}`}},
+			},
+		},
+		{Role: openai.ChatMessageRoleTool, Content: "package a", ToolCallID: "call_1"},
+		{Role: openai.ChatMessageRoleTool, Content: "Error: file not found", ToolCallID: "call_2"},
+		{
+			Role: openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "Also look at this"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,aGVsbG8="}},
+			},
+		},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Done."},
+		{Role: openai.ChatMessageRoleUser, Content: "Thanks, bye"},
+	}
+
+	if got := toOpenAIMessages(conversation); !reflect.DeepEqual(got, want) {
+		t.Errorf("toOpenAIMessages =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestToolCallInput(t *testing.T) {
+	for arguments, want := range map[string]string{"": "{}", "  ": "{}", `{"path":"a.go"}`: `{"path":"a.go"}`} {
+		if got := string(toolCallInput(arguments)); got != want {
+			t.Errorf("toolCallInput(%q) = %s, want %s", arguments, got, want)
+		}
+	}
+}
+
+func TestToDomainStopReason(t *testing.T) {
+	tests := map[openai.FinishReason]string{
+		openai.FinishReasonStop:      domain.StopReasonEndTurn,
+		openai.FinishReasonLength:    domain.StopReasonMaxTokens,
+		openai.FinishReasonToolCalls: domain.StopReasonToolUse,
+	}
+	for reason, want := range tests {
+		if got := toDomainStopReason(reason); got != want {
+			t.Errorf("toDomainStopReason(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+func TestOpenAIChatClientSendsExplicitZeroSampling(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"test","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewOpenAIChatClient(config.OpenAIConfig{BaseURL: server.URL, ChatModel: "test"})
+	if err != nil {
+		t.Fatalf("NewOpenAIChatClient: %v", err)
+	}
+
+	zero, half := 0.0, 0.5
+	tests := []struct {
+		name     string
+		settings domain.ModelSettings
+		want     map[string]any // Expected fields; nil values must be absent
+	}{
+		{"zero", domain.ModelSettings{Temperature: &zero, TopP: &zero}, map[string]any{"temperature": 0.0, "top_p": 0.0}},
+		{"nonzero", domain.ModelSettings{Temperature: &half}, map[string]any{"temperature": 0.5, "top_p": nil}},
+		{"unset", domain.ModelSettings{}, map[string]any{"temperature": nil, "top_p": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = nil
+			request := domain.InferenceRequest{
+				Conversation: []domain.Message{domain.NewUserMessage(domain.NewTextBlock("Hi"))},
+				Settings:     tt.settings,
+			}
+			if _, err := client.RunInference(context.Background(), request); err != nil {
+				t.Fatalf("RunInference: %v", err)
+			}
+			for field, want := range tt.want {
+				got, present := body[field]
+				if want == nil && present {
+					t.Errorf("%s = %v, want it omitted", field, got)
+				}
+				if want != nil && got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
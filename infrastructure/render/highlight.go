@@ -0,0 +1,155 @@
+package render
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// Colors of syntax-highlighted code. They only change the foreground color, so that they
+// combine with the code block gutter.
+const (
+	codeKeyword  = "\x1b[35m"
+	codeString   = "\x1b[32m"
+	codeNumber   = "\x1b[36m"
+	codeComment  = "\x1b[90m"
+	codeBuiltin  = "\x1b[33m"
+	codeAdded    = "\x1b[32m"
+	codeRemoved  = "\x1b[31m"
+	codeHunk     = "\x1b[36m"
+	codeColorEnd = "\x1b[39m"
+)
+
+// highlighter colors the lines of a code block one at a time.
+type highlighter interface {
+	Line(line string) string
+}
+
+// newHighlighter returns the highlighter for the language of a fenced code block,
+// or nil if the language is not supported.
+func newHighlighter(language string) highlighter {
+	switch strings.ToLower(language) {
+	case "go", "golang":
+		return &goHighlighter{}
+	case "diff", "patch":
+		return diffHighlighter{}
+	}
+	return nil
+}
+
+// goPredeclared are the predeclared identifiers of Go: types, constants and built-in functions.
+var goPredeclared = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// goHighlighter colors Go source with the standard library scanner. Block comments and raw
+// strings that span lines are carried over to the following lines.
+type goHighlighter struct {
+	inComment   bool
+	inRawString bool
+}
+
+// Line returns the line with its tokens colored.
+func (h *goHighlighter) Line(line string) string {
+	var out strings.Builder
+	rest := line
+
+	// Finish a block comment or raw string started on an earlier line
+	if h.inComment || h.inRawString {
+		terminator, color := "*/", codeComment
+		if h.inRawString {
+			terminator, color = "`", codeString
+		}
+		end := strings.Index(rest, terminator)
+		if end < 0 {
+			return color + rest + codeColorEnd
+		}
+		end += len(terminator)
+		out.WriteString(color + rest[:end] + codeColorEnd)
+		rest = rest[end:]
+		h.inComment, h.inRawString = false, false
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(rest))
+	var s scanner.Scanner
+	s.Init(file, []byte(rest), func(token.Position, string) {}, scanner.ScanComments)
+
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // Inserted automatically at the end of the line
+		}
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		offset := file.Offset(pos)
+		if offset < last || offset+len(text) > len(rest) {
+			break // Should not happen; leave the rest of the line uncolored
+		}
+
+		out.WriteString(rest[last:offset])
+		out.WriteString(colorGoToken(tok, text))
+		last = offset + len(text)
+
+		switch {
+		case tok == token.COMMENT && strings.HasPrefix(text, "/*") && (len(text) < 4 || !strings.HasSuffix(text, "*/")):
+			h.inComment = true
+		case tok == token.STRING && strings.HasPrefix(text, "`") && (len(text) < 2 || !strings.HasSuffix(text, "`")):
+			h.inRawString = true
+		}
+	}
+	out.WriteString(rest[last:])
+	return out.String()
+}
+
+// colorGoToken returns the text of a Go token in the color of its kind.
+func colorGoToken(tok token.Token, text string) string {
+	color := ""
+	switch {
+	case tok.IsKeyword():
+		color = codeKeyword
+	case tok == token.STRING || tok == token.CHAR:
+		color = codeString
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		color = codeNumber
+	case tok == token.COMMENT:
+		color = codeComment
+	case tok == token.IDENT && goPredeclared[text]:
+		color = codeBuiltin
+	}
+	if color == "" {
+		return text
+	}
+	return color + text + codeColorEnd
+}
+
+// diffHighlighter colors added and removed lines of a unified diff.
+type diffHighlighter struct{}
+
+// Line returns the line in the color of its kind.
+func (diffHighlighter) Line(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return "\x1b[1m" + line + "\x1b[22m"
+	case strings.HasPrefix(line, "+"):
+		return codeAdded + line + codeColorEnd
+	case strings.HasPrefix(line, "-"):
+		return codeRemoved + line + codeColorEnd
+	case strings.HasPrefix(line, "@@"):
+		return codeHunk + line + codeColorEnd
+	}
+	return line
+}
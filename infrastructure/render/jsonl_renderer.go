@@ -0,0 +1,28 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"code-ai-editor/domain"
+)
+
+// JSONLinesRenderer writes every agent event as a JSON object on its own line,
+// for programs that drive the agent and present its output themselves.
+type JSONLinesRenderer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONLinesRenderer creates a JSONLinesRenderer that writes to out.
+func NewJSONLinesRenderer(out io.Writer) *JSONLinesRenderer {
+	return &JSONLinesRenderer{encoder: json.NewEncoder(out)}
+}
+
+// Emit writes the event as a single line of JSON.
+func (r *JSONLinesRenderer) Emit(event domain.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.encoder.Encode(event)
+}
@@ -0,0 +1,413 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"code-ai-editor/infrastructure/terminal"
+)
+
+// Escape codes of the Markdown styles. Each style is switched off with its own code rather
+// than a full reset, so that styles can nest.
+const (
+	mdBold       = "\x1b[1m"
+	mdBoldEnd    = "\x1b[22m"
+	mdItalic     = "\x1b[3m"
+	mdItalicEnd  = "\x1b[23m"
+	mdUnder      = "\x1b[4m"
+	mdUnderEnd   = "\x1b[24m"
+	mdHeading    = "\x1b[1;36m"
+	mdCode       = "\x1b[33m"
+	mdMuted      = "\x1b[2m"
+	mdMutedEnd   = "\x1b[22m"
+	mdColorEnd   = "\x1b[39m"
+	mdResetStyle = "\x1b[0m"
+)
+
+// DefaultFileLinkFormat is the URL that file:line references link to, unless FILE_LINK_FORMAT
+// sets another one. {path} is replaced by the absolute path, {line} and {column} by the position.
+const DefaultFileLinkFormat = "file://{path}"
+
+var (
+	fencePattern     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	headingPattern   = regexp.MustCompile(`^\s*(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern      = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	quotePattern     = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	listPattern      = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	tableSeparator   = regexp.MustCompile(`^\s*:?-+:?\s*$`)
+	codeSpanPattern  = regexp.MustCompile("`([^`]+)`")
+	linkPattern      = regexp.MustCompile(`\[([^\]]+)\]\((\S+?)\)`)
+	fileRefPattern   = regexp.MustCompile(`(?:\.{0,2}/)?[\w.-]+(?:/[\w.-]+)*\.[A-Za-z]\w*:(\d+)(?::(\d+))?`)
+	boldPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern    = regexp.MustCompile(`(^|[^*\w])\*([^*\s](?:[^*]*[^*\s])?)\*|(^|[^_\w])_([^_\s](?:[^_]*[^_\s])?)_(?:$|\W)`)
+	placeholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// markdownRenderer renders Markdown to a terminal as it streams in: headings, lists, block
+// quotes, rules, tables and fenced code blocks with syntax highlighting, bold, italic and code
+// spans, hyperlinks, and clickable file:line references. Paragraphs and list items are wrapped
+// to the terminal width.
+//
+// Text is rendered a line at a time once the line is complete, because the kind of a line
+// (a code fence, a list item, a table row) is only known from its start. Table rows are held
+// back until the table ends so that its columns can be aligned.
+type markdownRenderer struct {
+	width      func() int // Columns of the terminal; 0 disables wrapping
+	linkRoots  []string   // Directories file:line references are resolved against, in order
+	linkFormat string
+
+	pending  strings.Builder // The incomplete current line
+	fence    string          // Marker of the open code block, e.g. "```"; empty outside code blocks
+	code     highlighter     // Highlighter of the open code block; nil for unsupported languages
+	table    []string        // Rows of the table being collected
+	offset   int             // Columns taken on the first line by the reply prefix
+	rendered bool            // Whether anything was rendered since Start
+}
+
+// newMarkdownRenderer creates a markdownRenderer wrapping to the width reported by width.
+// File references are linked if the file exists relative to one of linkRoots.
+func newMarkdownRenderer(width func() int, linkRoots []string) *markdownRenderer {
+	linkFormat := os.Getenv("FILE_LINK_FORMAT")
+	if linkFormat == "" {
+		linkFormat = DefaultFileLinkFormat
+	}
+	return &markdownRenderer{width: width, linkRoots: linkRoots, linkFormat: linkFormat}
+}
+
+// Start begins a new reply, whose first line follows a prefix of the given width.
+func (m *markdownRenderer) Start(prefixWidth int) {
+	m.offset = prefixWidth
+	m.rendered = false
+}
+
+// Write consumes streamed text and returns the rendering of the lines it completed.
+func (m *markdownRenderer) Write(text string) string {
+	var out strings.Builder
+	for {
+		newline := strings.IndexByte(text, '\n')
+		if newline < 0 {
+			m.pending.WriteString(text)
+			break
+		}
+		m.pending.WriteString(text[:newline])
+		text = text[newline+1:]
+		line := m.pending.String()
+		m.pending.Reset()
+		m.renderLine(&out, line)
+	}
+	return out.String()
+}
+
+// Flush renders the incomplete last line and any table still being collected, closes an
+// unterminated code block, and ends the reply on a new line.
+func (m *markdownRenderer) Flush() string {
+	var out strings.Builder
+	if m.pending.Len() > 0 {
+		line := m.pending.String()
+		m.pending.Reset()
+		m.renderLine(&out, line)
+	}
+	m.flushTable(&out)
+	if m.fence != "" {
+		m.fence, m.code = "", nil
+		m.emit(&out, mdMuted+"└─"+mdMutedEnd+"\n")
+	}
+	if !m.rendered {
+		out.WriteString("\n")
+	}
+	m.offset = 0
+	return out.String()
+}
+
+// emit writes a rendered block. A block other than a paragraph cannot continue the line of
+// the reply prefix, so it starts on a line of its own.
+func (m *markdownRenderer) emit(out *strings.Builder, block string) {
+	if m.offset > 0 {
+		out.WriteString("\n")
+		m.offset = 0
+	}
+	out.WriteString(block)
+	m.rendered = true
+}
+
+// renderLine renders one complete line of Markdown.
+func (m *markdownRenderer) renderLine(out *strings.Builder, line string) {
+	// Inside a code block every line is code, until the closing fence
+	if m.fence != "" {
+		if strings.HasPrefix(strings.TrimSpace(line), m.fence) && strings.Trim(strings.TrimSpace(line), m.fence[:1]) == "" {
+			m.fence, m.code = "", nil
+			m.emit(out, mdMuted+"└─"+mdMutedEnd+"\n")
+			return
+		}
+		if m.code != nil {
+			line = m.code.Line(line)
+		}
+		m.emit(out, mdMuted+"│ "+mdMutedEnd+line+"\n")
+		return
+	}
+
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "|") {
+		m.table = append(m.table, trimmed)
+		return
+	}
+	m.flushTable(out)
+
+	width := m.width()
+	var match []string
+	switch {
+	case fencePattern.MatchString(line):
+		match = fencePattern.FindStringSubmatch(line)
+		m.fence, m.code = match[1], newHighlighter(match[2])
+		header := "┌─"
+		if match[2] != "" {
+			header += " " + match[2]
+		}
+		m.emit(out, mdMuted+header+mdMutedEnd+"\n")
+	case headingPattern.MatchString(line):
+		match = headingPattern.FindStringSubmatch(line)
+		style := mdHeading
+		if len(match[1]) == 1 {
+			style += mdUnder
+		}
+		m.emit(out, style+m.inline(match[2])+mdResetStyle+"\n")
+	case rulePattern.MatchString(line):
+		columns := width
+		if columns <= 0 || columns > 80 {
+			columns = 80
+		}
+		m.emit(out, mdMuted+strings.Repeat("─", columns)+mdMutedEnd+"\n")
+	case quotePattern.MatchString(line):
+		match = quotePattern.FindStringSubmatch(line)
+		gutter := mdMuted + "│ " + mdMutedEnd
+		m.emit(out, wrap(mdItalic+m.inline(match[1])+mdItalicEnd, width, gutter, gutter, 0))
+	case listPattern.MatchString(line):
+		match = listPattern.FindStringSubmatch(line)
+		indent, marker := match[1], match[2]
+		if !strings.ContainsAny(marker[len(marker)-1:], ".)") {
+			marker = "•"
+		}
+		first := indent + marker + " "
+		hanging := strings.Repeat(" ", terminal.DisplayWidth(first))
+		m.emit(out, wrap(m.inline(match[3]), width, first, hanging, 0))
+	case trimmed == "":
+		m.emit(out, "\n")
+	default:
+		// A paragraph line may continue the line of the reply prefix
+		offset := m.offset
+		m.offset = 0
+		out.WriteString(wrap(m.inline(line), width, "", "", offset))
+		m.rendered = true
+	}
+}
+
+// flushTable renders the table being collected, if any.
+func (m *markdownRenderer) flushTable(out *strings.Builder) {
+	if len(m.table) == 0 {
+		return
+	}
+	rows := m.table
+	m.table = nil
+
+	var cells [][]string
+	header := false
+	for i, row := range rows {
+		fields := splitTableRow(row)
+		if i == 1 && isTableSeparator(fields) {
+			header = true
+			continue
+		}
+		for j, field := range fields {
+			fields[j] = m.inline(field)
+		}
+		cells = append(cells, fields)
+	}
+
+	columns := 0
+	for _, row := range cells {
+		columns = max(columns, len(row))
+	}
+	widths := make([]int, columns)
+	for _, row := range cells {
+		for j, cell := range row {
+			widths[j] = max(widths[j], terminal.DisplayWidth(cell))
+		}
+	}
+	total := 1
+	for _, w := range widths {
+		total += w + 3
+	}
+
+	// A table wider than the terminal would wrap into a mess; show its rows as they are
+	if width := m.width(); width > 0 && total > width {
+		var raw strings.Builder
+		for _, row := range rows {
+			raw.WriteString(m.inline(row) + "\n")
+		}
+		m.emit(out, raw.String())
+		return
+	}
+
+	border := func(left, middle, right string) string {
+		parts := make([]string, columns)
+		for j, w := range widths {
+			parts[j] = strings.Repeat("─", w+2)
+		}
+		return mdMuted + left + strings.Join(parts, middle) + right + mdMutedEnd + "\n"
+	}
+	var table strings.Builder
+	table.WriteString(border("┌", "┬", "┐"))
+	for i, row := range cells {
+		table.WriteString(mdMuted + "│" + mdMutedEnd)
+		for j := 0; j < columns; j++ {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			if header && i == 0 {
+				cell = mdBold + cell + mdBoldEnd
+			}
+			padding := strings.Repeat(" ", widths[j]-terminal.DisplayWidth(cell))
+			table.WriteString(" " + cell + padding + " " + mdMuted + "│" + mdMutedEnd)
+		}
+		table.WriteString("\n")
+		if header && i == 0 {
+			table.WriteString(border("├", "┼", "┤"))
+		}
+	}
+	table.WriteString(border("└", "┴", "┘"))
+	m.emit(out, table.String())
+}
+
+// splitTableRow splits a table row such as "| a | b |" into its trimmed cells.
+func splitTableRow(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(row), "|"), "|")
+	fields := strings.Split(row, "|")
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+	}
+	return fields
+}
+
+// isTableSeparator reports whether the cells are the separator row below a table header.
+func isTableSeparator(fields []string) bool {
+	for _, field := range fields {
+		if !tableSeparator.MatchString(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// inline renders the inline Markdown of a line: code spans, links, file:line references,
+// bold and italic. Code spans, links and references are replaced by placeholders while the
+// emphasis is rendered, so that their contents are not mistaken for emphasis markers.
+func (m *markdownRenderer) inline(text string) string {
+	var rendered []string
+	protect := func(s string) string {
+		rendered = append(rendered, s)
+		return fmt.Sprintf("\x00%d\x00", len(rendered)-1)
+	}
+
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(span string) string {
+		code := span[1 : len(span)-1]
+		return protect(mdCode + m.linkFileRefs(code) + mdColorEnd)
+	})
+	text = linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := linkPattern.FindStringSubmatch(link)
+		return protect(hyperlink(match[2], mdUnder+match[1]+mdUnderEnd))
+	})
+	text = fileRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		return protect(m.linkFileRefs(ref))
+	})
+
+	text = boldPattern.ReplaceAllString(text, mdBold+"$1$2"+mdBoldEnd)
+	text = italicPattern.ReplaceAllStringFunc(text, func(s string) string {
+		match := italicPattern.FindStringSubmatch(s)
+		if match[2] != "" {
+			return match[1] + mdItalic + match[2] + mdItalicEnd
+		}
+		// The underscore form consumed the character after the closing underscore
+		after := s[len(match[3])+len(match[4])+2:]
+		return match[3] + mdItalic + match[4] + mdItalicEnd + after
+	})
+
+	return placeholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		i, _ := strconv.Atoi(placeholder[1 : len(placeholder)-1])
+		return rendered[i]
+	})
+}
+
+// linkFileRefs turns the file:line references in text that point to existing files into hyperlinks.
+func (m *markdownRenderer) linkFileRefs(text string) string {
+	return fileRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		match := fileRefPattern.FindStringSubmatch(ref)
+		path := strings.TrimSuffix(ref, ":"+match[1])
+		if match[2] != "" {
+			path = strings.TrimSuffix(ref, ":"+match[1]+":"+match[2])
+		}
+		abs, ok := m.resolve(path)
+		if !ok {
+			return ref
+		}
+		column := match[2]
+		if column == "" {
+			column = "1"
+		}
+		url := strings.NewReplacer("{path}", filepath.ToSlash(abs), "{line}", match[1], "{column}", column).Replace(m.linkFormat)
+		return hyperlink(url, mdUnder+ref+mdUnderEnd)
+	})
+}
+
+// resolve returns the absolute path of a referenced file if it exists under one of the link roots.
+func (m *markdownRenderer) resolve(path string) (string, bool) {
+	for _, root := range m.linkRoots {
+		candidate := path
+		if !filepath.IsAbs(candidate) {
+			candidate = filepath.Join(root, path)
+		}
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			abs, err := filepath.Abs(candidate)
+			return abs, err == nil
+		}
+	}
+	return "", false
+}
+
+// hyperlink returns text as a terminal hyperlink (OSC 8) to url. Terminals without
+// hyperlink support show the text alone.
+func hyperlink(url, text string) string {
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// wrap breaks text into lines of at most width columns at spaces, starting the first line with
+// first and the others with rest. The first line already has offset columns taken.
+// A width of 0 or less disables wrapping. Words longer than a line are not broken.
+func wrap(text string, width int, first, rest string, offset int) string {
+	var out strings.Builder
+	prefix := first
+	used := offset + terminal.DisplayWidth(prefix)
+	out.WriteString(prefix)
+	lineEmpty := true
+	for _, word := range strings.Split(text, " ") {
+		wordWidth := terminal.DisplayWidth(word)
+		if width > 0 && !lineEmpty && used+1+wordWidth > width {
+			out.WriteString("\n" + rest)
+			used = terminal.DisplayWidth(rest)
+			lineEmpty = true
+		}
+		if !lineEmpty {
+			out.WriteString(" ")
+			used++
+		}
+		out.WriteString(word)
+		used += wordWidth
+		lineEmpty = false
+	}
+	out.WriteString("\n")
+	return out.String()
+}
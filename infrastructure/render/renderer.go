@@ -0,0 +1,47 @@
+package render
+
+import (
+	"fmt"
+	"os"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/terminal"
+)
+
+// Names of the output formats accepted by New.
+const (
+	FormatAuto   = "auto"   // Pretty for a terminal, plain otherwise or when NO_COLOR is set
+	FormatPretty = "pretty" // Colored text, with the model's replies rendered as Markdown
+	FormatPlain  = "plain"  // Text without escape codes, replies as they are
+	FormatJSONL  = "jsonl"  // One JSON object per event
+)
+
+// New creates the event sink rendering agent events to out in the given format.
+// In the pretty format, file:line references in replies are linked if the file exists
+// relative to one of linkRoots.
+func New(format string, out *os.File, linkRoots ...string) (domain.EventSink, error) {
+	pretty := func() domain.EventSink {
+		return NewMarkdownRenderer(out, func() int { return terminal.Width(out) }, linkRoots)
+	}
+	switch format {
+	case "", FormatAuto:
+		if ColorEnabled(out) {
+			return pretty(), nil
+		}
+		return NewPlainRenderer(out), nil
+	case FormatPretty:
+		return pretty(), nil
+	case FormatPlain:
+		return NewPlainRenderer(out), nil
+	case FormatJSONL:
+		return NewJSONLinesRenderer(out), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (expected '%s', '%s', '%s' or '%s')", format, FormatAuto, FormatPretty, FormatPlain, FormatJSONL)
+	}
+}
+
+// ColorEnabled reports whether colored output should be written to out: it must be
+// a terminal, and the NO_COLOR environment variable (https://no-color.org) must be unset or empty.
+func ColorEnabled(out *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && terminal.IsTerminal(out)
+}
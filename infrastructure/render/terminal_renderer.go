@@ -0,0 +1,166 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"code-ai-editor/domain"
+)
+
+// ANSI escape codes used by the pretty renderer.
+const (
+	styleReset   = "\x1b[0m"
+	styleDim     = "\x1b[2m"
+	styleRed     = "\x1b[31m"
+	styleGreen   = "\x1b[32m"
+	styleYellow  = "\x1b[33m"
+	styleBlue    = "\x1b[34m"
+	styleCyan    = "\x1b[36m"
+	styleBrGreen = "\x1b[92m"
+)
+
+// maxToolErrorLength limits how much of a failed tool call's output is shown.
+const maxToolErrorLength = 200
+
+// replyPrefix is written before every text block of the model's reply.
+const replyPrefix = "Claude: "
+
+// TerminalRenderer renders agent events as human-readable text for a console.
+// The pretty variant colors the text with ANSI escape codes; the plain variant writes
+// the same text without them, for NO_COLOR users and output redirected to a file or pipe.
+// With Markdown rendering enabled, the model's replies are rendered as formatted Markdown
+// instead of being written as they are.
+type TerminalRenderer struct {
+	mu       sync.Mutex
+	out      io.Writer
+	color    bool
+	markdown *markdownRenderer // nil writes replies as they are
+	open     domain.EventType  // Type of the delta block currently being written, if any
+}
+
+// NewMarkdownRenderer creates a TerminalRenderer that writes colored text to out and renders
+// the model's replies as Markdown, wrapped to the width reported by width (0 disables wrapping).
+// file:line references become hyperlinks if the file exists relative to one of linkRoots.
+func NewMarkdownRenderer(out io.Writer, width func() int, linkRoots []string) *TerminalRenderer {
+	return &TerminalRenderer{out: out, color: true, markdown: newMarkdownRenderer(width, linkRoots)}
+}
+
+// NewPlainRenderer creates a TerminalRenderer that writes text without escape codes to out.
+func NewPlainRenderer(out io.Writer) *TerminalRenderer {
+	return &TerminalRenderer{out: out}
+}
+
+// Emit writes the event. Text and thinking deltas are written as they arrive, after a
+// "Claude: " or "Thinking: " prefix at the start of each block.
+func (r *TerminalRenderer) Emit(event domain.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch event.Type {
+	case domain.EventTextDelta, domain.EventThinkingDelta:
+		if r.open != event.Type {
+			r.closeBlock()
+			r.open = event.Type
+			switch {
+			case event.Type == domain.EventTextDelta && r.markdown != nil:
+				r.write(r.styled(styleCyan, replyPrefix))
+				r.markdown.Start(len(replyPrefix))
+			case event.Type == domain.EventTextDelta:
+				r.write(r.start(styleCyan) + replyPrefix)
+			default:
+				r.write(r.start(styleDim) + "Thinking: ")
+			}
+		}
+		if event.Type == domain.EventTextDelta && r.markdown != nil {
+			r.write(r.markdown.Write(event.Text))
+		} else {
+			r.write(event.Text)
+		}
+		return
+	case domain.EventBlockFinished:
+		r.closeBlock()
+		return
+	}
+
+	r.closeBlock()
+	switch event.Type {
+	case domain.EventInferenceStarted:
+		r.line(styleBlue, "Thinking...")
+	case domain.EventToolCallStarted:
+		r.write(fmt.Sprintf("%s: %s(%s)\n", r.styled(styleBrGreen, "tool"), event.ToolName, event.Input))
+	case domain.EventToolCallFinished:
+		if event.IsError {
+			r.line(styleRed, fmt.Sprintf("tool %s failed: %s", event.ToolName, summarize(event.Output)))
+		}
+	case domain.EventContextInjected:
+		r.line(styleGreen, "Injecting Context:\n"+strings.TrimRight(event.Text, "\n"))
+	case domain.EventNotice:
+		r.line(noticeStyle(event.Level), event.Text)
+	case domain.EventOutput:
+		r.write(strings.TrimRight(event.Text, "\n") + "\n")
+	case domain.EventError:
+		r.line(styleRed, "Error: "+event.Text)
+	}
+}
+
+// closeBlock ends the delta block being written, if any.
+func (r *TerminalRenderer) closeBlock() {
+	switch {
+	case r.open == "":
+		return
+	case r.open == domain.EventTextDelta && r.markdown != nil:
+		r.write(r.markdown.Flush())
+	default:
+		r.write(r.start(styleReset) + "\n")
+	}
+	r.open = ""
+}
+
+// line writes text in the given style, followed by a line break.
+func (r *TerminalRenderer) line(style, text string) {
+	r.write(r.styled(style, text) + "\n")
+}
+
+// styled wraps text in the given style if colors are enabled.
+func (r *TerminalRenderer) styled(style, text string) string {
+	if !r.color {
+		return text
+	}
+	return style + text + styleReset
+}
+
+// start returns the escape code switching to the given style, if colors are enabled.
+func (r *TerminalRenderer) start(style string) string {
+	if !r.color {
+		return ""
+	}
+	return style
+}
+
+// write writes text to the output. Write errors are ignored: there is nowhere left to report them.
+func (r *TerminalRenderer) write(text string) {
+	io.WriteString(r.out, text)
+}
+
+// noticeStyle returns the style of a notice level.
+func noticeStyle(level domain.NoticeLevel) string {
+	switch level {
+	case domain.NoticeWarning:
+		return styleYellow
+	case domain.NoticeMuted:
+		return styleDim
+	default:
+		return styleGreen
+	}
+}
+
+// summarize returns the first line of a tool output, shortened to maxToolErrorLength.
+func summarize(output string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if len(first) > maxToolErrorLength {
+		first = first[:maxToolErrorLength] + "..."
+	}
+	return first
+}
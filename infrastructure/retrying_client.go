@@ -0,0 +1,378 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"code-ai-editor/domain"
+)
+
+// RetryPolicy configures how failed inference calls are retried.
+type RetryPolicy struct {
+	MaxAttempts   int           // Total attempts including the first one; 1 disables retries
+	BaseDelay     time.Duration // Delay before the first retry, doubled for every further retry
+	MaxDelay      time.Duration // Upper bound for the computed backoff delay
+	MaxRetryAfter time.Duration // Upper bound for delays requested by the server via retry-after
+}
+
+// DefaultRetryPolicy returns the retry policy used unless configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   5,
+		BaseDelay:     time.Second,
+		MaxDelay:      30 * time.Second,
+		MaxRetryAfter: 2 * time.Minute,
+	}
+}
+
+// RetryingAIClient wraps a domain.AIClient and retries calls that failed with a
+// transient error (rate limits, overload, server errors and network failures)
+// using exponential backoff with jitter.
+//
+// Streaming calls are retried while opening the stream and when the stream fails before
+// the first content delta, e.g. with an overloaded error event; the events received up to
+// then are withheld, so the caller sees only the stream that succeeded. Once content has
+// been delivered, a failure is returned to the caller as is.
+type RetryingAIClient struct {
+	client domain.AIClient
+	policy RetryPolicy
+	events domain.EventSink // Receives a notice before every retry; nil logs it instead
+}
+
+// NewRetryingAIClient creates a RetryingAIClient that retries calls to client according to policy.
+func NewRetryingAIClient(client domain.AIClient, policy RetryPolicy) *RetryingAIClient {
+	return &RetryingAIClient{
+		client: client,
+		policy: policy,
+	}
+}
+
+// SetEventSink sets the sink that is notified before every retry.
+func (c *RetryingAIClient) SetEventSink(events domain.EventSink) {
+	c.events = events
+}
+
+// RunInference calls the wrapped client's RunInference, retrying transient failures.
+func (c *RetryingAIClient) RunInference(ctx context.Context, request domain.InferenceRequest) (*domain.Message, error) {
+	var message *domain.Message
+	err := c.retry(ctx, func() error {
+		var err error
+		message, err = c.client.RunInference(ctx, request)
+		return err
+	})
+	return message, err
+}
+
+// StreamInference calls the wrapped client's StreamInference, retrying transient failures to open
+// the stream and transient failures of the stream before its first content delta.
+func (c *RetryingAIClient) StreamInference(ctx context.Context, request domain.InferenceRequest) (domain.InferenceStream, error) {
+	stream := &retryingStream{client: c, ctx: ctx, request: request}
+	if err := stream.open(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// retry runs call until it succeeds, fails with a non-retryable error, or the attempts are exhausted.
+func (c *RetryingAIClient) retry(ctx context.Context, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil {
+			return nil
+		}
+		if err := c.beforeRetry(ctx, attempt, err); err != nil {
+			return err
+		}
+	}
+}
+
+// beforeRetry decides whether to retry after the given attempt failed with err. If so, it reports
+// the retry and waits for the backoff delay; otherwise it returns the error to give up with.
+func (c *RetryingAIClient) beforeRetry(ctx context.Context, attempt int, err error) error {
+	maxAttempts := c.policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	retryable, retryAfter := classifyInferenceError(err)
+	if !retryable || ctx.Err() != nil {
+		return err
+	}
+	if attempt >= maxAttempts {
+		return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+	}
+
+	delay := c.backoff(attempt, retryAfter)
+	c.notifyRetry(fmt.Sprintf("%s, retrying in %ds (attempt %d/%d)...", describeInferenceError(err), int(delay.Round(time.Second).Seconds()), attempt+1, maxAttempts))
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryingStream is a domain.InferenceStream that opens the stream again when it fails before
+// delivering content. Events preceding the first content delta, such as the message start, are
+// withheld until it arrives, so that a retried stream is delivered from its own start.
+type retryingStream struct {
+	client   *RetryingAIClient
+	ctx      context.Context
+	request  domain.InferenceRequest
+	attempts int
+
+	stream    domain.InferenceStream
+	withheld  []domain.StreamEvent // Events received before the first content delta
+	ready     []domain.StreamEvent // Withheld events to deliver before reading further
+	delivered bool                 // Whether content was delivered, after which failures are not retried
+	current   domain.StreamEvent
+	err       error
+}
+
+// open opens the wrapped stream, retrying transient failures.
+func (s *retryingStream) open() error {
+	for {
+		s.attempts++
+		stream, err := s.client.client.StreamInference(s.ctx, s.request)
+		if err == nil {
+			s.stream = stream
+			return nil
+		}
+		if err := s.client.beforeRetry(s.ctx, s.attempts, err); err != nil {
+			return err
+		}
+	}
+}
+
+// Next advances to the next event, opening the stream again after a transient failure that
+// happened before any content was delivered.
+func (s *retryingStream) Next() bool {
+	for {
+		if len(s.ready) > 0 {
+			s.current, s.ready = s.ready[0], s.ready[1:]
+			return true
+		}
+		if s.err != nil {
+			return false
+		}
+
+		if s.stream.Next() {
+			event := s.stream.Current()
+			if s.delivered {
+				s.current = event
+				return true
+			}
+			s.withheld = append(s.withheld, event)
+			if isContentEvent(event) {
+				s.delivered = true
+				s.ready, s.withheld = s.withheld, nil
+			}
+			continue
+		}
+
+		err := s.stream.Err()
+		if err == nil || s.delivered {
+			// Deliver what was withheld from a stream that ended without content
+			s.delivered = true
+			s.ready, s.withheld = s.withheld, nil
+			if len(s.ready) > 0 {
+				continue
+			}
+			s.err = err
+			return false
+		}
+
+		s.stream.Close()
+		s.withheld = nil
+		if err := s.client.beforeRetry(s.ctx, s.attempts, err); err != nil {
+			s.err = err
+			return false
+		}
+		if err := s.open(); err != nil {
+			s.err = err
+			return false
+		}
+	}
+}
+
+// isContentEvent reports whether an event carries content or ends the message, after which
+// the stream is no longer retried.
+func isContentEvent(event domain.StreamEvent) bool {
+	switch event.Type {
+	case domain.StreamEventTextDelta, domain.StreamEventInputJSONDelta, domain.StreamEventThinkingDelta,
+		domain.StreamEventSignatureDelta, domain.StreamEventMessageDelta:
+		return true
+	}
+	return false
+}
+
+// Current returns the event the stream is positioned on.
+func (s *retryingStream) Current() domain.StreamEvent {
+	return s.current
+}
+
+// Err returns the error that terminated the stream, if any.
+func (s *retryingStream) Err() error {
+	return s.err
+}
+
+// Close closes the wrapped stream.
+func (s *retryingStream) Close() error {
+	return s.stream.Close()
+}
+
+// notifyRetry reports an upcoming retry to the event sink, or logs it if there is none.
+func (c *RetryingAIClient) notifyRetry(text string) {
+	if c.events == nil {
+		log.Println(text)
+		return
+	}
+	c.events.Emit(domain.Event{Type: domain.EventNotice, Time: time.Now(), Level: domain.NoticeWarning, Text: text})
+}
+
+// backoff returns the delay before the given retry. A server-provided retry-after
+// takes precedence; otherwise the delay grows exponentially with equal jitter.
+func (c *RetryingAIClient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if c.policy.MaxRetryAfter > 0 && retryAfter > c.policy.MaxRetryAfter {
+			return c.policy.MaxRetryAfter
+		}
+		return retryAfter
+	}
+
+	delay := c.policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || (c.policy.MaxDelay > 0 && delay > c.policy.MaxDelay) {
+		delay = c.policy.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// classifyInferenceError reports whether err is transient, and the delay the server asked
+// for via retry-after headers, if any.
+func classifyInferenceError(err error) (retryable bool, retryAfter time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var streamErr *anthropicStreamError
+	if errors.As(err, &streamErr) {
+		switch streamErr.Type {
+		case "overloaded_error", "api_error", "rate_limit_error":
+			return true, 0
+		}
+		return false, 0
+	}
+
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		if anthropicErr.Response != nil {
+			retryAfter = parseRetryAfter(anthropicErr.Response.Header)
+		}
+		return isRetryableStatus(anthropicErr.StatusCode), retryAfter
+	}
+
+	var openaiAPIErr *openai.APIError
+	if errors.As(err, &openaiAPIErr) {
+		return isRetryableStatus(openaiAPIErr.HTTPStatusCode), 0
+	}
+	var openaiRequestErr *openai.RequestError
+	if errors.As(err, &openaiRequestErr) {
+		return isRetryableStatus(openaiRequestErr.HTTPStatusCode), 0
+	}
+
+	// Connection resets, timeouts and similar network failures
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// isRetryableStatus reports whether an HTTP status code indicates a transient failure.
+// 529 is Anthropic's "overloaded" status.
+func isRetryableStatus(status int) bool {
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusConflict, status == http.StatusTooManyRequests:
+		return true
+	case status >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter reads the delay requested by the server from the retry-after-ms or
+// retry-after headers. retry-after may hold seconds or an HTTP date.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("retry-after")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// describeInferenceError returns a short description of a transient error for the retry message.
+func describeInferenceError(err error) string {
+	var streamErr *anthropicStreamError
+	if errors.As(err, &streamErr) {
+		switch streamErr.Type {
+		case "overloaded_error":
+			return "API overloaded"
+		case "rate_limit_error":
+			return "Rate limited"
+		default:
+			return "Server error"
+		}
+	}
+
+	status := 0
+	var anthropicErr *anthropic.Error
+	var openaiAPIErr *openai.APIError
+	var openaiRequestErr *openai.RequestError
+	switch {
+	case errors.As(err, &anthropicErr):
+		status = anthropicErr.StatusCode
+	case errors.As(err, &openaiAPIErr):
+		status = openaiAPIErr.HTTPStatusCode
+	case errors.As(err, &openaiRequestErr):
+		status = openaiRequestErr.HTTPStatusCode
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "Rate limited (429)"
+	case status == 529:
+		return "API overloaded (529)"
+	case status >= 500:
+		return fmt.Sprintf("Server error (%d)", status)
+	case status != 0:
+		return fmt.Sprintf("Request failed (%d)", status)
+	default:
+		return "Network error"
+	}
+}
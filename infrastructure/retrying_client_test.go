@@ -0,0 +1,124 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"code-ai-editor/domain"
+)
+
+// fakeStream delivers the given events and then fails with err, if set.
+type fakeStream struct {
+	events  []domain.StreamEvent
+	err     error
+	current domain.StreamEvent
+}
+
+func (s *fakeStream) Next() bool {
+	if len(s.events) == 0 {
+		return false
+	}
+	s.current, s.events = s.events[0], s.events[1:]
+	return true
+}
+
+func (s *fakeStream) Current() domain.StreamEvent { return s.current }
+func (s *fakeStream) Err() error                  { return s.err }
+func (s *fakeStream) Close() error                { return nil }
+
+// streamingAIClient opens the given streams in order.
+type streamingAIClient struct {
+	streams []*fakeStream
+	opened  int
+}
+
+func (c *streamingAIClient) RunInference(ctx context.Context, request domain.InferenceRequest) (*domain.Message, error) {
+	return nil, errors.New("not streaming")
+}
+
+func (c *streamingAIClient) StreamInference(ctx context.Context, request domain.InferenceRequest) (domain.InferenceStream, error) {
+	stream := c.streams[c.opened]
+	c.opened++
+	return stream, nil
+}
+
+func collect(stream domain.InferenceStream) []domain.StreamEvent {
+	var events []domain.StreamEvent
+	for stream.Next() {
+		events = append(events, stream.Current())
+	}
+	return events
+}
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func TestRetryingStreamRetriesErrorBeforeContent(t *testing.T) {
+	overloaded := &anthropicStreamError{Type: "overloaded_error", Message: "Overloaded"}
+	complete := []domain.StreamEvent{
+		{Type: domain.StreamEventMessageStart, Model: "claude-test"},
+		{Type: domain.StreamEventContentBlockStart, Index: 0, BlockType: "text"},
+		{Type: domain.StreamEventTextDelta, Index: 0, Text: "Hello"},
+		{Type: domain.StreamEventContentBlockStop, Index: 0},
+		{Type: domain.StreamEventMessageDelta, StopReason: domain.StopReasonEndTurn},
+	}
+	client := &streamingAIClient{streams: []*fakeStream{
+		{events: complete[:2], err: overloaded},
+		{events: append([]domain.StreamEvent{}, complete...)},
+	}}
+
+	stream, err := NewRetryingAIClient(client, testRetryPolicy).StreamInference(context.Background(), domain.InferenceRequest{})
+	if err != nil {
+		t.Fatalf("StreamInference: %v", err)
+	}
+	events := collect(stream)
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if !reflect.DeepEqual(events, complete) {
+		t.Errorf("events = %+v, want only those of the retried stream %+v", events, complete)
+	}
+	if client.opened != 2 {
+		t.Errorf("opened %d streams, want 2", client.opened)
+	}
+}
+
+func TestRetryingStreamDoesNotRetryAfterContent(t *testing.T) {
+	overloaded := &anthropicStreamError{Type: "overloaded_error", Message: "Overloaded"}
+	client := &streamingAIClient{streams: []*fakeStream{{
+		events: []domain.StreamEvent{
+			{Type: domain.StreamEventMessageStart},
+			{Type: domain.StreamEventTextDelta, Text: "Hel"},
+		},
+		err: overloaded,
+	}}}
+
+	stream, err := NewRetryingAIClient(client, testRetryPolicy).StreamInference(context.Background(), domain.InferenceRequest{})
+	if err != nil {
+		t.Fatalf("StreamInference: %v", err)
+	}
+	if events := collect(stream); len(events) != 2 {
+		t.Errorf("events = %+v, want the message start and the delivered text", events)
+	}
+	if !errors.Is(stream.Err(), overloaded) || client.opened != 1 {
+		t.Errorf("err = %v after opening %d streams, want the overloaded error without a retry", stream.Err(), client.opened)
+	}
+}
+
+func TestParseStreamError(t *testing.T) {
+	err := parseStreamError(errors.New(`received error while streaming: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	var streamErr *anthropicStreamError
+	if !errors.As(err, &streamErr) || streamErr.Type != "overloaded_error" {
+		t.Fatalf("parseStreamError = %v, want an overloaded_error", err)
+	}
+	if retryable, _ := classifyInferenceError(err); !retryable {
+		t.Error("an overloaded_error event is not retried")
+	}
+
+	invalid := parseStreamError(errors.New(`received error while streaming: {"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+	if retryable, _ := classifyInferenceError(invalid); retryable {
+		t.Error("an invalid_request_error event is retried")
+	}
+}
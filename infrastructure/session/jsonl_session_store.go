@@ -0,0 +1,233 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
+
+	"github.com/google/uuid"
+)
+
+// maxTitleLength limits the length of session titles shown in listings.
+const maxTitleLength = 60
+
+// JSONLSessionStore stores chat sessions as append-only JSONL transcripts,
+// one file per session named after the session ID.
+type JSONLSessionStore struct {
+	dir string
+}
+
+// NewJSONLSessionStore creates a new JSONLSessionStore rooted at the configured directory.
+// The directory is created if it does not exist.
+func NewJSONLSessionStore(settings config.SessionsConfig) (*JSONLSessionStore, error) {
+	dir := settings.Dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory '%s': %w", dir, err)
+	}
+
+	return &JSONLSessionStore{dir: dir}, nil
+}
+
+// Create starts a new, empty session.
+func (s *JSONLSessionStore) Create() (*JSONLSession, error) {
+	id := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), uuid.New().String()[:8])
+	return s.open(id)
+}
+
+// Resume opens an existing session for appending and returns it together with
+// the conversation history recorded so far.
+func (s *JSONLSessionStore) Resume(id string) (*JSONLSession, []domain.Message, error) {
+	entries, err := s.readEntries(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, domain.ConversationFromEntries(entries), nil
+}
+
+// LatestID returns the ID of the most recently updated session.
+func (s *JSONLSessionStore) LatestID() (string, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	if len(sessions) == 0 {
+		return "", fmt.Errorf("no sessions found in '%s'", s.dir)
+	}
+	return sessions[0].ID, nil
+}
+
+// List returns a summary of all stored sessions, most recently updated first.
+func (s *JSONLSessionStore) List() ([]domain.SessionInfo, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session files: %w", err)
+	}
+
+	sessions := make([]domain.SessionInfo, 0, len(files))
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		entries, err := s.readEntries(id)
+		if err != nil {
+			return nil, err
+		}
+
+		info := domain.SessionInfo{ID: id}
+		for _, entry := range entries {
+			if info.CreatedAt.IsZero() {
+				info.CreatedAt = entry.Time
+			}
+			info.UpdatedAt = entry.Time
+			if entry.Type == domain.SessionEntryUser {
+				info.Turns++
+				if info.Title == "" {
+					info.Title = sessionTitle(entry.Text)
+				}
+			}
+		}
+		if info.UpdatedAt.IsZero() {
+			// Empty session: fall back to the file modification time
+			if stat, err := os.Stat(file); err == nil {
+				info.CreatedAt = stat.ModTime()
+				info.UpdatedAt = stat.ModTime()
+			}
+		}
+		sessions = append(sessions, info)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// path returns the transcript path of the session with the given ID.
+func (s *JSONLSessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+// open opens the transcript of the session with the given ID for appending, creating it if needed.
+// If the transcript ends with a line truncated by a crash, new entries start on a line of their own.
+func (s *JSONLSessionStore) open(id string) (*JSONLSession, error) {
+	file, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session '%s': %w", id, err)
+	}
+	if err := terminateLastLine(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open session '%s': %w", id, err)
+	}
+	return &JSONLSession{id: id, file: file}, nil
+}
+
+// terminateLastLine appends a line break to file unless it is empty or already ends with one.
+func terminateLastLine(file *os.File) error {
+	stat, err := file.Stat()
+	if err != nil || stat.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, stat.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
+
+// readEntries reads all entries of the session with the given ID. Lines that cannot be
+// parsed, such as one truncated by a crash during a write, are skipped with a warning.
+func (s *JSONLSessionStore) readEntries(id string) ([]domain.SessionEntry, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session id '%s'", id)
+	}
+
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session '%s' not found", id)
+		}
+		return nil, fmt.Errorf("failed to open session '%s': %w", id, err)
+	}
+	defer file.Close()
+
+	var entries []domain.SessionEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var entry domain.SessionEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				log.Printf("Warning: skipping an unreadable entry of session '%s': %v\n", id, err)
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// sessionTitle derives a single-line title from the first user input of a session.
+func sessionTitle(input string) string {
+	title := strings.Join(strings.Fields(input), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-3]) + "..."
+	}
+	return title
+}
+
+// JSONLSession is an open session transcript. It implements domain.SessionRecorder.
+type JSONLSession struct {
+	id   string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// ID returns the session ID, which can be passed to chat -resume.
+func (s *JSONLSession) ID() string {
+	return s.id
+}
+
+// Record appends an entry to the transcript and flushes it to disk,
+// so the session survives a crash or Ctrl+C.
+func (s *JSONLSession) Record(entry domain.SessionEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write session entry: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Close closes the transcript file.
+func (s *JSONLSession) Close() error {
+	return s.file.Close()
+}
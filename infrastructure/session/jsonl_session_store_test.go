@@ -0,0 +1,81 @@
+package session
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
+)
+
+func record(t *testing.T, session *JSONLSession, entries ...domain.SessionEntry) {
+	t.Helper()
+	for _, entry := range entries {
+		if err := session.Record(entry); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func turn(user, assistant string) []domain.SessionEntry {
+	userMessage := domain.NewUserMessage(domain.NewTextBlock(user))
+	assistantMessage := domain.NewAssistantMessage(domain.NewTextBlock(assistant))
+	return []domain.SessionEntry{
+		{Type: domain.SessionEntryUser, Message: &userMessage, Text: user},
+		{Type: domain.SessionEntryAssistant, Message: &assistantMessage},
+	}
+}
+
+func TestResumeAfterTruncatedLine(t *testing.T) {
+	store, err := NewJSONLSessionStore(config.SessionsConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJSONLSessionStore: %v", err)
+	}
+	session, err := store.Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	record(t, session, turn("First", "One")...)
+	session.Close()
+
+	// A crash in the middle of a write leaves a line without its end
+	file, err := os.OpenFile(store.path(session.ID()), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"type":"user","message":{"role":"us`)
+	file.Close()
+
+	resumed, history, err := store.Resume(session.ID())
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("history after the crash = %+v, want the first turn", history)
+	}
+	record(t, resumed, turn("Second", "Two")...)
+	resumed.Close()
+
+	_, history, err = store.Resume(session.ID())
+	if err != nil {
+		t.Fatalf("Resume after appending: %v", err)
+	}
+	want := []domain.Message{
+		domain.NewUserMessage(domain.NewTextBlock("First")),
+		domain.NewAssistantMessage(domain.NewTextBlock("One")),
+		domain.NewUserMessage(domain.NewTextBlock("Second")),
+		domain.NewAssistantMessage(domain.NewTextBlock("Two")),
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("history = %+v, want %+v", history, want)
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Turns != 2 || sessions[0].Title != "First" {
+		t.Errorf("List = %+v, want one session with 2 turns titled First", sessions)
+	}
+}
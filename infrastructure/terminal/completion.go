@@ -0,0 +1,78 @@
+package terminal
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"code-ai-editor/domain"
+)
+
+// Completer returns the candidates that can replace the word before the cursor.
+type Completer func(word string) []string
+
+// Roots are the directories paths are completed in, such as the agent's workspace, with paths
+// addressed as the file tools address them: relative to the default root, or "name:path".
+type Roots interface {
+	Resolve(path string) (string, error) // Absolute path of a path, which must stay inside its root
+	RootNames() []string                 // Names of the named roots
+}
+
+// PathCompleter completes file and directory paths inside roots, and the "name:" prefixes of
+// the named roots. Directories are completed with a trailing slash; hidden entries are only
+// offered when the word being completed starts with a dot. Paths leaving their root, e.g.
+// through "../", have no candidates.
+func PathCompleter(roots Roots) Completer {
+	return func(word string) []string {
+		root, path := domain.SplitRootPath(word)
+		dir, prefix := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			dir, prefix = path[:i+1], path[i+1:]
+		}
+
+		var candidates []string
+		if root == "" && dir == "" {
+			for _, name := range roots.RootNames() {
+				if strings.HasPrefix(name, prefix) {
+					candidates = append(candidates, name+":")
+				}
+			}
+		}
+		absDir, err := roots.Resolve(domain.JoinRootPath(root, dir))
+		if err != nil {
+			return candidates
+		}
+		entries, err := os.ReadDir(absDir)
+		if err != nil {
+			return candidates
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+				continue
+			}
+			if entry.IsDir() {
+				name += "/"
+			}
+			candidates = append(candidates, domain.JoinRootPath(root, dir+name))
+		}
+		sort.Strings(candidates)
+		return candidates
+	}
+}
+
+// commonPrefix returns the longest common prefix of the candidates.
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
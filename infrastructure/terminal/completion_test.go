@@ -0,0 +1,53 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure"
+)
+
+func TestPathCompleter(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"service/main.go", "service/.env", "shared/util/strings.go", "secret.txt"} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workspace, err := infrastructure.NewWorkspace([]domain.WorkspaceRoot{
+		{Dir: filepath.Join(dir, "service")},
+		{Name: "shared", Dir: filepath.Join(dir, "shared")},
+	})
+	if err != nil {
+		t.Fatalf("NewWorkspace: %v", err)
+	}
+	complete := PathCompleter(workspace)
+
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"m", []string{"main.go"}},
+		{"", []string{"main.go", "shared:"}},
+		{".", []string{".env"}},
+		{"sh", []string{"shared:"}},
+		{"shared:", []string{"shared:util/"}},
+		{"shared:util/s", []string{"shared:util/strings.go"}},
+		{"../", nil},
+		{"../s", nil},
+		{"shared:../", nil},
+		{"unknown:", nil},
+	}
+	for _, tt := range tests {
+		if got := complete(tt.word); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
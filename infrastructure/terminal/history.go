@@ -0,0 +1,114 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// DefaultHistorySize is the number of entries kept in the input history.
+const DefaultHistorySize = 1000
+
+// DefaultHistoryFile returns the path of the persistent input history: $CHAT_HISTORY_FILE if set,
+// otherwise ~/.code_ai_editor_history. It returns "" if the home directory is unknown.
+func DefaultHistoryFile() string {
+	if path := os.Getenv("CHAT_HISTORY_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".code_ai_editor_history")
+}
+
+// History is the input history, persisted across sessions.
+// Each entry is stored as a JSON string on its own line, so multi-line entries survive.
+type History struct {
+	path    string
+	max     int
+	entries []string
+}
+
+// LoadHistory loads the history from path, keeping at most max entries.
+// A missing or unreadable file starts an empty history; an empty path keeps the history in memory only.
+func LoadHistory(path string, max int) *History {
+	h := &History{path: path, max: max}
+	if path == "" {
+		return h
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry string
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	if len(h.entries) > max {
+		h.entries = h.entries[len(h.entries)-max:]
+	}
+	return h
+}
+
+// Entries returns the history entries, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends an entry to the history and its file, skipping an immediate repeat of the last entry.
+// Failing to persist the history is logged but does not interrupt the chat.
+func (h *History) Add(entry string) {
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if h.path == "" {
+		return
+	}
+
+	if len(h.entries) > h.max {
+		// Rewrite the file without the oldest entries
+		h.entries = h.entries[len(h.entries)-h.max:]
+		if err := h.save(); err != nil {
+			log.Printf("Warning: Failed to save input history: %v\n", err)
+		}
+		return
+	}
+
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Warning: Failed to save input history: %v\n", err)
+		return
+	}
+	defer file.Close()
+	line, _ := json.Marshal(entry)
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Warning: Failed to save input history: %v\n", err)
+	}
+}
+
+// save rewrites the history file with the current entries.
+func (h *History) save() error {
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range h.entries {
+		line, _ := json.Marshal(entry)
+		writer.Write(append(line, '\n'))
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,226 @@
+package terminal
+
+import (
+	"bufio"
+	"strings"
+)
+
+// keyCode identifies an editing key decoded from terminal input.
+type keyCode int
+
+const (
+	keyIgnore        keyCode = iota // An unsupported key or escape sequence
+	keyRune                         // A printable character
+	keyPaste                        // Text pasted with bracketed paste
+	keyEnter                        // Submit the input
+	keyNewline                      // Insert a line break: Shift+Enter, Alt+Enter or Ctrl+J
+	keyBackspace                    // Delete the character before the cursor
+	keyDelete                       // Delete the character under the cursor
+	keyLeft                         // Move one character left
+	keyRight                        // Move one character right
+	keyWordLeft                     // Move one word left: Ctrl+Left or Alt+B
+	keyWordRight                    // Move one word right: Ctrl+Right or Alt+F
+	keyUp                           // Previous line, or previous history entry
+	keyDown                         // Next line, or next history entry
+	keyHome                         // Move to the start of the line
+	keyEnd                          // Move to the end of the line
+	keyPageUp                       // Scroll up one page, in the full-screen interface
+	keyPageDown                     // Scroll down one page, in the full-screen interface
+	keyTab                          // Complete the path before the cursor
+	keyKillLineStart                // Ctrl+U
+	keyKillLineEnd                  // Ctrl+K
+	keyKillWord                     // Ctrl+W or Alt+Backspace
+	keyClearScreen                  // Ctrl+L
+	keySearch                       // Ctrl+R: reverse history search
+	keyCancel                       // Esc or Ctrl+G
+	keyInterrupt                    // Ctrl+C
+	keyEOF                          // Ctrl+D
+)
+
+// key is a single decoded keypress, or a whole paste.
+type key struct {
+	code keyCode
+	r    rune   // The character for keyRune
+	text string // The pasted text for keyPaste
+}
+
+// Bracketed paste markers sent by the terminal around pasted text.
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// readKey reads and decodes the next keypress.
+func readKey(reader *bufio.Reader) (key, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch r {
+	case 0x1b:
+		return readEscape(reader)
+	case '\r':
+		return key{code: keyEnter}, nil
+	case '\n':
+		return key{code: keyNewline}, nil
+	case 0x7f, 0x08:
+		return key{code: keyBackspace}, nil
+	case '\t':
+		return key{code: keyTab}, nil
+	case 0x01:
+		return key{code: keyHome}, nil
+	case 0x02:
+		return key{code: keyLeft}, nil
+	case 0x03:
+		return key{code: keyInterrupt}, nil
+	case 0x04:
+		return key{code: keyEOF}, nil
+	case 0x05:
+		return key{code: keyEnd}, nil
+	case 0x06:
+		return key{code: keyRight}, nil
+	case 0x07:
+		return key{code: keyCancel}, nil
+	case 0x0b:
+		return key{code: keyKillLineEnd}, nil
+	case 0x0c:
+		return key{code: keyClearScreen}, nil
+	case 0x0e:
+		return key{code: keyDown}, nil
+	case 0x10:
+		return key{code: keyUp}, nil
+	case 0x12:
+		return key{code: keySearch}, nil
+	case 0x15:
+		return key{code: keyKillLineStart}, nil
+	case 0x17:
+		return key{code: keyKillWord}, nil
+	}
+	if r < 0x20 {
+		return key{code: keyIgnore}, nil
+	}
+	return key{code: keyRune, r: r}, nil
+}
+
+// readEscape decodes the rest of an escape sequence. An escape byte with nothing
+// buffered after it is taken as a lone Esc keypress.
+func readEscape(reader *bufio.Reader) (key, error) {
+	if reader.Buffered() == 0 {
+		return key{code: keyCancel}, nil
+	}
+	b, err := reader.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch b {
+	case '[':
+		return readCSI(reader)
+	case 'O':
+		final, err := reader.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		return cursorKey(final, ""), nil
+	case '\r':
+		return key{code: keyNewline}, nil
+	case 'b':
+		return key{code: keyWordLeft}, nil
+	case 'f':
+		return key{code: keyWordRight}, nil
+	case 0x7f:
+		return key{code: keyKillWord}, nil
+	}
+	return key{code: keyIgnore}, nil
+}
+
+// readCSI decodes a control sequence: parameter bytes followed by a final byte.
+func readCSI(reader *bufio.Reader) (key, error) {
+	var params strings.Builder
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		if b >= 0x40 && b <= 0x7e {
+			return csiKey(reader, params.String(), b)
+		}
+		params.WriteByte(b)
+	}
+}
+
+// csiKey maps a control sequence to a key, reading the pasted text for a paste start marker.
+func csiKey(reader *bufio.Reader, params string, final byte) (key, error) {
+	switch final {
+	case '~':
+		switch params {
+		case "200":
+			text, err := readPaste(reader)
+			return key{code: keyPaste, text: text}, err
+		case "3":
+			return key{code: keyDelete}, nil
+		case "1", "7":
+			return key{code: keyHome}, nil
+		case "4", "8":
+			return key{code: keyEnd}, nil
+		case "5":
+			return key{code: keyPageUp}, nil
+		case "6":
+			return key{code: keyPageDown}, nil
+		case "27;2;13": // Shift+Enter with xterm's modifyOtherKeys
+			return key{code: keyNewline}, nil
+		}
+	case 'u':
+		if params == "13;2" { // Shift+Enter with the CSI u keyboard protocol
+			return key{code: keyNewline}, nil
+		}
+	default:
+		return cursorKey(final, params), nil
+	}
+	return key{code: keyIgnore}, nil
+}
+
+// cursorKey maps the final byte of a cursor key sequence to a key. A Ctrl or Alt
+// modifier ("1;5", "1;3") turns Left and Right into word movement.
+func cursorKey(final byte, params string) key {
+	modified := strings.HasSuffix(params, ";5") || strings.HasSuffix(params, ";3")
+	switch final {
+	case 'A':
+		return key{code: keyUp}
+	case 'B':
+		return key{code: keyDown}
+	case 'C':
+		if modified {
+			return key{code: keyWordRight}
+		}
+		return key{code: keyRight}
+	case 'D':
+		if modified {
+			return key{code: keyWordLeft}
+		}
+		return key{code: keyLeft}
+	case 'H':
+		return key{code: keyHome}
+	case 'F':
+		return key{code: keyEnd}
+	}
+	return key{code: keyIgnore}
+}
+
+// readPaste reads pasted text up to the paste end marker, normalizing line endings to "\n".
+func readPaste(reader *bufio.Reader) (string, error) {
+	var text strings.Builder
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return text.String(), err
+		}
+		text.WriteRune(r)
+		if r == '~' && strings.HasSuffix(text.String(), pasteEnd) {
+			pasted := strings.TrimSuffix(text.String(), pasteEnd)
+			pasted = strings.ReplaceAll(pasted, "\r\n", "\n")
+			return strings.ReplaceAll(pasted, "\r", "\n"), nil
+		}
+	}
+}
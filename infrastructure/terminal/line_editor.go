@@ -0,0 +1,478 @@
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl+C.
+var ErrInterrupted = errors.New("interrupted")
+
+// continuationPrompt is shown at the start of every line of a multi-line input after the first.
+const continuationPrompt = "\x1b[2m... \x1b[0m"
+
+// Options configure a LineEditor.
+type Options struct {
+	HistoryFile string    // Path of the persistent input history; empty keeps history in memory only
+	HistorySize int       // Maximum number of history entries; 0 uses DefaultHistorySize
+	Complete    Completer // Tab completion of the word before the cursor; nil disables completion
+}
+
+// LineEditor reads user input from the terminal with line editing: cursor movement,
+// multi-line input (Shift+Enter, Alt+Enter, Ctrl+J or a trailing backslash), bracketed paste,
+// a persistent history with reverse search (Ctrl+R) and tab completion.
+//
+// When stdin is not a terminal, e.g. when input is piped in, it falls back to reading plain
+// lines, still honoring the trailing backslash continuation marker. Lines have no length limit.
+type LineEditor struct {
+	in       *os.File
+	out      *os.File
+	reader   *bufio.Reader
+	history  *History
+	complete Completer
+}
+
+// NewLineEditor creates a LineEditor reading from stdin and writing to stdout.
+func NewLineEditor(opts Options) *LineEditor {
+	size := opts.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &LineEditor{
+		in:       os.Stdin,
+		out:      os.Stdout,
+		reader:   bufio.NewReader(os.Stdin),
+		history:  LoadHistory(opts.HistoryFile, size),
+		complete: opts.Complete,
+	}
+}
+
+// AddHistory appends an input to the persistent history.
+func (e *LineEditor) AddHistory(line string) {
+	e.history.Add(line)
+}
+
+// ReadLine shows the prompt and reads one input, which may span several lines.
+// It returns io.EOF when input ends (Ctrl+D on an empty line) and ErrInterrupted on Ctrl+C.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(int(e.in.Fd()))
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore()
+
+	// Bracketed paste lets the editor tell pasted line breaks from Enter
+	fmt.Fprint(e.out, "\x1b[?2004h")
+	defer fmt.Fprint(e.out, "\x1b[?2004l")
+
+	s := &editState{
+		out:       bufio.NewWriter(e.out),
+		fd:        int(e.out.Fd()),
+		prompt:    prompt,
+		history:   e.history.Entries(),
+		histIndex: len(e.history.Entries()),
+	}
+	s.refresh()
+
+	for {
+		k, err := readKey(e.reader)
+		if err != nil {
+			s.finish()
+			return "", err
+		}
+
+		if s.searching {
+			if done := s.handleSearchKey(k); !done || k.code == keyCancel {
+				continue
+			}
+			// Any other key accepts the match and is handled as usual, e.g. Enter submits it
+		}
+
+		switch k.code {
+		case keyEnter:
+			// A trailing backslash continues the input on a new line
+			if s.pos == len(s.buf) && s.pos > 0 && s.buf[s.pos-1] == '\\' {
+				s.buf[s.pos-1] = '\n'
+				break
+			}
+			s.finish()
+			return string(s.buf), nil
+		case keyInterrupt:
+			s.finish()
+			return "", ErrInterrupted
+		case keyEOF:
+			if len(s.buf) == 0 {
+				s.finish()
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case keyRune:
+			s.insert([]rune{k.r})
+		case keyNewline:
+			s.insert([]rune{'\n'})
+		case keyPaste:
+			s.insert([]rune(strings.ReplaceAll(k.text, "\t", "    ")))
+		case keyBackspace:
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case keyDelete:
+			s.deleteAt(s.pos)
+		case keyLeft:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyRight:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case keyWordLeft:
+			s.pos = s.wordStart()
+		case keyWordRight:
+			s.pos = s.wordEnd()
+		case keyHome:
+			s.pos = s.lineStart(s.pos)
+		case keyEnd:
+			s.pos = s.lineEnd(s.pos)
+		case keyUp:
+			if start := s.lineStart(s.pos); start > 0 {
+				s.moveToLine(s.lineStart(start-1), s.pos-start)
+			} else {
+				s.historyPrev()
+			}
+		case keyDown:
+			if end := s.lineEnd(s.pos); end < len(s.buf) {
+				s.moveToLine(end+1, s.pos-s.lineStart(s.pos))
+			} else {
+				s.historyNext()
+			}
+		case keyKillLineStart:
+			start := s.lineStart(s.pos)
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case keyKillLineEnd:
+			end := s.lineEnd(s.pos)
+			s.buf = append(s.buf[:s.pos], s.buf[end:]...)
+		case keyKillWord:
+			start := s.wordStart()
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case keyClearScreen:
+			fmt.Fprint(s.out, "\x1b[H\x1b[2J")
+			s.cursorRow = 0
+		case keySearch:
+			s.startSearch()
+		case keyTab:
+			if e.complete != nil {
+				s.completeWord(e.complete)
+				s.lastTab = true
+				s.refresh()
+				continue
+			}
+		}
+		s.lastTab = false
+		s.refresh()
+	}
+}
+
+// readPlain reads input without line editing, for when stdin is not a terminal.
+func (e *LineEditor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	var lines []string
+	for {
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasSuffix(line, "\\") && err == nil {
+			lines = append(lines, strings.TrimSuffix(line, "\\"))
+			fmt.Fprint(e.out, continuationPrompt)
+			continue
+		}
+		return strings.Join(append(lines, line), "\n"), nil
+	}
+}
+
+// editState is the state of the input being edited.
+type editState struct {
+	out *bufio.Writer
+	fd  int
+
+	prompt    string
+	buf       []rune
+	pos       int // Cursor position in buf
+	cursorRow int // Screen row of the cursor, relative to the first row of the input
+	lastTab   bool
+
+	history   []string
+	histIndex int    // Index of the history entry shown; len(history) is the draft
+	draft     []rune // The input being written before browsing the history
+
+	searching   bool
+	query       []rune
+	searchIndex int    // Index of the matching history entry; -1 if there is none
+	original    []rune // The input before the search started
+}
+
+// insert inserts runes at the cursor.
+func (s *editState) insert(runes []rune) {
+	s.buf = append(s.buf[:s.pos], append(append([]rune{}, runes...), s.buf[s.pos:]...)...)
+	s.pos += len(runes)
+}
+
+// deleteAt deletes the rune at index i, if any.
+func (s *editState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
+
+// lineStart returns the index of the first rune of the line containing index i.
+func (s *editState) lineStart(i int) int {
+	for i > 0 && s.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// lineEnd returns the index of the line break ending the line containing index i, or len(buf).
+func (s *editState) lineEnd(i int) int {
+	for i < len(s.buf) && s.buf[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// moveToLine moves the cursor to the given column of the line starting at start.
+func (s *editState) moveToLine(start, column int) {
+	s.pos = min(start+column, s.lineEnd(start))
+}
+
+// wordStart returns the start of the word before the cursor.
+func (s *editState) wordStart() int {
+	i := s.pos
+	for i > 0 && unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor.
+func (s *editState) wordEnd() int {
+	i := s.pos
+	for i < len(s.buf) && unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	for i < len(s.buf) && !unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// historyPrev replaces the input with the previous history entry.
+func (s *editState) historyPrev() {
+	if s.histIndex == 0 {
+		return
+	}
+	if s.histIndex == len(s.history) {
+		s.draft = append([]rune{}, s.buf...)
+	}
+	s.histIndex--
+	s.buf = []rune(s.history[s.histIndex])
+	s.pos = len(s.buf)
+}
+
+// historyNext replaces the input with the next history entry, or the draft after the last one.
+func (s *editState) historyNext() {
+	if s.histIndex >= len(s.history) {
+		return
+	}
+	s.histIndex++
+	if s.histIndex == len(s.history) {
+		s.buf = append([]rune{}, s.draft...)
+	} else {
+		s.buf = []rune(s.history[s.histIndex])
+	}
+	s.pos = len(s.buf)
+}
+
+// startSearch enters reverse history search.
+func (s *editState) startSearch() {
+	s.searching = true
+	s.query = nil
+	s.searchIndex = len(s.history)
+	s.original = append([]rune{}, s.buf...)
+}
+
+// handleSearchKey applies a key in reverse search mode. It returns true if the search ended.
+func (s *editState) handleSearchKey(k key) bool {
+	switch k.code {
+	case keyRune:
+		s.query = append(s.query, k.r)
+		s.search(min(s.searchIndex, len(s.history)-1))
+	case keyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+		}
+		s.search(len(s.history) - 1)
+	case keySearch:
+		s.search(s.searchIndex - 1)
+	case keyCancel:
+		s.searching = false
+		s.buf = s.original
+		s.pos = len(s.buf)
+		s.refresh()
+		return true
+	default:
+		s.searching = false
+		s.refresh()
+		return true
+	}
+	s.refresh()
+	return false
+}
+
+// search finds the newest history entry at or before index from that contains the query.
+func (s *editState) search(from int) {
+	query := string(s.query)
+	for i := from; i >= 0; i-- {
+		if i < len(s.history) && strings.Contains(s.history[i], query) {
+			s.searchIndex = i
+			s.buf = []rune(s.history[i])
+			s.pos = len([]rune(s.history[i][:strings.Index(s.history[i], query)]))
+			return
+		}
+	}
+	s.searchIndex = -1
+}
+
+// completeWord completes the word before the cursor. A unique candidate replaces the word,
+// several candidates are completed to their common prefix, and a second Tab lists them.
+func (s *editState) completeWord(complete Completer) {
+	start := s.pos
+	for start > 0 && !unicode.IsSpace(s.buf[start-1]) {
+		start--
+	}
+	word := string(s.buf[start:s.pos])
+	candidates := complete(word)
+
+	replacement := commonPrefix(candidates)
+	switch {
+	case len(candidates) == 0:
+		fmt.Fprint(s.out, "\a")
+		return
+	case len(candidates) == 1 && !strings.HasSuffix(replacement, "/"):
+		replacement += " "
+	case len(candidates) > 1 && replacement == word && s.lastTab:
+		s.listCandidates(candidates)
+		return
+	}
+	s.buf = append(s.buf[:start], append([]rune(replacement), s.buf[s.pos:]...)...)
+	s.pos = start + len([]rune(replacement))
+}
+
+// listCandidates prints the completion candidates below the input, which is then redrawn under them.
+func (s *editState) listCandidates(candidates []string) {
+	pos := s.pos
+	s.moveToEnd()
+	s.pos = pos
+	fmt.Fprint(s.out, "\r\n")
+	for _, candidate := range candidates {
+		fmt.Fprintf(s.out, "%s\r\n", candidate)
+	}
+	s.cursorRow = 0
+}
+
+// moveToEnd moves the screen cursor below the last row of the input.
+func (s *editState) moveToEnd() {
+	s.pos = len(s.buf)
+	s.refresh()
+}
+
+// finish moves the screen cursor to the line after the input.
+func (s *editState) finish() {
+	s.searching = false
+	s.moveToEnd()
+	fmt.Fprint(s.out, "\r\n")
+	s.out.Flush()
+}
+
+// refresh redraws the prompt and the input, wrapping at the terminal width, and places the cursor.
+func (s *editState) refresh() {
+	width := terminalWidth(s.fd)
+	if width <= 0 {
+		width = 80
+	}
+
+	prompt := s.prompt
+	if s.searching {
+		label := "reverse-i-search"
+		if s.searchIndex < 0 {
+			label = "failed reverse-i-search"
+		}
+		prompt = fmt.Sprintf("(%s)`%s': ", label, string(s.query))
+	}
+
+	// Return to the first row of the input and clear everything below it
+	if s.cursorRow > 0 {
+		fmt.Fprintf(s.out, "\x1b[%dA", s.cursorRow)
+	}
+	fmt.Fprint(s.out, "\r\x1b[J", prompt)
+
+	row, col := 0, DisplayWidth(prompt)
+	curRow, curCol := 0, col
+	for i, r := range s.buf {
+		if r == '\n' {
+			if i == s.pos {
+				curRow, curCol = row, min(col, width-1)
+			}
+			fmt.Fprint(s.out, "\r\n", continuationPrompt)
+			row, col = row+1, DisplayWidth(continuationPrompt)
+			continue
+		}
+
+		w := runeWidth(r)
+		if col+w > width {
+			// Pad a wide character that does not fit, then wrap explicitly
+			fmt.Fprint(s.out, strings.Repeat(" ", max(width-col, 0)), "\r\n")
+			row, col = row+1, 0
+		}
+		if i == s.pos {
+			curRow, curCol = row, col
+		}
+		s.out.WriteRune(r)
+		col += w
+	}
+	if col >= width {
+		// Leave the pending wrap state so the cursor can be placed on the next row
+		fmt.Fprint(s.out, "\r\n")
+		row, col = row+1, 0
+	}
+	if s.pos == len(s.buf) {
+		curRow, curCol = row, col
+	}
+
+	// Move from the end of the input to the cursor position
+	if up := row - curRow; up > 0 {
+		fmt.Fprintf(s.out, "\x1b[%dA", up)
+	}
+	fmt.Fprint(s.out, "\r")
+	if curCol > 0 {
+		fmt.Fprintf(s.out, "\x1b[%dC", curCol)
+	}
+	s.cursorRow = curRow
+	s.out.Flush()
+}
@@ -0,0 +1,161 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"code-ai-editor/domain"
+)
+
+// reviewHelp explains the answers to the review question.
+const reviewHelp = `  y  apply the change
+  n  reject it; you are asked for a reason, which is passed on to the model (or type "n <reason>")
+  e  edit the change in $VISUAL or $EDITOR before applying it
+  f  apply it and all later changes to this file without asking
+  a  apply it and all later changes of the session without asking`
+
+// ConsoleApprover reviews file changes in the console chat. It prints the unified diff of each
+// change and asks the user to apply it, reject it with a reason for the model, edit it in their
+// editor first, or always allow changes to the file or for the rest of the session.
+type ConsoleApprover struct {
+	editor *LineEditor
+	out    io.Writer
+	color  bool
+}
+
+// NewConsoleApprover creates a ConsoleApprover asking its questions with editor.
+// The diffs are colored if color is set.
+func NewConsoleApprover(editor *LineEditor, color bool) *ConsoleApprover {
+	return &ConsoleApprover{editor: editor, out: editor.out, color: color}
+}
+
+// Approve shows the diff of a file change and asks the user what to do with it until they decide.
+// Ending input, e.g. with Ctrl+C or Ctrl+D, rejects the change.
+func (a *ConsoleApprover) Approve(ctx context.Context, request domain.ApprovalRequest) domain.ApprovalDecision {
+	verb := "Apply the change to"
+	if request.Change.Create {
+		verb = "Create"
+	}
+	question := a.style(styleYellow, fmt.Sprintf("%s %s?", verb, request.Change.Path)) + " [y/n/e/f/a/?]: "
+
+	content, diff := request.Change.After, request.Diff
+	showDiff := true
+	for ctx.Err() == nil {
+		if showDiff {
+			a.printDiff(diff)
+			showDiff = false
+		}
+
+		answer, err := a.editor.ReadLine(question)
+		if err != nil {
+			return domain.ApprovalDecision{}
+		}
+		choice, reason, _ := strings.Cut(strings.TrimSpace(answer), " ")
+		switch strings.ToLower(choice) {
+		case "y", "yes":
+			return a.decision(request, content, domain.ApproveOnce)
+		case "f", "file":
+			return a.decision(request, content, domain.ApproveFile)
+		case "a", "all":
+			return a.decision(request, content, domain.ApproveSession)
+		case "n", "no":
+			if reason == "" {
+				reason, _ = a.editor.ReadLine("Reason for the model (optional): ")
+			}
+			return domain.ApprovalDecision{Reason: strings.TrimSpace(reason)}
+		case "e", "edit":
+			edited, err := editText(request.Change.Path, content)
+			if err != nil {
+				fmt.Fprintln(a.out, a.style(styleRed, fmt.Sprintf("Could not edit the change: %v", err)))
+				continue
+			}
+			content = edited
+			diff = domain.UnifiedDiff(request.Change.Path, request.Change.Before, content, request.Change.Create)
+			showDiff = true
+		default:
+			fmt.Fprintln(a.out, reviewHelp)
+		}
+	}
+	return domain.ApprovalDecision{}
+}
+
+// decision returns the approval of the change with the given final content.
+func (a *ConsoleApprover) decision(request domain.ApprovalRequest, content string, scope domain.ApprovalScope) domain.ApprovalDecision {
+	decision := domain.ApprovalDecision{Approved: true, Scope: scope}
+	if content != request.Change.After {
+		decision.Edited, decision.Content = true, content
+	}
+	return decision
+}
+
+// printDiff prints a unified diff, colored if enabled.
+func (a *ConsoleApprover) printDiff(diff string) {
+	if diff == "" {
+		fmt.Fprintln(a.out, a.style(styleDim, "(no changes)"))
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		fmt.Fprintln(a.out, a.style(diffLineStyle(line), line))
+	}
+}
+
+// style wraps text in an escape sequence if colors are enabled.
+func (a *ConsoleApprover) style(style, text string) string {
+	if !a.color || style == "" {
+		return text
+	}
+	return style + text + styleReset
+}
+
+// editText lets the user edit content in their editor, in a temporary file named like path
+// so that the editor picks the right syntax, and returns the edited content.
+func editText(path, content string) (string, error) {
+	command := strings.Fields(editorCommand())
+	if len(command) == 0 {
+		return "", fmt.Errorf("no editor configured; set VISUAL or EDITOR")
+	}
+
+	file, err := os.CreateTemp("", "review-*-"+filepath.Base(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	cmd := exec.Command(command[0], append(command[1:], file.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed: %w", command[0], err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited file: %w", err)
+	}
+	return string(edited), nil
+}
+
+// editorCommand returns the user's editor: $VISUAL, then $EDITOR, then a platform default.
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package terminal
+
+import "errors"
+
+// makeRaw is not supported on this platform; the editor falls back to plain line input.
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+// terminalWidth is not supported on this platform.
+func terminalWidth(fd int) int {
+	return 0
+}
+
+// terminalSize is not supported on this platform.
+func terminalSize(fd int) (cols, rows int) {
+	return 0, 0
+}
+
+// isTerminal is not supported on this platform, so output is always treated as redirected.
+func isTerminal(fd int) bool {
+	return false
+}
@@ -0,0 +1,14 @@
+package terminal
+
+import "os"
+
+// IsTerminal reports whether f is connected to a terminal, as opposed to a file or a pipe.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(int(f.Fd()))
+}
+
+// Width returns the number of columns of the terminal f is connected to,
+// or 0 if f is not a terminal or its size cannot be determined.
+func Width(f *os.File) int {
+	return terminalWidth(int(f.Fd()))
+}
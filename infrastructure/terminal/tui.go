@@ -0,0 +1,532 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"code-ai-editor/domain"
+)
+
+// redrawInterval is how often the screen is redrawn while something changes, e.g. during streaming.
+const redrawInterval = 50 * time.Millisecond
+
+// tuiPane identifies the pane that PgUp and PgDn scroll.
+type tuiPane int
+
+const (
+	paneConversation tuiPane = iota
+	paneDetails
+)
+
+// tuiEntry is one message in the conversation pane.
+type tuiEntry struct {
+	prefix      string // Written before the text, e.g. "You: "
+	prefixStyle string
+	style       string
+	text        string
+}
+
+// toolStatus is the state of a tool call in the side panel.
+type toolStatus int
+
+const (
+	toolRunning toolStatus = iota
+	toolAwaitingApproval
+	toolSucceeded
+	toolFailed
+)
+
+// toolCall is a tool call listed in the side panel.
+type toolCall struct {
+	id       string
+	name     string
+	input    json.RawMessage
+	diff     string
+	output   string
+	status   toolStatus
+	start    time.Time
+	duration time.Duration
+}
+
+// tuiPrompt is a question waiting for the user's answer: a confirmation or a change to approve.
+// It is answered with one of its keys; a prompt taking a reason lets the user type the reason
+// for answering n in the input line.
+type tuiPrompt struct {
+	question   string
+	keys       string // Accepted answer keys, e.g. "yn"
+	withReason bool
+	reason     bool   // The user is typing the reason in the input line
+	draft      []rune // Input line saved while the reason is typed
+	reply      chan tuiAnswer
+}
+
+// tuiAnswer is the answer to a tuiPrompt.
+type tuiAnswer struct {
+	key    rune
+	reason string
+}
+
+// TUI is the full-screen chat interface. The conversation fills the left pane; the side panel
+// lists the tool calls of the session with their status and duration, above the details of the
+// selected call, which show the diff of a file change. Log output is captured into the status bar,
+// so that it does not garble the screen.
+//
+// It is both the user message provider and the event sink of the agent, and reviews file
+// changes as its ToolApprover: y applies a pending change, n rejects it with an optional reason,
+// f and a apply it and all later changes to the file or of the session. Esc cancels the turn.
+type TUI struct {
+	in         *os.File
+	out        *os.File
+	reader     *bufio.Reader
+	restore    func() error
+	cancelTurn func()
+
+	mu         sync.Mutex
+	entries    []tuiEntry
+	open       domain.EventType // Type of the delta block being streamed into the last entry, if any
+	calls      []*toolCall
+	selected   int  // Index of the call shown in the details pane; -1 if there are none
+	follow     bool // Select each new call as it starts
+	focus      tuiPane
+	scroll     [2]int // Lines scrolled back from the bottom of each pane
+	input      []rune
+	pos        int
+	waiting    bool // The agent waits for a user message
+	prompt     *tuiPrompt
+	logLine    string
+	cols, rows int
+	dirty      bool
+	closed     bool
+
+	messages  chan string
+	quit      chan struct{}
+	closeOnce sync.Once
+	quitOnce  sync.Once
+}
+
+// NewTUI creates a full-screen interface on stdin and stdout. Call Start to take over the screen.
+func NewTUI() *TUI {
+	return &TUI{
+		in:       os.Stdin,
+		out:      os.Stdout,
+		reader:   bufio.NewReader(os.Stdin),
+		selected: -1,
+		follow:   true,
+		messages: make(chan string, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start switches the terminal to the full-screen interface and starts reading keys.
+// cancelTurn is called when the user cancels the turn in progress, e.g. Agent.CancelTurn.
+func (t *TUI) Start(cancelTurn func()) error {
+	if !isTerminal(int(t.out.Fd())) {
+		return errors.New("the full-screen interface needs a terminal")
+	}
+	restore, err := makeRaw(int(t.in.Fd()))
+	if err != nil {
+		return fmt.Errorf("the full-screen interface needs a terminal: %w", err)
+	}
+	t.restore = restore
+	t.cancelTurn = cancelTurn
+	t.cols, t.rows = terminalSize(int(t.out.Fd()))
+	t.dirty = true
+
+	log.SetOutput(tuiLogWriter{t})
+	// Alternate screen, bracketed paste
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?2004h")
+
+	go t.readInput()
+	go t.redrawLoop()
+	return nil
+}
+
+// Close restores the terminal and the log output. It is safe to call more than once.
+func (t *TUI) Close() {
+	t.closeOnce.Do(func() {
+		t.signalQuit()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.closed = true
+		log.SetOutput(os.Stderr)
+		fmt.Fprint(t.out, "\x1b[?2004l\x1b[?25h\x1b[?1049l")
+		if t.restore != nil {
+			t.restore()
+		}
+	})
+}
+
+// GetUserMessage waits for the user to send a message. It returns false once the user quits.
+func (t *TUI) GetUserMessage() (string, bool) {
+	t.mu.Lock()
+	t.waiting = true
+	t.dirty = true
+	t.mu.Unlock()
+
+	select {
+	case message := <-t.messages:
+		return message, true
+	case <-t.quit:
+		return "", false
+	}
+}
+
+// Confirm asks the user a yes/no question in the input line.
+func (t *TUI) Confirm(question string) bool {
+	return t.ask(context.Background(), &tuiPrompt{question: question, keys: "yn"}).key == 'y'
+}
+
+// Approve shows the diff of a file change in the details pane and asks the user to apply or reject it.
+// A change still pending when the turn is cancelled is rejected.
+func (t *TUI) Approve(ctx context.Context, request domain.ApprovalRequest) domain.ApprovalDecision {
+	t.mu.Lock()
+	if i := t.findCall(request.ToolUse.ID); i >= 0 {
+		t.calls[i].status = toolAwaitingApproval
+		t.selected = i
+		t.focus = paneDetails
+		t.scroll[paneDetails] = 0
+	}
+	t.mu.Unlock()
+
+	verb := "Apply the change to"
+	if request.Change.Create {
+		verb = "Create"
+	}
+	answer := t.ask(ctx, &tuiPrompt{
+		question:   fmt.Sprintf("%s %s? y: apply, n: reject, f: always for this file, a: always this session", verb, request.Change.Path),
+		keys:       "ynfa",
+		withReason: true,
+	})
+
+	t.mu.Lock()
+	if i := t.findCall(request.ToolUse.ID); i >= 0 && t.calls[i].status == toolAwaitingApproval {
+		t.calls[i].status = toolRunning
+	}
+	t.mu.Unlock()
+
+	switch answer.key {
+	case 'y':
+		return domain.ApprovalDecision{Approved: true}
+	case 'f':
+		return domain.ApprovalDecision{Approved: true, Scope: domain.ApproveFile}
+	case 'a':
+		return domain.ApprovalDecision{Approved: true, Scope: domain.ApproveSession}
+	}
+	return domain.ApprovalDecision{Reason: answer.reason}
+}
+
+// ask shows a question in the input line and waits for the answer. Anything that ends the wait
+// early, such as a cancelled turn or quitting, counts as n.
+func (t *TUI) ask(ctx context.Context, prompt *tuiPrompt) tuiAnswer {
+	prompt.reply = make(chan tuiAnswer, 1)
+	t.mu.Lock()
+	t.prompt = prompt
+	t.dirty = true
+	t.mu.Unlock()
+
+	answer := tuiAnswer{key: 'n'}
+	select {
+	case answer = <-prompt.reply:
+	case <-ctx.Done():
+	case <-t.quit:
+	}
+
+	t.mu.Lock()
+	if t.prompt == prompt {
+		t.clearPrompt()
+	}
+	t.dirty = true
+	t.mu.Unlock()
+	return answer
+}
+
+// Emit adds an agent event to the conversation pane or the side panel.
+func (t *TUI) Emit(event domain.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dirty = true
+
+	switch event.Type {
+	case domain.EventTextDelta, domain.EventThinkingDelta:
+		if t.open != event.Type {
+			t.open = event.Type
+			if event.Type == domain.EventTextDelta {
+				t.addEntry(tuiEntry{prefix: "Claude: ", prefixStyle: styleCyan})
+			} else {
+				t.addEntry(tuiEntry{prefix: "Thinking: ", style: styleDim})
+			}
+		}
+		t.entries[len(t.entries)-1].text += event.Text
+		return
+	case domain.EventBlockFinished:
+		t.open = ""
+		return
+	}
+
+	t.open = ""
+	switch event.Type {
+	case domain.EventToolCallStarted:
+		t.calls = append(t.calls, &toolCall{
+			id:    event.ToolUseID,
+			name:  event.ToolName,
+			input: event.Input,
+			diff:  event.Diff,
+			start: event.Time,
+		})
+		if t.follow {
+			t.selected = len(t.calls) - 1
+			t.scroll[paneDetails] = 0
+		}
+	case domain.EventToolCallFinished:
+		if i := t.findCall(event.ToolUseID); i >= 0 {
+			call := t.calls[i]
+			call.output = event.Output
+			call.duration = event.Duration
+			call.status = toolSucceeded
+			if event.IsError {
+				call.status = toolFailed
+			}
+		}
+	case domain.EventContextInjected:
+		snippets := strings.Count(event.Text, "--- File: ")
+		t.addEntry(tuiEntry{style: styleDim, text: fmt.Sprintf("Injected %d code snippets as context", snippets)})
+	case domain.EventNotice:
+		t.addEntry(tuiEntry{style: noticeStyle(event.Level), text: event.Text})
+	case domain.EventOutput:
+		t.addEntry(tuiEntry{text: strings.TrimRight(event.Text, "\n")})
+	case domain.EventError:
+		t.addEntry(tuiEntry{style: styleRed, text: "Error: " + event.Text})
+	}
+}
+
+// addEntry appends a message to the conversation pane.
+func (t *TUI) addEntry(entry tuiEntry) {
+	t.entries = append(t.entries, entry)
+}
+
+// findCall returns the index of the tool call with the given ID, or -1.
+func (t *TUI) findCall(id string) int {
+	for i, call := range t.calls {
+		if call.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// signalQuit makes the pending and all further GetUserMessage calls return false.
+func (t *TUI) signalQuit() {
+	t.quitOnce.Do(func() { close(t.quit) })
+}
+
+// readInput handles keys until input ends.
+func (t *TUI) readInput() {
+	for {
+		k, err := readKey(t.reader)
+		if err != nil {
+			t.signalQuit()
+			return
+		}
+		t.mu.Lock()
+		t.handleKey(k)
+		t.dirty = true
+		t.mu.Unlock()
+	}
+}
+
+// handleKey applies a keypress. A pending question takes its answer keys, or the reason typed
+// for a rejection; all other keys edit the input line, scroll the panes or select a tool call.
+func (t *TUI) handleKey(k key) {
+	if t.prompt != nil {
+		switch {
+		case t.prompt.reason && k.code == keyEnter:
+			t.answer(tuiAnswer{key: 'n', reason: strings.TrimSpace(string(t.input))})
+			return
+		case k.code == keyRune && !t.prompt.reason && strings.ContainsRune(t.prompt.keys, unicode.ToLower(k.r)):
+			answer := unicode.ToLower(k.r)
+			if answer == 'n' && t.prompt.withReason {
+				// Type the reason in the input line, keeping the draft message for later
+				t.prompt.reason = true
+				t.prompt.draft = t.input
+				t.input, t.pos = nil, 0
+				return
+			}
+			t.answer(tuiAnswer{key: answer})
+			return
+		case k.code == keyCancel:
+			t.answer(tuiAnswer{key: 'n'})
+			return
+		case k.code == keyInterrupt:
+			t.answer(tuiAnswer{key: 'n'})
+			t.cancelTurn()
+			return
+		}
+	}
+
+	switch k.code {
+	case keyEnter:
+		t.submit()
+	case keyRune:
+		if t.prompt == nil || t.prompt.reason {
+			t.insert([]rune{k.r})
+		}
+	case keyNewline:
+		t.insert([]rune{'\n'})
+	case keyPaste:
+		t.insert([]rune(strings.ReplaceAll(k.text, "\t", "    ")))
+	case keyBackspace:
+		if t.pos > 0 {
+			t.pos--
+			t.input = append(t.input[:t.pos], t.input[t.pos+1:]...)
+		}
+	case keyDelete:
+		if t.pos < len(t.input) {
+			t.input = append(t.input[:t.pos], t.input[t.pos+1:]...)
+		}
+	case keyLeft:
+		t.pos = max(t.pos-1, 0)
+	case keyRight:
+		t.pos = min(t.pos+1, len(t.input))
+	case keyHome:
+		t.pos = 0
+	case keyEnd:
+		t.pos = len(t.input)
+	case keyKillLineStart:
+		t.input = append([]rune{}, t.input[t.pos:]...)
+		t.pos = 0
+	case keyKillLineEnd:
+		t.input = t.input[:t.pos]
+	case keyUp:
+		if t.selected > 0 {
+			t.selectCall(t.selected - 1)
+		}
+	case keyDown:
+		if t.selected < len(t.calls)-1 {
+			t.selectCall(t.selected + 1)
+		}
+	case keyPageUp:
+		t.scroll[t.focus] += t.pageSize()
+	case keyPageDown:
+		t.scroll[t.focus] = max(t.scroll[t.focus]-t.pageSize(), 0)
+	case keyTab:
+		t.focus = 1 - t.focus
+	case keyClearScreen:
+		fmt.Fprint(t.out, "\x1b[2J")
+	case keyCancel:
+		if !t.waiting {
+			t.cancelTurn()
+			t.logLine = "Cancelling the turn..."
+		} else {
+			t.input, t.pos = nil, 0
+		}
+	case keyInterrupt:
+		if !t.waiting {
+			t.cancelTurn()
+			t.logLine = "Cancelling the turn..."
+		} else {
+			t.signalQuit()
+		}
+	case keyEOF:
+		if t.waiting && len(t.input) == 0 {
+			t.signalQuit()
+		}
+	}
+}
+
+// answer replies to the pending question.
+func (t *TUI) answer(answer tuiAnswer) {
+	t.prompt.reply <- answer
+	t.clearPrompt()
+}
+
+// clearPrompt removes the pending question, restoring the draft message if a reason was typed.
+func (t *TUI) clearPrompt() {
+	if t.prompt.reason {
+		t.input = t.prompt.draft
+		t.pos = len(t.input)
+	}
+	t.prompt = nil
+}
+
+// insert inserts runes at the cursor of the input line.
+func (t *TUI) insert(runes []rune) {
+	t.input = append(t.input[:t.pos], append(runes, t.input[t.pos:]...)...)
+	t.pos += len(runes)
+}
+
+// submit sends the input line to the agent, if it is waiting for a message.
+func (t *TUI) submit() {
+	message := string(t.input)
+	if strings.TrimSpace(message) == "" {
+		return
+	}
+	if !t.waiting {
+		t.logLine = "The agent is busy. Press Esc to cancel the turn."
+		return
+	}
+	t.waiting = false
+	t.input, t.pos = nil, 0
+	t.scroll[paneConversation] = 0
+	t.addEntry(tuiEntry{prefix: "You: ", prefixStyle: styleMagenta, text: message})
+	t.messages <- message
+}
+
+// selectCall shows the details of the tool call at index i. Selecting the last call
+// makes the selection follow new calls again.
+func (t *TUI) selectCall(i int) {
+	t.selected = i
+	t.follow = i == len(t.calls)-1
+	t.scroll[paneDetails] = 0
+}
+
+// pageSize returns the number of lines PgUp and PgDn scroll.
+func (t *TUI) pageSize() int {
+	return max(t.rows/2, 1)
+}
+
+// redrawLoop redraws the screen whenever something changed, until the interface is closed.
+func (t *TUI) redrawLoop() {
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return
+		}
+		if cols, rows := terminalSize(int(t.out.Fd())); cols != t.cols || rows != t.rows {
+			t.cols, t.rows = cols, rows
+			t.dirty = true
+		}
+		// Running tool calls and the busy indicator change with time
+		if t.dirty || !t.waiting {
+			t.draw()
+			t.dirty = false
+		}
+		t.mu.Unlock()
+	}
+}
+
+// tuiLogWriter shows log output in the status bar of the interface.
+type tuiLogWriter struct {
+	t *TUI
+}
+
+// Write keeps the last non-empty line written.
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSpace(string(p)), "\n")
+	w.t.mu.Lock()
+	w.t.logLine = strings.TrimSpace(lines[len(lines)-1])
+	w.t.dirty = true
+	w.t.mu.Unlock()
+	return len(p), nil
+}
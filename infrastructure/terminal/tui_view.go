@@ -0,0 +1,428 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"code-ai-editor/domain"
+)
+
+// ANSI escape codes used by the full-screen interface.
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleReverse = "\x1b[7m"
+	styleRed     = "\x1b[31m"
+	styleGreen   = "\x1b[32m"
+	styleYellow  = "\x1b[33m"
+	styleCyan    = "\x1b[36m"
+	styleMagenta = "\x1b[95m"
+)
+
+// minSidePanelWidth is the narrowest the side panel gets; narrower terminals hide it.
+const minSidePanelWidth = 24
+
+// spinnerFrames animate the status bar while the agent works.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// noticeStyle returns the style of a notice level.
+func noticeStyle(level domain.NoticeLevel) string {
+	switch level {
+	case domain.NoticeWarning:
+		return styleYellow
+	case domain.NoticeMuted:
+		return styleDim
+	default:
+		return styleGreen
+	}
+}
+
+// draw redraws the whole screen: a header row, the conversation pane and the side panel,
+// the input line and the status bar.
+func (t *TUI) draw() {
+	if t.cols < 20 || t.rows < 5 {
+		return
+	}
+	var screen bytes.Buffer
+	screen.WriteString("\x1b[?25l") // Hide the cursor while drawing
+
+	side := 0
+	if t.cols >= 3*minSidePanelWidth {
+		side = max(t.cols*2/5, minSidePanelWidth)
+	}
+	mainWidth := t.cols
+	if side > 0 {
+		mainWidth = t.cols - side - 1
+	}
+	height := t.rows - 3 // Below the header, above the input line and the status bar
+
+	conversation := t.conversationLines(mainWidth, height)
+	var panel []string
+	if side > 0 {
+		panel = t.sidePanelLines(side, height)
+	}
+
+	// Header
+	row := 1
+	moveTo(&screen, row, 1)
+	screen.WriteString(t.paneTitle("Conversation", paneConversation, mainWidth))
+	if side > 0 {
+		screen.WriteString(" " + t.paneTitle(fmt.Sprintf("Tool calls (%d)", len(t.calls)), -1, side))
+	}
+
+	for i := 0; i < height; i++ {
+		row++
+		moveTo(&screen, row, 1)
+		screen.WriteString(conversation[i])
+		if side > 0 {
+			screen.WriteString(styleDim + "│" + styleReset)
+			screen.WriteString(panel[i])
+		}
+	}
+
+	// Input line, or the pending question
+	row++
+	moveTo(&screen, row, 1)
+	cursor := -1
+	switch {
+	case t.prompt != nil && t.prompt.reason:
+		const label = "Reason: "
+		var line string
+		line, cursor = inputView(t.input, t.pos, t.cols-len(label))
+		screen.WriteString(styleYellow + label + styleReset + line + "\x1b[K")
+		cursor += len(label)
+	case t.prompt != nil:
+		screen.WriteString(styleYellow + styleBold + fit(t.prompt.question, t.cols) + styleReset)
+	default:
+		var line string
+		line, cursor = inputView(t.input, t.pos, t.cols-2)
+		screen.WriteString(styleMagenta + "> " + styleReset + line + "\x1b[K")
+		cursor += 2
+	}
+
+	// Status bar
+	row++
+	moveTo(&screen, row, 1)
+	screen.WriteString(styleReverse + t.statusLine() + styleReset)
+
+	if cursor >= 0 {
+		moveTo(&screen, t.rows-1, cursor+1)
+		screen.WriteString("\x1b[?25h")
+	}
+	t.out.Write(screen.Bytes())
+}
+
+// paneTitle returns the title row of a pane, highlighted if the pane has the focus.
+func (t *TUI) paneTitle(title string, pane tuiPane, width int) string {
+	if pane == t.focus {
+		return styleReverse + fit(" "+title, width) + styleReset
+	}
+	return styleBold + fit(" "+title, width) + styleReset
+}
+
+// conversationLines returns the visible lines of the conversation pane, each padded to width.
+// Only the entries needed to fill the pane are wrapped, starting from the most recent one.
+func (t *TUI) conversationLines(width, height int) []string {
+	scroll := t.scroll[paneConversation]
+	var lines []string // In reverse order
+	for i := len(t.entries) - 1; i >= 0 && len(lines) < height+scroll; i-- {
+		entryLines := t.entries[i].render(width)
+		for j := len(entryLines) - 1; j >= 0; j-- {
+			lines = append(lines, entryLines[j])
+		}
+		if i > 0 {
+			lines = append(lines, strings.Repeat(" ", width)) // Blank line between entries
+		}
+	}
+
+	// Clamp the scroll position to the top of the conversation
+	if scroll > max(len(lines)-height, 0) {
+		scroll = max(len(lines)-height, 0)
+		t.scroll[paneConversation] = scroll
+	}
+
+	visible := make([]string, height)
+	for i := range visible {
+		index := scroll + height - 1 - i
+		if index < len(lines) {
+			visible[i] = lines[index]
+		} else {
+			visible[i] = strings.Repeat(" ", width)
+		}
+	}
+	return visible
+}
+
+// render wraps the entry to width and styles its lines.
+func (e tuiEntry) render(width int) []string {
+	wrapped := wrapText(e.prefix+e.text, width)
+	lines := make([]string, len(wrapped))
+	for i, line := range wrapped {
+		padding := strings.Repeat(" ", max(width-DisplayWidth(line), 0))
+		if i == 0 && e.prefix != "" {
+			rest := strings.TrimPrefix(line, e.prefix)
+			if rest != line {
+				lines[i] = e.prefixStyle + e.prefix + styleReset + e.style + rest + styleReset + padding
+				continue
+			}
+		}
+		lines[i] = e.style + line + styleReset + padding
+	}
+	return lines
+}
+
+// sidePanelLines returns the lines of the side panel: the list of tool calls followed by
+// the details of the selected call.
+func (t *TUI) sidePanelLines(width, height int) []string {
+	lines := make([]string, 0, height)
+
+	// List of tool calls, scrolled to keep the selected one visible
+	listHeight := min(max(len(t.calls), 1), max(height/3, 3))
+	if len(t.calls) == 0 {
+		lines = append(lines, styleDim+fit(" No tool calls yet", width)+styleReset)
+	} else {
+		first := max(min(t.selected-listHeight+1, len(t.calls)-listHeight), 0)
+		if t.selected < first {
+			first = t.selected
+		}
+		for i := first; i < len(t.calls) && i < first+listHeight; i++ {
+			lines = append(lines, t.calls[i].render(width, i == t.selected))
+		}
+	}
+	for len(lines) < listHeight {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+
+	// Details of the selected call
+	title := "Details"
+	var details []string
+	if t.selected >= 0 && t.selected < len(t.calls) {
+		call := t.calls[t.selected]
+		title = "Details: " + call.name
+		details = call.details(width)
+	}
+	lines = append(lines, t.paneTitle(title, paneDetails, width))
+
+	detailHeight := height - len(lines)
+	scroll := min(t.scroll[paneDetails], max(len(details)-detailHeight, 0))
+	t.scroll[paneDetails] = scroll
+	for i := 0; i < detailHeight; i++ {
+		if scroll+i < len(details) {
+			lines = append(lines, details[scroll+i])
+		} else {
+			lines = append(lines, strings.Repeat(" ", width))
+		}
+	}
+	return lines[:height]
+}
+
+// render returns the line of the tool call in the list: status, name, the most telling
+// input argument and the duration.
+func (c *toolCall) render(width int, selected bool) string {
+	icon, iconStyle := "…", styleYellow
+	duration := time.Since(c.start)
+	switch c.status {
+	case toolAwaitingApproval:
+		icon = "?"
+	case toolSucceeded:
+		icon, iconStyle, duration = "✓", styleGreen, c.duration
+	case toolFailed:
+		icon, iconStyle, duration = "✗", styleRed, c.duration
+	}
+	right := " " + formatDuration(duration)
+	left := fit(fmt.Sprintf(" %s %s", c.name, inputSummary(c.input)), width-2-len(right))
+
+	if selected {
+		return iconStyle + " " + icon + styleReset + styleReverse + left + right + styleReset
+	}
+	return iconStyle + " " + icon + styleReset + left + styleDim + right + styleReset
+}
+
+// details returns the lines shown for the tool call in the details pane: the colored diff of
+// a file change, or the input and output of any other call.
+func (c *toolCall) details(width int) []string {
+	var lines []string
+	if c.diff != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(c.diff, "\n"), "\n") {
+			lines = append(lines, diffLineStyle(line)+fit(cleanText(line), width)+styleReset)
+		}
+	} else {
+		var input bytes.Buffer
+		if json.Indent(&input, c.input, "", "  ") != nil {
+			input.Reset()
+			input.Write(c.input)
+		}
+		for _, line := range wrapText(input.String(), width) {
+			lines = append(lines, fit(line, width))
+		}
+	}
+
+	if c.status == toolSucceeded || c.status == toolFailed {
+		style := styleDim
+		if c.status == toolFailed {
+			style = styleRed
+		}
+		lines = append(lines, strings.Repeat(" ", width))
+		for _, line := range wrapText(strings.TrimRight(c.output, "\n"), width) {
+			lines = append(lines, style+fit(line, width)+styleReset)
+		}
+	}
+	return lines
+}
+
+// diffLineStyle returns the style of a line of a unified diff.
+func diffLineStyle(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return styleBold
+	case strings.HasPrefix(line, "+"):
+		return styleGreen
+	case strings.HasPrefix(line, "-"):
+		return styleRed
+	case strings.HasPrefix(line, "@@"):
+		return styleCyan
+	}
+	return ""
+}
+
+// statusLine returns the status bar: what the agent is doing and the key bindings on the left,
+// the last log line on the right.
+func (t *TUI) statusLine() string {
+	var left string
+	switch {
+	case t.prompt != nil && t.prompt.reason:
+		left = " Type why you reject the change · Enter send · Esc reject without a reason"
+	case t.prompt != nil && t.prompt.withReason:
+		left = " y apply · n reject · f always for this file · a always this session · Esc reject"
+	case t.prompt != nil:
+		left = " y yes · n no · Esc cancel"
+	case t.waiting:
+		left = " Enter send · Tab switch pane · PgUp/PgDn scroll · ↑/↓ select tool call · Ctrl+C quit"
+	default:
+		frame := spinnerFrames[time.Now().UnixMilli()/100%int64(len(spinnerFrames))]
+		left = fmt.Sprintf(" %s Working · Esc cancel turn · Tab switch pane · PgUp/PgDn scroll", frame)
+	}
+
+	right := ""
+	if t.logLine != "" {
+		room := t.cols - DisplayWidth(left) - 3
+		if room > 10 {
+			right = fit(t.logLine, room) + " "
+		}
+	}
+	return fit(left, t.cols-DisplayWidth(right)) + right
+}
+
+// inputView returns the part of the input line that fits in width columns, scrolled so that the
+// cursor is visible, and the column of the cursor. Line breaks are shown as "⏎".
+func inputView(input []rune, pos, width int) (string, int) {
+	display := []rune(strings.ReplaceAll(string(input), "\n", "⏎"))
+	start := 0
+	for columns(display[start:pos]) >= width {
+		start++
+	}
+	view := fit(string(display[start:]), width)
+	return view, columns(display[start:pos])
+}
+
+// columns returns the number of columns the runes occupy on screen.
+func columns(runes []rune) int {
+	width := 0
+	for _, r := range runes {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// inputSummary returns the most telling argument of a tool call, such as its path or query.
+func inputSummary(input json.RawMessage) string {
+	var args map[string]any
+	if json.Unmarshal(input, &args) != nil {
+		return ""
+	}
+	for _, name := range []string{"path", "query", "pattern", "command", "url"} {
+		if value, ok := args[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// formatDuration formats a tool call duration compactly, e.g. "850ms" or "2.4s".
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// wrapText breaks text into lines of at most width columns, at spaces where possible.
+// Tabs are expanded and line breaks in the text are kept.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(cleanText(text), "\n") {
+		runes := []rune(paragraph)
+		for columns(runes) > width {
+			// Take as many runes as fit, then back up to the last space
+			end, used := 0, 0
+			for end < len(runes) && used+runeWidth(runes[end]) <= width {
+				used += runeWidth(runes[end])
+				end++
+			}
+			end = max(end, 1) // A character wider than the pane still takes a line
+			cut := end
+			for i := end; i > 0; i-- {
+				if runes[i-1] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+			runes = runes[cut:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// fit truncates plain text to width columns, or pads it with spaces to exactly width columns.
+func fit(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	var out strings.Builder
+	used := 0
+	for _, r := range text {
+		if r < 0x20 || r == 0x7f {
+			r = ' '
+		}
+		w := runeWidth(r)
+		if used+w > width {
+			break
+		}
+		out.WriteRune(r)
+		used += w
+	}
+	out.WriteString(strings.Repeat(" ", width-used))
+	return out.String()
+}
+
+// cleanText expands tabs to four spaces and drops the control characters other than line breaks,
+// such as escape codes and carriage returns, which would garble the screen.
+func cleanText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(text, "\t", "    "))
+}
+
+// moveTo writes the escape code moving the cursor to the 1-based row and column.
+func moveTo(screen *bytes.Buffer, row, col int) {
+	fmt.Fprintf(screen, "\x1b[%d;%dH", row, col)
+}
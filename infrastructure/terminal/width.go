@@ -0,0 +1,44 @@
+package terminal
+
+import (
+	"regexp"
+	"unicode"
+)
+
+// ansiPattern matches ANSI escape sequences, which take no space on screen: control sequences
+// such as colors, and operating system commands such as hyperlinks.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// DisplayWidth returns the number of columns s occupies on screen, ignoring escape sequences.
+func DisplayWidth(s string) int {
+	width := 0
+	for _, r := range ansiPattern.ReplaceAllString(s, "") {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth returns the number of columns r occupies on screen: 0 for combining marks,
+// 2 for East Asian wide and fullwidth characters, 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0x303E, // CJK radicals, Kangxi, CJK symbols and punctuation
+		r >= 0x3041 && r <= 0x33FF, // Hiragana, Katakana, Bopomofo, CJK compatibility
+		r >= 0x3400 && r <= 0x4DBF, // CJK extension A
+		r >= 0x4E00 && r <= 0x9FFF, // CJK unified ideographs
+		r >= 0xA000 && r <= 0xA4CF, // Yi
+		r >= 0xAC00 && r <= 0xD7A3, // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF, // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60, // Fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F, // Emoji
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions B and later
+		return 2
+	}
+	return 1
+}
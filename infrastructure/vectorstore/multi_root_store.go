@@ -0,0 +1,81 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"code-ai-editor/domain"
+)
+
+// MultiRootStore implements the domain.VectorStore interface over the collections of several
+// workspace roots. Queries search every collection and return the best matches overall, with
+// the file paths of named roots prefixed with the root name; upserts go to the default root.
+type MultiRootStore struct {
+	stores map[string]domain.VectorStore // By root name, "" for the default root
+	names  []string                      // Root names, sorted
+}
+
+// NewMultiRootStore creates a vector store over the given stores, keyed by root name.
+// The default root, keyed by "", must be among them.
+func NewMultiRootStore(stores map[string]domain.VectorStore) (*MultiRootStore, error) {
+	if _, ok := stores[""]; !ok {
+		return nil, fmt.Errorf("no vector store for the default workspace root")
+	}
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &MultiRootStore{stores: stores, names: names}, nil
+}
+
+// Upsert adds or updates snippets in the collection of the default root.
+func (s *MultiRootStore) Upsert(ctx context.Context, snippets []domain.Snippet) error {
+	return s.stores[""].Upsert(ctx, snippets)
+}
+
+// DeleteSnippetsExcept removes the file snippets of the default root's collection except those with the given IDs.
+func (s *MultiRootStore) DeleteSnippetsExcept(ctx context.Context, keepIDs []string) error {
+	return s.stores[""].DeleteSnippetsExcept(ctx, keepIDs)
+}
+
+// Query searches the collection of every root for the k snippets most similar to the embedding.
+// A root whose collection cannot be searched is skipped with a warning, unless all of them fail.
+func (s *MultiRootStore) Query(ctx context.Context, embedding domain.Embedding, k int) ([]domain.Snippet, error) {
+	var (
+		snippets []domain.Snippet
+		firstErr error
+		failed   int
+	)
+	for _, name := range s.names {
+		results, err := s.stores[name].Query(ctx, embedding, k)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Warning: failed to search the index of workspace root '%s': %v\n", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		for _, snippet := range results {
+			snippet.FilePath = domain.JoinRootPath(name, snippet.FilePath)
+			snippets = append(snippets, snippet)
+		}
+	}
+	if failed == len(s.names) {
+		return nil, firstErr
+	}
+
+	sort.SliceStable(snippets, func(i, j int) bool {
+		return snippets[i].Score > snippets[j].Score
+	})
+	if len(snippets) > k {
+		snippets = snippets[:k]
+	}
+	return snippets, nil
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
 	"code-ai-editor/domain"
+	"code-ai-editor/infrastructure/config"
 
 	"github.com/google/uuid"
 	qdrant "github.com/qdrant/go-client/qdrant"
@@ -19,23 +19,13 @@ import (
 type QdrantClient struct {
 	client         qdrant.PointsClient
 	collectionName string
+	vectorSize     uint64
 }
 
-// NewQdrantClient creates a new QdrantClient.
-// It reads the Qdrant address and collection name from environment variables.
-func NewQdrantClient() (*QdrantClient, error) {
-	qdrantAddr := os.Getenv("QDRANT_ADDR")
-	if qdrantAddr == "" {
-		// Use default address if environment variable is not set
-		qdrantAddr = "localhost:6334"
-		log.Printf("QDRANT_ADDR environment variable not set, using default: %s\n", qdrantAddr)
-	}
-	collectionName := os.Getenv("QDRANT_COLLECTION_NAME")
-	if collectionName == "" {
-		collectionName = "code_snippets" // Default collection name
-	}
-
-	conn, err := grpc.NewClient(qdrantAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewQdrantClient creates a new QdrantClient connected to the configured address.
+// The collection is created with the configured vector size if it does not exist yet.
+func NewQdrantClient(settings config.QdrantConfig) (*QdrantClient, error) {
+	conn, err := grpc.NewClient(settings.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to Qdrant: %w", err)
 	}
@@ -48,7 +38,8 @@ func NewQdrantClient() (*QdrantClient, error) {
 
 	client := &QdrantClient{
 		client:         pointsClient,
-		collectionName: collectionName,
+		collectionName: settings.Collection,
+		vectorSize:     uint64(settings.VectorSize),
 	}
 
 	// Ensure collection exists
@@ -72,13 +63,11 @@ func (c *QdrantClient) ensureCollectionExists(ctx context.Context, collectionsCl
 		log.Printf("Collection %s does not exist, creating...\n", c.collectionName)
 
 		// Create collection with default settings for embeddings
-		// Using size 1536 for OpenAI embeddings (or adjust based on your model)
-		vectorSize := uint64(1536)
-
+		// The vector size must match the embedding model, e.g. 1536 for OpenAI's text-embedding-3-small
 		_, err = collectionsClient.Create(ctx, &qdrant.CreateCollection{
 			CollectionName: c.collectionName,
 			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-				Size:     vectorSize,
+				Size:     c.vectorSize,
 				Distance: qdrant.Distance_Cosine,
 			}),
 		})
@@ -187,6 +176,34 @@ func (c *QdrantClient) Upsert(ctx context.Context, snippets []domain.Snippet) er
 	return nil
 }
 
+// DeleteSnippetsExcept removes the points of indexed files from the Qdrant collection except those
+// with the given IDs. Points without a file_path, such as the memories stored by qdrant_upsert, are kept.
+func (c *QdrantClient) DeleteSnippetsExcept(ctx context.Context, keepIDs []string) error {
+	filter := &qdrant.Filter{
+		MustNot: []*qdrant.Condition{
+			qdrant.NewIsEmpty("file_path"),
+			qdrant.NewMatchKeyword("file_path", ""),
+		},
+	}
+	if len(keepIDs) > 0 {
+		ids := make([]*qdrant.PointId, len(keepIDs))
+		for i, id := range keepIDs {
+			ids[i] = qdrant.NewIDUUID(id)
+		}
+		filter.MustNot = append(filter.MustNot, qdrant.NewHasID(ids...))
+	}
+
+	_, err := c.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: c.collectionName,
+		Points:         &qdrant.PointsSelector{PointsSelectorOneOf: &qdrant.PointsSelector_Filter{Filter: filter}},
+		Wait:           proto.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete points from Qdrant: %w", err)
+	}
+	return nil
+}
+
 // Query searches for snippets similar to the given text embedding.
 func (c *QdrantClient) Query(ctx context.Context, embedding domain.Embedding, k int) ([]domain.Snippet, error) {
 	searchRequest := &qdrant.SearchPoints{
@@ -252,6 +269,7 @@ func (c *QdrantClient) Query(ctx context.Context, embedding domain.Embedding, k
 			EndLine:   int(endLine),
 			Symbols:   symbols,
 			Metadata:  metadata,
+			Score:     hit.GetScore(),
 		})
 	}
 
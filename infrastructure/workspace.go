@@ -0,0 +1,93 @@
+package infrastructure
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code-ai-editor/domain"
+)
+
+// Workspace is the set of directories the file tools can access. Paths are relative to the
+// default root, or to a named root when prefixed with its name, e.g. "shared:pkg/util.go".
+type Workspace struct {
+	dirs  map[string]string // Absolute directory of each root, by name ("" for the default root)
+	names []string          // Names of the named roots, sorted
+}
+
+// NewWorkspace creates a workspace from its roots, the default root first.
+func NewWorkspace(roots []domain.WorkspaceRoot) (*Workspace, error) {
+	workspace := &Workspace{dirs: make(map[string]string)}
+	for _, root := range roots {
+		dir, err := filepath.Abs(root.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for workspace root '%s': %w", root.Dir, err)
+		}
+		workspace.dirs[root.Name] = dir
+		if root.Name != "" {
+			workspace.names = append(workspace.names, root.Name)
+		}
+	}
+	if _, ok := workspace.dirs[""]; !ok {
+		return nil, fmt.Errorf("workspace has no default root")
+	}
+	sort.Strings(workspace.names)
+	return workspace, nil
+}
+
+// Dir returns the absolute directory of the default root.
+func (w *Workspace) Dir() string {
+	return w.dirs[""]
+}
+
+// RootNames returns the names of the named roots, sorted.
+func (w *Workspace) RootNames() []string {
+	return w.names
+}
+
+// Resolve returns the absolute path of a tool path, which must stay inside its root.
+func (w *Workspace) Resolve(path string) (string, error) {
+	root, relativePath := domain.SplitRootPath(path)
+	rootDir, ok := w.dirs[root]
+	if !ok {
+		return "", fmt.Errorf("invalid path: '%s' refers to unknown workspace root '%s'%s", path, root, w.knownRoots())
+	}
+
+	// Clean the user-provided path and join it with the root directory
+	// Users should provide paths relative to the root, e.g., "my_subdir/my_file.go"
+	cleanedRelativePath := filepath.Clean(relativePath)
+
+	// Prevent path traversal attempts like "../sensitive_file"
+	if strings.HasPrefix(cleanedRelativePath, "..") {
+		return "", fmt.Errorf("invalid path: '%s' attempts to traverse outside the workspace", path)
+	}
+
+	absFullPath := filepath.Join(rootDir, cleanedRelativePath)
+
+	// Final check: Ensure the resolved path is truly within the root directory
+	rel, err := filepath.Rel(rootDir, absFullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path: '%s' resolves outside the workspace directory", path)
+	}
+
+	return absFullPath, nil
+}
+
+// knownRoots lists the named roots for error messages.
+func (w *Workspace) knownRoots() string {
+	if len(w.names) == 0 {
+		return " (no named roots are configured)"
+	}
+	return fmt.Sprintf(" (known roots: %s)", strings.Join(w.names, ", "))
+}
+
+// pathHelp returns a sentence for the file tool descriptions explaining how to address the
+// named roots, or "" if there are none.
+func (w *Workspace) pathHelp() string {
+	if len(w.names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" Files in the other workspace roots (%s) are addressed by prefixing the path with the root name, e.g. '%s:README.md'.",
+		strings.Join(w.names, ", "), w.names[0])
+}
@@ -8,131 +8,151 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
-
-	"code-ai-editor/application"
-	"code-ai-editor/domain"
-	"code-ai-editor/infrastructure"
-	infra_embedding "code-ai-editor/infrastructure/embedding"
-	infra_vectorstore "code-ai-editor/infrastructure/vectorstore"
 
 	"github.com/joho/godotenv"
-	openai "github.com/sashabaranov/go-openai"
 )
 
-// Command-line flags
-var (
-	indexFlag = flag.Bool("index", false, "Index files in the workspace directory for vector search")
+// version is the release version, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// command is a subcommand of the CLI, such as "chat" or "index".
+type command struct {
+	name    string
+	args    string // Synopsis of the positional arguments, e.g. "<query>"
+	summary string
+	run     func(ctx context.Context, fs *flag.FlagSet, deps *dependencies, args []string) error // Registers its flags on fs and parses args
+
+	handlesSignals bool // Handles Ctrl+C itself instead of having ctx cancelled by it
+}
+
+// commands lists the subcommands in the order they are shown in the help text.
+var commands = []command{
+	{name: "chat", args: "", summary: "Chat with the agent interactively (the default command)", run: runChat, handlesSignals: true},
+	{name: "ask", args: "<prompt>", summary: "Run the agent on a single prompt and print the answer", run: runAsk},
+	{name: "index", args: "", summary: "Index the workspace roots for vector search", run: runIndex},
+	{name: "search", args: "<query>", summary: "Search the index for code related to the query", run: runSearch},
+	{name: "tools", args: "list", summary: "List the tools available to the agent", run: runTools},
+	{name: "sessions", args: "", summary: "List stored chat sessions", run: runSessions},
+	{name: "config", args: "show", summary: "Show the effective configuration", run: runConfig},
+	{name: "version", args: "", summary: "Print version information", run: runVersion},
+}
+
+// Exit statuses of the process, so that scripts can tell failures apart.
+const (
+	exitFailure        = 1   // A command failed, e.g. a service could not be reached
+	exitUsage          = 2   // Invalid flags or arguments
+	exitBudgetExceeded = 3   // The session cost or token budget was exceeded
+	exitIncomplete     = 4   // ask: the agent stopped before giving a final answer
+	exitInterrupted    = 130 // chat: ended by Ctrl+C or SIGTERM (128 + SIGINT, as shells report it)
 )
 
+// exitError carries the exit status a command wants the process to end with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode wraps err so that the process exits with the given status.
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
 // main is the entry point of the code-ai-editor-cli application.
-// It initializes the Anthropic AI client, tool repository, user message provider,
-// and the chatbot service. It then starts the chatbot and handles any errors that occur.
-// The application uses signal.NotifyContext to handle Ctrl+C gracefully.
+// It dispatches to the subcommand named by the first argument, defaulting to "chat"
+// so that running the binary without arguments (or with only chat flags) starts a chat.
+// Dependencies such as Qdrant, the embedding client and the AI client are created lazily,
+// only by the commands that need them.
+// The application uses signal.NotifyContext to handle Ctrl+C gracefully; chat handles it
+// itself, so that Ctrl+C can cancel a single turn.
 func main() {
-	flag.Parse()
-
 	// Load environment variables from .env.local file
 	if err := godotenv.Load(".env.local"); err != nil {
 		log.Println("Warning: Could not load .env.local file. Using environment variables directly.")
 	}
 
-	// Create a done channel to ensure immediate exit on signal
-	done := make(chan struct{})
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		fmt.Println("\nReceived interrupt signal, shutting down...")
-		os.Stdout.Sync()
-		close(done) // Corrected: Keep done channel
-		go func() {
-			<-time.After(500 * time.Millisecond)
-			os.Exit(0)
-		}()
-	}()
-
-	// Initialize Vector Store (Qdrant)
-	vectorStore, err := infra_vectorstore.NewQdrantClient()
-	if err != nil {
-		log.Fatalf("Error initializing Qdrant client: %s\n", err.Error())
+	name, args := "chat", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) == 1 && isHelpFlag(args[0]) {
+		printUsage(nil)
+		return
+	}
+	if name == "help" {
+		printUsage(args)
+		return
 	}
 
-	// Initialize Embedding Client (OpenAI)
-	embeddingModel := openai.SmallEmbedding3
-	embeddingClient, err := infra_embedding.NewOpenAIEmbeddingClient(embeddingModel)
-	if err != nil {
-		if os.Getenv("OPENAI_API_KEY") == "" {
-			log.Println("Warning: OPENAI_API_KEY not set. Context retrieval via embeddings will be disabled.")
-			embeddingClient = nil
-		} else {
-			log.Fatalf("Error initializing OpenAI client: %s\n", err.Error())
-		}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", name)
+		printUsage(nil)
+		os.Exit(exitUsage)
 	}
 
-	// Initialize Code Parser
-	codeParser := domain.NewGoCodeParser()
+	ctx := context.Background()
+	if !cmd.handlesSignals {
+		var cancel context.CancelFunc
+		ctx, cancel = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+	}
 
-	// Handle indexing if --index flag is provided
-	if *indexFlag {
-		if embeddingClient == nil {
-			log.Fatalf("Cannot perform indexing without a valid embedding client (OPENAI_API_KEY missing?).")
+	err := cmd.run(ctx, newFlagSet(cmd), &dependencies{}, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		code := exitFailure
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
 		}
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(code)
+	}
+}
 
-		// Always index the workspace directory
-		workspaceDir := "./workspace"
-
-		// Ensure the workspace directory exists
-		if _, err := os.Stat(workspaceDir); os.IsNotExist(err) {
-			log.Printf("Workspace directory does not exist, creating: %s\n", workspaceDir)
-			if err := os.MkdirAll(workspaceDir, 0755); err != nil {
-				log.Fatalf("Failed to create workspace directory: %s\n", err.Error())
-			}
+// findCommand returns the subcommand with the given name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
+	}
+	return command{}, false
+}
 
-		indexingService := application.NewIndexingService(codeParser, embeddingClient, vectorStore)
-		log.Printf("Starting indexing for workspace directory: %s\n", workspaceDir)
-		if err := indexingService.IndexDirectory(ctx, workspaceDir); err != nil {
-			log.Fatalf("Error during indexing: %s\n", err.Error())
+// printUsage prints the list of subcommands, or the help of the subcommand named in args.
+func printUsage(args []string) {
+	if len(args) > 0 {
+		if cmd, ok := findCommand(args[0]); ok {
+			_ = cmd.run(context.Background(), newFlagSet(cmd), &dependencies{}, []string{"-help"})
+			return
 		}
-		log.Println("Indexing complete.")
-		return // Exit after indexing
 	}
 
-	// --- Initialize core chatbot components ---
-	aiClient, err := infrastructure.NewAnthropicClient()
-	if err != nil {
-		log.Fatalf("Error initializing Anthropic client: %s\n", err.Error())
+	fmt.Fprintf(os.Stderr, "Usage: code-ai-editor <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun 'code-ai-editor help <command>' or 'code-ai-editor <command> -help' for the flags of a command.\n")
+}
 
-	toolRepository := infrastructure.NewFileToolRepository(vectorStore, embeddingClient)
-
-	userMessageProvider := application.CreateConsoleUserMessageProvider()
-
-	// Pass VectorStore and EmbeddingClient to the Agent
-	// Corrected: Pass all required arguments
-	agent := domain.NewAgent(aiClient, userMessageProvider, toolRepository, vectorStore, embeddingClient)
-
-	chatbotService := application.NewChatbotService(agent)
-
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- chatbotService.StartChatbot(ctx)
-	}()
+// isHelpFlag reports whether arg asks for help.
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
 
-	select {
-	case err := <-errChan:
-		if err != nil && !errors.Is(err, context.Canceled) {
-			fmt.Printf("Error: %s\n", err.Error())
-			os.Exit(1)
-		}
-	case <-done: // Corrected: Keep done channel usage
-		// Immediate exit path from signal handler
+// newFlagSet creates the flag set of a subcommand with a usage text listing its arguments and flags.
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: code-ai-editor %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
 	}
-
-	fmt.Println("\nGoodbye!")
+	return fs
 }